@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AgentReport is the payload an agent pushes to the server
+type AgentReport struct {
+	Host    SystemInfo    `json:"host"`
+	Samples []SystemStats `json:"samples"`
+}
+
+// Agent collects stats locally and pushes them to a fleet server,
+// buffering samples while the server is unreachable
+type Agent struct {
+	monitor        *Monitor
+	serverURL      string
+	token          string
+	hostname       string
+	sampleInterval time.Duration
+	pushInterval   time.Duration
+	maxBuffer      int
+	batchSize      int
+	client         *http.Client
+
+	mu      sync.Mutex
+	buffer  []SystemStats
+	dropped int
+	failing bool
+}
+
+// run samples and pushes until ctx is cancelled
+func (a *Agent) run(ctx context.Context) {
+	sampleTicker := time.NewTicker(a.sampleInterval)
+	defer sampleTicker.Stop()
+	pushTicker := time.NewTicker(a.pushInterval)
+	defer pushTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sampleTicker.C:
+			a.record(a.monitor.collectStats())
+		case <-pushTicker.C:
+			a.flush(ctx)
+		}
+	}
+}
+
+// record appends a sample, dropping the oldest once the buffer is full
+func (a *Agent) record(stats SystemStats) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.buffer = append(a.buffer, stats)
+	if over := len(a.buffer) - a.maxBuffer; over > 0 {
+		a.buffer = a.buffer[over:]
+		a.dropped += over
+	}
+}
+
+// flush pushes buffered samples in batches until the buffer is empty or
+// a push fails, in which case the remaining samples are kept for later
+func (a *Agent) flush(ctx context.Context) {
+	info := a.monitor.systemInfo()
+	if a.hostname != "" {
+		info.Hostname = a.hostname
+	}
+
+	for {
+		a.mu.Lock()
+		n := len(a.buffer)
+		if n > a.batchSize {
+			n = a.batchSize
+		}
+		batch := append([]SystemStats(nil), a.buffer[:n]...)
+		droppedBefore := a.dropped
+		a.mu.Unlock()
+
+		if len(batch) == 0 {
+			return
+		}
+
+		err := a.push(ctx, AgentReport{Host: info, Samples: batch})
+
+		a.mu.Lock()
+		if err != nil {
+			if !a.failing {
+				log.Printf("Push to %s failed, buffering samples: %v", a.serverURL, err)
+			}
+			a.failing = true
+			a.mu.Unlock()
+			return
+		}
+		if a.failing {
+			log.Printf("Push to %s recovered, sending %d buffered samples", a.serverURL, len(a.buffer))
+			a.failing = false
+		}
+		// Samples recorded during the push were appended after the batch,
+		// but the oldest ones may have been dropped to make room for them
+		if sent := len(batch) - (a.dropped - droppedBefore); sent > 0 {
+			a.buffer = a.buffer[sent:]
+		}
+		if a.dropped > 0 {
+			log.Printf("Dropped %d samples while the server was unreachable", a.dropped)
+			a.dropped = 0
+		}
+		a.mu.Unlock()
+	}
+}
+
+// push sends a single report to the server
+func (a *Agent) push(ctx context.Context, report AgentReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.serverURL+"/api/ingest", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+a.token)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server responded %s", resp.Status)
+	}
+	return nil
+}
+
+// runAgent parses agent flags and runs until SIGINT or SIGTERM
+func runAgent(args []string) {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	serverURL := fs.String("server", os.Getenv("SYSMON_SERVER"), "fleet server URL, e.g. http://monitor:8080")
+	token := fs.String("token", os.Getenv("SYSMON_TOKEN"), "shared ingest token")
+	hostname := fs.String("name", "", "host name to report (defaults to the system hostname)")
+	sampleInterval := fs.Duration("sample-interval", 2*time.Second, "how often to take a sample")
+	pushInterval := fs.Duration("push-interval", 10*time.Second, "how often to push samples to the server")
+	maxBuffer := fs.Int("buffer", 5000, "max samples kept while the server is unreachable")
+	caCert := fs.String("ca-cert", "", "PEM file with the CA (or self-signed) certificate of the server")
+	insecure := fs.Bool("insecure-skip-verify", false, "don't verify the server's TLS certificate")
+	fs.Parse(args)
+
+	if *serverURL == "" || *token == "" {
+		fmt.Fprintln(os.Stderr, "agent mode requires -server and -token (or SYSMON_SERVER and SYSMON_TOKEN)")
+		os.Exit(2)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: *insecure}
+	if *caCert != "" {
+		pem, err := os.ReadFile(*caCert)
+		if err != nil {
+			log.Fatalf("Failed to read CA certificate: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			log.Fatalf("No certificates found in %s", *caCert)
+		}
+	}
+
+	monitor := NewMonitor(systemSources())
+	registerScriptCollectors(monitor)
+	ctx, stop := shutdownContext()
+	defer stop()
+	monitor.registry.Start(ctx)
+
+	agent := &Agent{
+		monitor:        monitor,
+		serverURL:      strings.TrimRight(*serverURL, "/"),
+		token:          *token,
+		hostname:       *hostname,
+		sampleInterval: *sampleInterval,
+		pushInterval:   *pushInterval,
+		maxBuffer:      *maxBuffer,
+		batchSize:      500,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+
+	fmt.Printf("🛰️  System Monitor agent pushing to %s every %s\n", agent.serverURL, agent.pushInterval)
+	agent.run(ctx)
+
+	// Push what is still buffered before exiting
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	agent.flush(flushCtx)
+	monitor.registry.Wait()
+	log.Println("Stopped")
+}
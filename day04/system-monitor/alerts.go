@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// alertHistorySize is how many alert events are kept
+const alertHistorySize = 1000
+
+// Alert severities, from least to most severe
+const (
+	severityResolved = "resolved"
+	severityWarning  = "warning"
+	severityCritical = "critical"
+)
+
+// AlertEvent records a metric entering or leaving an alerting state
+type AlertEvent struct {
+	Time      time.Time `json:"time"`
+	Source    string    `json:"source"`
+	Metric    string    `json:"metric"`
+	Severity  string    `json:"severity"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// thresholdRule raises a warning or critical alert when a metric
+// reaches the given levels
+type thresholdRule struct {
+	metric   string
+	warning  float64
+	critical float64
+}
+
+// defaultThresholds are the built-in static alert rules
+var defaultThresholds = []thresholdRule{
+	{metric: "cpu_percent", warning: 80, critical: 95},
+	{metric: "memory_percent", warning: 85, critical: 95},
+	{metric: "swap_percent", warning: 50, critical: 80},
+	{metric: "disk_percent", warning: 85, critical: 95},
+}
+
+// Alerts keeps a bounded log of alert events and tracks which alerts
+// are currently active so only state changes are recorded
+type Alerts struct {
+	mu     sync.RWMutex
+	events []AlertEvent
+	active map[string]string // source/metric -> severity
+	rules  []thresholdRule
+}
+
+// NewAlerts creates an alert log evaluating the given threshold rules
+func NewAlerts(rules []thresholdRule) *Alerts {
+	return &Alerts{
+		active: make(map[string]string),
+		rules:  rules,
+	}
+}
+
+// evaluate checks a sample against the threshold rules
+func (a *Alerts) evaluate(stats SystemStats) {
+	for _, rule := range a.rules {
+		value, ok := metricValue(stats, rule.metric)
+		if !ok {
+			continue
+		}
+		severity, threshold := severityResolved, rule.warning
+		switch {
+		case value >= rule.critical:
+			severity, threshold = severityCritical, rule.critical
+		case value >= rule.warning:
+			severity = severityWarning
+		}
+		a.update(AlertEvent{
+			Time:      stats.Timestamp,
+			Source:    "threshold",
+			Metric:    rule.metric,
+			Severity:  severity,
+			Value:     value,
+			Threshold: threshold,
+			Message:   fmt.Sprintf("%s is %.1f (%s at %.0f)", rule.metric, value, severity, threshold),
+		})
+	}
+}
+
+// update records e if it changes the state of its source and metric.
+// Other detectors feed their findings through here as well.
+func (a *Alerts) update(e AlertEvent) {
+	key := e.Source + "/" + e.Metric
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	previous, firing := a.active[key]
+	if e.Severity == severityResolved {
+		if !firing {
+			return
+		}
+		delete(a.active, key)
+		e.Message = fmt.Sprintf("%s recovered (was %s)", e.Metric, previous)
+	} else {
+		if previous == e.Severity {
+			return
+		}
+		a.active[key] = e.Severity
+	}
+
+	log.Printf("Alert %s: %s", e.Severity, e.Message)
+	a.events = append(a.events, e)
+	if len(a.events) > alertHistorySize {
+		a.events = a.events[1:]
+	}
+}
+
+// between returns the events in [from, to]; zero times are unbounded
+func (a *Alerts) between(from, to time.Time) []AlertEvent {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	events := []AlertEvent{}
+	for _, e := range a.events {
+		if (from.IsZero() || !e.Time.Before(from)) && (to.IsZero() || !e.Time.After(to)) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// severityRank orders severities for sorting, most severe first
+func severityRank(severity string) int {
+	switch severity {
+	case severityCritical:
+		return 0
+	case severityWarning:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (m *Monitor) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(m.alerts.between(from, to))
+}
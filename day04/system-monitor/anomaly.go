@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Anomaly detector tuning
+const (
+	// ewmaAlpha weights new samples in the recent baseline; at the 2s
+	// sampling interval it reacts over roughly a minute
+	ewmaAlpha = 0.05
+	// seasonalAlpha weights new samples in the hour-of-day baselines
+	seasonalAlpha = 0.02
+	// rollingWindow is the number of samples in the rolling z-score
+	rollingWindow = 300
+	// anomalyZ is the z-score beyond which a sample is abnormal
+	anomalyZ = 4.0
+	// warmupSamples are needed before the recent baselines are trusted
+	warmupSamples = 30
+	// seasonalWarmup samples are needed in an hour-of-day bucket before
+	// it is used; with in-memory state this takes a day of runtime
+	seasonalWarmup = 100
+
+	// trendStep is the spacing of the points kept for trend fitting
+	trendStep = time.Minute
+	// diskTrendPoints and memoryTrendPoints bound the trend windows
+	diskTrendPoints   = 24 * 60
+	memoryTrendPoints = 60
+	// minTrendPoints are needed before a forecast is made
+	minTrendPoints = 15
+	// leakConfidence is the R² a memory trend needs to count as a leak
+	leakConfidence = 0.9
+	// diskConfidence is the R² a disk trend needs to raise alerts
+	diskConfidence = 0.5
+	// forecastHorizon is how far ahead exhaustion raises alerts
+	forecastHorizon = 24 * time.Hour
+)
+
+// anomalyMetrics are the metrics scored for anomalies. floor is the
+// smallest standard deviation assumed, so a flat metric doesn't turn
+// every tiny wobble into an anomaly.
+var anomalyMetrics = []struct {
+	name  string
+	floor float64
+}{
+	{"cpu_percent", 2},
+	{"memory_percent", 0.5},
+	{"swap_percent", 0.5},
+	{"disk_percent", 0.1},
+	{"load1", 0.2},
+	{"goroutines", 2},
+	{"network_rx_bytes_per_sec", 10 * 1024},
+	{"network_tx_bytes_per_sec", 10 * 1024},
+}
+
+// Anomaly is a sample that deviated from its baselines
+type Anomaly struct {
+	Time     time.Time `json:"time"`
+	Metric   string    `json:"metric"`
+	Value    float64   `json:"value"`
+	Expected float64   `json:"expected"`
+	ZScore   float64   `json:"z_score"`
+	RollingZ float64   `json:"rolling_z"`
+	// Seasonal is set when the hour-of-day baseline was also consulted
+	Seasonal bool   `json:"seasonal"`
+	Method   string `json:"method"`
+}
+
+// Forecast projects when a growing resource will run out
+type Forecast struct {
+	Metric        string     `json:"metric"`
+	Current       float64    `json:"current"`
+	Limit         float64    `json:"limit"`
+	GrowthPerHour float64    `json:"growth_per_hour"`
+	Confidence    float64    `json:"confidence"`
+	ExhaustedAt   *time.Time `json:"exhausted_at,omitempty"`
+}
+
+// Baseline describes what the detector currently considers normal
+type Baseline struct {
+	Metric        string  `json:"metric"`
+	Mean          float64 `json:"mean"`
+	StdDev        float64 `json:"stddev"`
+	Samples       int     `json:"samples"`
+	SeasonalReady int     `json:"seasonal_ready"`
+}
+
+// ewma is an exponentially weighted mean and variance
+type ewma struct {
+	mean     float64
+	variance float64
+	n        int
+}
+
+func (e *ewma) update(x, alpha float64) {
+	if e.n == 0 {
+		e.mean = x
+	} else {
+		diff := x - e.mean
+		incr := alpha * diff
+		e.mean += incr
+		e.variance = (1 - alpha) * (e.variance + diff*incr)
+	}
+	e.n++
+}
+
+func (e *ewma) score(x, floor float64) float64 {
+	return (x - e.mean) / math.Max(math.Sqrt(e.variance), floor)
+}
+
+// rolling is a fixed-size window of recent values
+type rolling struct {
+	values []float64
+	next   int
+}
+
+func (r *rolling) add(x float64) {
+	if len(r.values) < rollingWindow {
+		r.values = append(r.values, x)
+		return
+	}
+	r.values[r.next] = x
+	r.next = (r.next + 1) % rollingWindow
+}
+
+func (r *rolling) score(x, floor float64) float64 {
+	var sum, sumSq float64
+	for _, v := range r.values {
+		sum += v
+		sumSq += v * v
+	}
+	n := float64(len(r.values))
+	mean := sum / n
+	std := math.Sqrt(math.Max(sumSq/n-mean*mean, 0))
+	return (x - mean) / math.Max(std, floor)
+}
+
+// metricDetector holds the baselines of one metric
+type metricDetector struct {
+	floor    float64
+	recent   ewma
+	window   rolling
+	seasonal [24]ewma // by local hour of day
+}
+
+// trendPoint is one point of a downsampled series
+type trendPoint struct {
+	t time.Time
+	v float64
+}
+
+// trend keeps one point per trendStep for least-squares fitting
+type trend struct {
+	points []trendPoint
+	max    int
+}
+
+func (tr *trend) add(t time.Time, v float64) {
+	if n := len(tr.points); n > 0 && t.Sub(tr.points[n-1].t) < trendStep {
+		return
+	}
+	tr.points = append(tr.points, trendPoint{t, v})
+	if len(tr.points) > tr.max {
+		tr.points = tr.points[1:]
+	}
+}
+
+// fit returns the slope per second and the R² of a linear fit
+func (tr *trend) fit() (slope, r2 float64, ok bool) {
+	n := float64(len(tr.points))
+	if len(tr.points) < minTrendPoints {
+		return 0, 0, false
+	}
+	origin := tr.points[0].t
+	var sx, sy, sxx, sxy, syy float64
+	for _, p := range tr.points {
+		x := p.t.Sub(origin).Seconds()
+		sx += x
+		sy += p.v
+		sxx += x * x
+		sxy += x * p.v
+		syy += p.v * p.v
+	}
+	varX := n*sxx - sx*sx
+	varY := n*syy - sy*sy
+	if varX == 0 {
+		return 0, 0, false
+	}
+	slope = (n*sxy - sx*sy) / varX
+	if varY == 0 {
+		return slope, 1, true
+	}
+	cov := n*sxy - sx*sy
+	return slope, cov * cov / (varX * varY), true
+}
+
+// forecast projects when current reaches limit at the fitted rate
+func (tr *trend) forecast(metric string, current, limit float64, now time.Time) (Forecast, bool) {
+	slope, r2, ok := tr.fit()
+	if !ok || limit <= 0 {
+		return Forecast{}, false
+	}
+	f := Forecast{
+		Metric:        metric,
+		Current:       current,
+		Limit:         limit,
+		GrowthPerHour: slope * 3600,
+		Confidence:    r2,
+	}
+	if slope > 0 {
+		at := now.Add(time.Duration((limit - current) / slope * float64(time.Second)))
+		f.ExhaustedAt = &at
+	}
+	return f, true
+}
+
+// AnomalyDetector scores every sample against a recent EWMA baseline, a
+// rolling z-score and, once warmed up, an hour-of-day baseline, and
+// fits trends to disk and memory usage to catch slow growth
+type AnomalyDetector struct {
+	mu        sync.RWMutex
+	metrics   map[string]*metricDetector
+	anomalies []Anomaly
+	forecasts map[string]Forecast
+	disk      trend
+	memory    trend
+	leaking   bool // the memory trend currently looks like a leak
+}
+
+// NewAnomalyDetector creates a detector with empty baselines
+func NewAnomalyDetector() *AnomalyDetector {
+	d := &AnomalyDetector{
+		metrics:   make(map[string]*metricDetector),
+		forecasts: make(map[string]Forecast),
+		disk:      trend{max: diskTrendPoints},
+		memory:    trend{max: memoryTrendPoints},
+	}
+	for _, metric := range anomalyMetrics {
+		d.metrics[metric.name] = &metricDetector{floor: metric.floor}
+	}
+	return d
+}
+
+// observe scores a sample, updates the baselines and returns the alert
+// state of every detector so the caller can raise and resolve alerts
+func (d *AnomalyDetector) observe(stats SystemStats) []AlertEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var events []AlertEvent
+	hour := stats.Timestamp.Local().Hour()
+	for _, metric := range anomalyMetrics {
+		value, _ := metricValue(stats, metric.name)
+		md := d.metrics[metric.name]
+
+		if md.recent.n >= warmupSamples {
+			anomaly := Anomaly{
+				Time:     stats.Timestamp,
+				Metric:   metric.name,
+				Value:    value,
+				Expected: md.recent.mean,
+				ZScore:   md.recent.score(value, md.floor),
+				RollingZ: md.window.score(value, md.floor),
+				Method:   "ewma",
+			}
+			abnormal := math.Abs(anomaly.ZScore) >= anomalyZ && math.Abs(anomaly.RollingZ) >= anomalyZ
+
+			// A deviation that is usual for this time of day isn't abnormal
+			if season := &md.seasonal[hour]; abnormal && season.n >= seasonalWarmup {
+				anomaly.Seasonal = true
+				anomaly.Expected = season.mean
+				abnormal = math.Abs(season.score(value, md.floor)) >= anomalyZ
+			}
+
+			event := AlertEvent{
+				Time:     stats.Timestamp,
+				Source:   "anomaly",
+				Metric:   metric.name,
+				Severity: severityResolved,
+				Value:    value,
+			}
+			if abnormal {
+				d.record(anomaly)
+				event.Severity = severityWarning
+				event.Message = fmt.Sprintf("%s is abnormal: %.4g (expected %.4g, z=%.1f)",
+					metric.name, value, anomaly.Expected, anomaly.ZScore)
+			}
+			events = append(events, event)
+		}
+
+		md.recent.update(value, ewmaAlpha)
+		md.window.add(value)
+		md.seasonal[hour].update(value, seasonalAlpha)
+	}
+
+	return append(events, d.updateForecasts(stats)...)
+}
+
+// updateForecasts refits the disk and memory trends and reports
+// exhaustion within forecastHorizon
+func (d *AnomalyDetector) updateForecasts(stats SystemStats) []AlertEvent {
+	d.disk.add(stats.Timestamp, float64(stats.DiskUsed))
+	d.memory.add(stats.Timestamp, float64(stats.MemoryUsed))
+
+	var events []AlertEvent
+	// Blocks reserved for root mean used space never reaches the total
+	usable := float64(stats.DiskUsed + stats.DiskFree)
+	if f, ok := d.disk.forecast("disk_used", float64(stats.DiskUsed), usable, stats.Timestamp); ok {
+		d.forecasts["disk_used"] = f
+		events = append(events, exhaustionEvent(f, "disk_full", stats.Timestamp, diskConfidence))
+	}
+	if f, ok := d.memory.forecast("memory_used", float64(stats.MemoryUsed), float64(stats.MemoryTotal), stats.Timestamp); ok {
+		d.forecasts["memory_used"] = f
+		event := exhaustionEvent(f, "memory_leak", stats.Timestamp, leakConfidence)
+		leaking := event.Severity != severityResolved
+		if leaking && !d.leaking {
+			d.record(Anomaly{
+				Time:     stats.Timestamp,
+				Metric:   "memory_used",
+				Value:    f.Current,
+				Expected: d.memory.points[0].v,
+				Method:   "trend",
+			})
+		}
+		d.leaking = leaking
+		events = append(events, event)
+	}
+	return events
+}
+
+// exhaustionEvent turns a forecast into an alert state: critical when
+// exhaustion is under two hours away, warning within forecastHorizon
+func exhaustionEvent(f Forecast, metric string, now time.Time, minConfidence float64) AlertEvent {
+	event := AlertEvent{
+		Time:     now,
+		Source:   "forecast",
+		Metric:   metric,
+		Severity: severityResolved,
+		Value:    f.Current,
+	}
+	if f.ExhaustedAt == nil || f.Confidence < minConfidence {
+		return event
+	}
+	remaining := f.ExhaustedAt.Sub(now)
+	switch {
+	case remaining < 2*time.Hour:
+		event.Severity = severityCritical
+	case remaining < forecastHorizon:
+		event.Severity = severityWarning
+	default:
+		return event
+	}
+	event.Message = fmt.Sprintf("%s: %s projected to reach its limit in %s",
+		metric, f.Metric, remaining.Round(time.Minute))
+	return event
+}
+
+// record keeps an anomaly, dropping the oldest beyond alertHistorySize
+func (d *AnomalyDetector) record(a Anomaly) {
+	d.anomalies = append(d.anomalies, a)
+	if len(d.anomalies) > alertHistorySize {
+		d.anomalies = d.anomalies[1:]
+	}
+}
+
+// between returns the anomalies in [from, to]; zero times are unbounded
+func (d *AnomalyDetector) between(from, to time.Time) []Anomaly {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	anomalies := []Anomaly{}
+	for _, a := range d.anomalies {
+		if (from.IsZero() || !a.Time.Before(from)) && (to.IsZero() || !a.Time.After(to)) {
+			anomalies = append(anomalies, a)
+		}
+	}
+	return anomalies
+}
+
+// Forecasts returns the latest disk and memory forecasts
+func (d *AnomalyDetector) Forecasts() []Forecast {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	forecasts := []Forecast{}
+	for _, name := range []string{"disk_used", "memory_used"} {
+		if f, ok := d.forecasts[name]; ok {
+			forecasts = append(forecasts, f)
+		}
+	}
+	return forecasts
+}
+
+// Baselines returns the current recent baseline of every scored metric
+func (d *AnomalyDetector) Baselines() []Baseline {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	baselines := make([]Baseline, 0, len(anomalyMetrics))
+	for _, metric := range anomalyMetrics {
+		md := d.metrics[metric.name]
+		b := Baseline{
+			Metric:  metric.name,
+			Mean:    md.recent.mean,
+			StdDev:  math.Sqrt(md.recent.variance),
+			Samples: md.recent.n,
+		}
+		for _, season := range md.seasonal {
+			if season.n >= seasonalWarmup {
+				b.SeasonalReady++
+			}
+		}
+		baselines = append(baselines, b)
+	}
+	return baselines
+}
+
+func (m *Monitor) handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"anomalies": m.anomalies.between(from, to),
+		"forecasts": m.anomalies.Forecasts(),
+		"baselines": m.anomalies.Baselines(),
+	})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// severityOf returns the severity observe reported for metric, or ""
+func severityOf(events []AlertEvent, metric string) string {
+	for _, e := range events {
+		if e.Metric == metric {
+			return e.Severity
+		}
+	}
+	return ""
+}
+
+func TestAnomalySpike(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	noisy := func(i int) float64 { return 20 + 2*math.Sin(float64(i)) }
+
+	cases := []struct {
+		name     string
+		samples  int // noisy CPU samples before the last one
+		last     float64
+		severity string // of cpu_percent on the last sample
+	}{
+		{"spike after warmup", 60, 95, severityWarning},
+		{"noise after warmup", 60, noisy(60), severityResolved},
+		{"spike during warmup", warmupSamples - 1, 95, ""},
+		{"dip after warmup", 60, 0, severityWarning},
+	}
+	for _, c := range cases {
+		d := NewAnomalyDetector()
+		for i := 0; i < c.samples; i++ {
+			d.observe(SystemStats{Timestamp: start.Add(time.Duration(i) * 2 * time.Second), CPUPercent: noisy(i)})
+		}
+		at := start.Add(time.Duration(c.samples) * 2 * time.Second)
+		events := d.observe(SystemStats{Timestamp: at, CPUPercent: c.last})
+		if got := severityOf(events, "cpu_percent"); got != c.severity {
+			t.Fatalf("%s: severity=%q want %q", c.name, got, c.severity)
+		}
+		for _, e := range events {
+			if e.Metric != "cpu_percent" && e.Severity != severityResolved {
+				t.Fatalf("%s: flat metric %s flagged: %+v", c.name, e.Metric, e)
+			}
+		}
+
+		anomalies := d.between(time.Time{}, time.Time{})
+		if flagged := c.severity == severityWarning; flagged != (len(anomalies) == 1) {
+			t.Fatalf("%s: recorded %+v", c.name, anomalies)
+		}
+		if len(anomalies) == 1 {
+			if a := anomalies[0]; a.Metric != "cpu_percent" || !a.Time.Equal(at) || math.Abs(a.Expected-20) > 1 || a.Seasonal {
+				t.Fatalf("%s: anomaly=%+v want cpu_percent expected near 20", c.name, a)
+			}
+		}
+	}
+}
+
+func TestAnomalySeasonal(t *testing.T) {
+	// CPU is busy at 03:00 (backups) and quiet otherwise
+	night := time.Date(2024, 5, 1, 3, 0, 0, 0, time.Local)
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+
+	cases := []struct {
+		nightSamples int
+		severity     string
+		ready        int // warm hour-of-day buckets
+	}{
+		{seasonalWarmup, severityResolved, 2},
+		{seasonalWarmup / 2, severityWarning, 1},
+	}
+	for _, c := range cases {
+		d := NewAnomalyDetector()
+		for i := 0; i < c.nightSamples; i++ {
+			d.observe(SystemStats{Timestamp: night.Add(time.Duration(i) * 2 * time.Second), CPUPercent: 95})
+		}
+		for i := 0; i < rollingWindow; i++ {
+			d.observe(SystemStats{Timestamp: day.Add(time.Duration(i) * 2 * time.Second), CPUPercent: 20})
+		}
+
+		// The next night's backup is only unusual without a warm 03:00 bucket
+		events := d.observe(SystemStats{Timestamp: night.Add(24 * time.Hour), CPUPercent: 95})
+		if got := severityOf(events, "cpu_percent"); got != c.severity {
+			t.Fatalf("%d night samples: severity=%q want %q", c.nightSamples, got, c.severity)
+		}
+		if ready := d.Baselines()[0].SeasonalReady; ready != c.ready {
+			t.Fatalf("%d night samples: %d seasonal buckets ready want %d", c.nightSamples, ready, c.ready)
+		}
+	}
+}
+
+func TestTrendFit(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name   string
+		points int
+		value  func(i int) float64 // at minute i
+		ok     bool
+		slope  float64 // per second
+		r2     float64
+	}{
+		{"line", 20, func(i int) float64 { return 100 + 6*float64(i) }, true, 0.1, 1},
+		{"flat", 20, func(i int) float64 { return 50 }, true, 0, 1},
+		{"no trend", 15, func(i int) float64 { return math.Abs(float64(i) - 7) }, true, 0, 0},
+		{"too few points", minTrendPoints - 1, func(i int) float64 { return float64(i) }, false, 0, 0},
+	}
+	for _, c := range cases {
+		tr := trend{max: diskTrendPoints}
+		for i := 0; i < c.points; i++ {
+			tr.add(start.Add(time.Duration(i)*time.Minute), c.value(i))
+		}
+		slope, r2, ok := tr.fit()
+		if ok != c.ok || math.Abs(slope-c.slope) > 1e-9 || math.Abs(r2-c.r2) > 1e-9 {
+			t.Fatalf("%s: fit()=%v, %v, %v want %v, %v, %v", c.name, slope, r2, ok, c.slope, c.r2, c.ok)
+		}
+	}
+
+	// Samples closer than trendStep are skipped and old points dropped
+	tr := trend{max: 5}
+	for i := 0; i < 300; i++ {
+		tr.add(start.Add(time.Duration(i)*2*time.Second), float64(i))
+	}
+	if len(tr.points) != 5 || !tr.points[0].t.Equal(start.Add(5*time.Minute)) {
+		t.Fatalf("trend kept %d points from %v", len(tr.points), tr.points[0].t)
+	}
+}
+
+func TestDiskForecast(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	// Usable space; the filesystem is 5% bigger with the reserved blocks
+	const usable = 1000000
+
+	cases := []struct {
+		name     string
+		used     func(i int) float64 // at minute i
+		severity string
+		// exhausted is when the disk fills, zero when it doesn't
+		exhausted time.Time
+	}{
+		// 10000 a minute from 400000: full 60 minutes in
+		{"linear growth", func(i int) float64 { return 400000 + 10000*float64(i) }, severityCritical, start.Add(time.Hour)},
+		{"slow growth", func(i int) float64 { return 400000 + 1000*float64(i) }, severityWarning, start.Add(600 * time.Minute)},
+		{"flat", func(i int) float64 { return 500000 }, severityResolved, time.Time{}},
+		{"shrinking", func(i int) float64 { return 500000 - 1000*float64(i) }, severityResolved, time.Time{}},
+		{"noisy", func(i int) float64 { return 500000 + 50000*math.Sin(float64(i)*2.5) }, severityResolved, time.Time{}},
+	}
+	for _, c := range cases {
+		d := NewAnomalyDetector()
+		var events []AlertEvent
+		for i := 0; i < 20; i++ {
+			events = d.observe(SystemStats{
+				Timestamp: start.Add(time.Duration(i) * time.Minute),
+				DiskTotal: usable * 105 / 100,
+				DiskUsed:  uint64(math.Round(c.used(i))),
+				DiskFree:  usable - uint64(math.Round(c.used(i))),
+			})
+			if i < minTrendPoints-1 && len(d.Forecasts()) != 0 {
+				t.Fatalf("%s: forecast after %d points", c.name, i+1)
+			}
+		}
+		if got := severityOf(events, "disk_full"); got != c.severity {
+			t.Fatalf("%s: disk_full severity=%q want %q", c.name, got, c.severity)
+		}
+
+		forecasts := d.Forecasts()
+		if len(forecasts) != 1 || forecasts[0].Metric != "disk_used" {
+			t.Fatalf("%s: forecasts=%+v want disk_used only", c.name, forecasts)
+		}
+		f := forecasts[0]
+		if c.exhausted.IsZero() {
+			// A noisy series may point anywhere, but not with confidence
+			if f.ExhaustedAt != nil && f.Confidence >= diskConfidence {
+				t.Fatalf("%s: forecast=%+v want no confident exhaustion", c.name, f)
+			}
+			continue
+		}
+		if f.ExhaustedAt == nil || f.ExhaustedAt.Sub(c.exhausted).Abs() > time.Minute || f.Confidence < 0.99 {
+			t.Fatalf("%s: forecast=%+v want full at %v", c.name, f, c.exhausted)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cgroupRoot is where the cgroup v2 hierarchy is mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// ContainerStats represents the resources of the cgroup the monitor runs
+// in, which is what actually limits it inside a container
+type ContainerStats struct {
+	InContainer bool   `json:"in_container"`
+	Runtime     string `json:"runtime,omitempty"`
+	Cgroup      string `json:"cgroup"`
+
+	// CPUQuotaCores is the CPU limit in cores; 0 means unlimited
+	CPUQuotaCores float64 `json:"cpu_quota_cores"`
+	// CPUPercent is usage relative to the quota, or to every core
+	// when there is no quota
+	CPUPercent       float64 `json:"cpu_percent"`
+	CPUUsageSeconds  float64 `json:"cpu_usage_seconds"`
+	Periods          uint64  `json:"cpu_periods"`
+	ThrottledPeriods uint64  `json:"cpu_throttled_periods"`
+	ThrottledSeconds float64 `json:"cpu_throttled_seconds"`
+
+	MemoryUsed uint64 `json:"memory_used"`
+	// MemoryLimit is 0 when the cgroup has no memory limit
+	MemoryLimit   uint64  `json:"memory_limit"`
+	MemoryPercent float64 `json:"memory_percent"`
+	SwapUsed      uint64  `json:"swap_used"`
+	OOMKills      uint64  `json:"oom_kills"`
+
+	PIDs uint64 `json:"pids"`
+	// PIDsLimit is 0 when the cgroup has no PID limit
+	PIDsLimit uint64 `json:"pids_limit"`
+}
+
+// cgroupCollector reads the monitor's own cgroup v2 controllers
+type cgroupCollector struct {
+	root      string // cgroup v2 mount point
+	dir       string // this process's cgroup below root
+	container bool
+	runtime   string
+
+	mu        sync.RWMutex
+	stats     *ContainerStats
+	lastUsage float64
+	lastTime  time.Time
+}
+
+// newCgroupCollector returns a collector for the current process's
+// cgroup, or nil when the host doesn't use cgroup v2
+func newCgroupCollector(root string) *cgroupCollector {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		return nil
+	}
+	path, err := ownCgroup("/proc/self/cgroup")
+	if err != nil {
+		return nil
+	}
+	runtimeName, inContainer := detectContainer()
+	return &cgroupCollector{
+		root:      root,
+		dir:       filepath.Join(root, path),
+		container: inContainer,
+		runtime:   runtimeName,
+	}
+}
+
+// ownCgroup returns the cgroup v2 path from a /proc/<pid>/cgroup file.
+// Inside a container with its own cgroup namespace this is "/".
+func ownCgroup(procFile string) (string, error) {
+	data, err := os.ReadFile(procFile)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", os.ErrNotExist
+}
+
+// detectContainer guesses whether the process runs in a container and
+// which runtime started it
+func detectContainer() (string, bool) {
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return "docker", true
+	}
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		return "podman", true
+	}
+	if name := os.Getenv("container"); name != "" {
+		return name, true // set by systemd-nspawn, podman and LXC
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes", true
+	}
+	if data, err := os.ReadFile("/proc/1/cgroup"); err == nil {
+		for _, marker := range []string{"kubepods", "docker", "containerd", "libpod", "lxc"} {
+			if strings.Contains(string(data), marker) {
+				return marker, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (c *cgroupCollector) Name() string            { return "cgroup" }
+func (c *cgroupCollector) Interval() time.Duration { return 2 * time.Second }
+
+func (c *cgroupCollector) Collect(ctx context.Context) ([]Metric, error) {
+	now := time.Now()
+	cs := &ContainerStats{
+		InContainer: c.container,
+		Runtime:     c.runtime,
+		Cgroup:      strings.TrimPrefix(c.dir, c.root),
+	}
+	if cs.Cgroup == "" {
+		cs.Cgroup = "/"
+	}
+
+	// cpu.stat is always present; the other files depend on which
+	// controllers are enabled for this cgroup
+	cpuStat, err := readKeyValues(filepath.Join(c.dir, "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	cs.CPUUsageSeconds = float64(cpuStat["usage_usec"]) / 1e6
+	cs.Periods = cpuStat["nr_periods"]
+	cs.ThrottledPeriods = cpuStat["nr_throttled"]
+	cs.ThrottledSeconds = float64(cpuStat["throttled_usec"]) / 1e6
+	cs.CPUQuotaCores = readCPUMax(filepath.Join(c.dir, "cpu.max"))
+
+	cs.MemoryUsed = readCgroupValue(filepath.Join(c.dir, "memory.current"))
+	cs.MemoryLimit = readCgroupValue(filepath.Join(c.dir, "memory.max"))
+	cs.SwapUsed = readCgroupValue(filepath.Join(c.dir, "memory.swap.current"))
+	if events, err := readKeyValues(filepath.Join(c.dir, "memory.events")); err == nil {
+		cs.OOMKills = events["oom_kill"]
+	}
+	if cs.MemoryLimit > 0 {
+		cs.MemoryPercent = float64(cs.MemoryUsed) / float64(cs.MemoryLimit) * 100
+	}
+	cs.PIDs = readCgroupValue(filepath.Join(c.dir, "pids.current"))
+	cs.PIDsLimit = readCgroupValue(filepath.Join(c.dir, "pids.max"))
+
+	c.mu.Lock()
+	if elapsed := sinceLast(c.lastTime, now); elapsed > 0 && cs.CPUUsageSeconds >= c.lastUsage {
+		cores := cs.CPUQuotaCores
+		if cores == 0 {
+			cores = float64(runtime.NumCPU())
+		}
+		cs.CPUPercent = (cs.CPUUsageSeconds - c.lastUsage) / elapsed / cores * 100
+	}
+	c.lastUsage, c.lastTime = cs.CPUUsageSeconds, now
+	c.stats = cs
+	c.mu.Unlock()
+
+	return []Metric{
+		{Name: "container_cpu_percent", Value: cs.CPUPercent},
+		{Name: "container_memory_used_bytes", Value: float64(cs.MemoryUsed)},
+		{Name: "container_pids", Value: float64(cs.PIDs)},
+	}, nil
+}
+
+func (c *cgroupCollector) apply(stats *SystemStats) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stats.Container = c.stats
+}
+
+// readCgroupValue reads a single-number cgroup file; "max" and missing
+// files (controller not enabled) read as 0, meaning unlimited or unknown
+func readCgroupValue(path string) uint64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	value, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	return value
+}
+
+// readCPUMax converts cpu.max ("$QUOTA $PERIOD" or "max $PERIOD") to cores
+func readCPUMax(path string) float64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0
+	}
+	quota, err1 := strconv.ParseFloat(fields[0], 64)
+	period, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil || period == 0 {
+		return 0
+	}
+	return quota / period
+}
+
+// readKeyValues parses flat keyed files such as cpu.stat and memory.events
+func readKeyValues(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				values[fields[0]] = v
+			}
+		}
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCgroupFiles creates a fake cgroup v2 tree below root
+func writeCgroupFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadCPUMax(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		content string // "" leaves the file missing
+		want    float64
+	}{
+		{"max 100000\n", 0},
+		{"150000 100000\n", 1.5},
+		{"50000 100000\n", 0.5},
+		{"200000 0\n", 0},
+		{"100000\n", 0},
+		{"lots 100000\n", 0},
+		{"", 0},
+	}
+	for i, c := range cases {
+		path := filepath.Join(dir, "cpu.max")
+		os.Remove(path)
+		if c.content != "" {
+			writeCgroupFiles(t, dir, map[string]string{"cpu.max": c.content})
+		}
+		if got := readCPUMax(path); got != c.want {
+			t.Fatalf("case %d: readCPUMax(%q)=%v want %v", i, c.content, got, c.want)
+		}
+	}
+}
+
+func TestReadKeyValues(t *testing.T) {
+	dir := t.TempDir()
+	writeCgroupFiles(t, dir, map[string]string{
+		"cpu.stat": "usage_usec 2500000\nuser_usec 2000000\nnr_periods 40\nnr_throttled 3\nthrottled_usec 150000\nbroken\nnegative -1\n",
+	})
+
+	values, err := readKeyValues(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]uint64{"usage_usec": 2500000, "user_usec": 2000000, "nr_periods": 40, "nr_throttled": 3, "throttled_usec": 150000}
+	if len(values) != len(want) {
+		t.Fatalf("readKeyValues=%v want %v", values, want)
+	}
+	for key, v := range want {
+		if values[key] != v {
+			t.Fatalf("%s=%d want %d", key, values[key], v)
+		}
+	}
+
+	if _, err := readKeyValues(filepath.Join(dir, "memory.events")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("missing file err=%v want not exist", err)
+	}
+}
+
+func TestOwnCgroup(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		content string // "" leaves the file missing
+		want    string
+		ok      bool
+	}{
+		{"0::/system.slice/monitor.service\n", "/system.slice/monitor.service", true},
+		{"0::/\n", "/", true},
+		// A hybrid host lists the v1 controllers first
+		{"12:memory:/user.slice\n1:name=systemd:/user.slice\n0::/user.slice/session-2.scope\n", "/user.slice/session-2.scope", true},
+		{"12:memory:/docker/abc\n", "", false},
+		{"", "", false},
+	}
+	for i, c := range cases {
+		path := filepath.Join(dir, "cgroup")
+		os.Remove(path)
+		if c.content != "" {
+			writeCgroupFiles(t, dir, map[string]string{"cgroup": c.content})
+		}
+		got, err := ownCgroup(path)
+		if got != c.want || (err == nil) != c.ok {
+			t.Fatalf("case %d: ownCgroup=%q, %v want %q ok=%v", i, got, err, c.want, c.ok)
+		}
+	}
+}
+
+func TestCgroupCollect(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers":           "cpu memory pids\n",
+		"app.slice/cpu.stat":           "usage_usec 4000000\nnr_periods 10\nnr_throttled 2\nthrottled_usec 500000\n",
+		"app.slice/cpu.max":            "200000 100000\n",
+		"app.slice/memory.current":     "268435456\n",
+		"app.slice/memory.max":         "1073741824\n",
+		"app.slice/memory.events":      "low 0\nhigh 0\nmax 4\noom 1\noom_kill 1\n",
+		"app.slice/pids.current":       "12\n",
+		"app.slice/pids.max":           "max\n",
+		"unlimited.slice/cpu.stat":     "usage_usec 1000\n",
+		"unlimited.slice/cpu.max":      "max 100000\n",
+		"unlimited.slice/memory.max":   "max\n",
+		"unlimited.slice/pids.current": "3\n",
+	})
+
+	c := &cgroupCollector{root: root, dir: filepath.Join(root, "app.slice")}
+	if _, err := c.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cs := c.stats
+	if cs.Cgroup != "/app.slice" || cs.CPUQuotaCores != 2 || cs.CPUUsageSeconds != 4 || cs.ThrottledPeriods != 2 || cs.ThrottledSeconds != 0.5 {
+		t.Fatalf("cpu=%+v", cs)
+	}
+	if cs.MemoryLimit != 1<<30 || cs.MemoryPercent != 25 || cs.OOMKills != 1 || cs.PIDs != 12 || cs.PIDsLimit != 0 {
+		t.Fatalf("memory and pids=%+v", cs)
+	}
+
+	// Controllers that aren't enabled read as unlimited
+	c = &cgroupCollector{root: root, dir: filepath.Join(root, "unlimited.slice")}
+	if _, err := c.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if cs := c.stats; cs.CPUQuotaCores != 0 || cs.MemoryUsed != 0 || cs.MemoryLimit != 0 || cs.MemoryPercent != 0 || cs.PIDs != 3 {
+		t.Fatalf("unlimited=%+v", cs)
+	}
+
+	// Without cpu.stat there is nothing to report
+	c = &cgroupCollector{root: root, dir: filepath.Join(root, "missing.slice")}
+	if _, err := c.Collect(context.Background()); err == nil {
+		t.Fatal("Collect without cpu.stat succeeded")
+	}
+	if newCgroupCollector(t.TempDir()) != nil {
+		t.Fatal("collector created without cgroup.controllers")
+	}
+}
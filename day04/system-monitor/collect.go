@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// PartitionStats represents usage of a single mounted filesystem
+type PartitionStats struct {
+	Device      string  `json:"device"`
+	Mountpoint  string  `json:"mountpoint"`
+	Fstype      string  `json:"fstype"`
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	Free        uint64  `json:"free"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// NetworkStats represents throughput of a single network interface
+type NetworkStats struct {
+	Interface   string  `json:"interface"`
+	BytesSent   uint64  `json:"bytes_sent"`
+	BytesRecv   uint64  `json:"bytes_recv"`
+	PacketsSent uint64  `json:"packets_sent"`
+	PacketsRecv uint64  `json:"packets_recv"`
+	Errors      uint64  `json:"errors"`
+	Drops       uint64  `json:"drops"`
+	RxBytesPS   float64 `json:"rx_bytes_per_sec"`
+	TxBytesPS   float64 `json:"tx_bytes_per_sec"`
+}
+
+// DiskIOStats represents read/write activity of a single block device
+type DiskIOStats struct {
+	Device       string  `json:"device"`
+	ReadIOPS     float64 `json:"read_iops"`
+	WriteIOPS    float64 `json:"write_iops"`
+	ReadBytesPS  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPS float64 `json:"write_bytes_per_sec"`
+}
+
+// builtinCollectors names the collectors whose readings are already
+// exposed through the typed SystemStats fields
+var builtinCollectors = map[string]bool{
+	"cpu": true, "memory": true, "disk": true, "diskio": true,
+	"network": true, "load": true, "processes": true, "cgroup": true,
+	"logs": true,
+}
+
+// newSystemCollector creates the named built-in collector that reads
+// the system directly; the monitor owns the processes, cgroup and logs ones
+func newSystemCollector(name string, sources Sources, cpuWindow time.Duration) Collector {
+	switch name {
+	case "cpu":
+		return &cpuCollector{source: sources.CPU, window: cpuWindow}
+	case "memory":
+		return &memoryCollector{source: sources.Memory}
+	case "disk":
+		return &diskCollector{source: sources.Disk}
+	case "diskio":
+		return &diskIOCollector{source: sources.Disk}
+	case "network":
+		return &networkCollector{}
+	case "load":
+		return &loadCollector{}
+	}
+	return nil
+}
+
+// cpuCollector samples aggregate and per-core CPU usage over a window
+type cpuCollector struct {
+	source CPUSource
+	window time.Duration
+
+	mu      sync.RWMutex
+	percent float64
+	perCore []float64
+}
+
+func (c *cpuCollector) Name() string { return "cpu" }
+
+// Interval leaves a second between samples, so 2s for the default window
+func (c *cpuCollector) Interval() time.Duration { return c.window + time.Second }
+
+func (c *cpuCollector) Collect(ctx context.Context) ([]Metric, error) {
+	// The aggregate is the mean across cores so one sample serves both
+	perCore, err := c.source.PerCore(ctx, c.window)
+	if err != nil {
+		return nil, err
+	}
+	percent := average(perCore)
+
+	c.mu.Lock()
+	c.percent, c.perCore = percent, perCore
+	c.mu.Unlock()
+
+	metrics := []Metric{{Name: "cpu_percent", Value: percent}}
+	for i, pct := range perCore {
+		metrics = append(metrics, Metric{Name: "cpu_core_percent", Value: pct, Labels: map[string]string{"core": strconv.Itoa(i)}})
+	}
+	return metrics, nil
+}
+
+func (c *cpuCollector) apply(stats *SystemStats) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stats.CPUPercent = c.percent
+	stats.CPUPerCore = c.perCore
+}
+
+// memoryCollector reads physical memory and swap usage
+type memoryCollector struct {
+	source MemorySource
+
+	mu   sync.RWMutex
+	vm   mem.VirtualMemoryStat
+	swap mem.SwapMemoryStat
+}
+
+func (c *memoryCollector) Name() string            { return "memory" }
+func (c *memoryCollector) Interval() time.Duration { return 2 * time.Second }
+
+func (c *memoryCollector) Collect(ctx context.Context) ([]Metric, error) {
+	vm, err := c.source.Virtual(ctx)
+	if err != nil {
+		return nil, err
+	}
+	swap, err := c.source.Swap(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.vm, c.swap = *vm, *swap
+	c.mu.Unlock()
+
+	return []Metric{
+		{Name: "memory_total_bytes", Value: float64(vm.Total)},
+		{Name: "memory_used_bytes", Value: float64(vm.Used)},
+		{Name: "memory_percent", Value: vm.UsedPercent},
+		{Name: "swap_total_bytes", Value: float64(swap.Total)},
+		{Name: "swap_used_bytes", Value: float64(swap.Used)},
+		{Name: "swap_percent", Value: swap.UsedPercent},
+	}, nil
+}
+
+func (c *memoryCollector) apply(stats *SystemStats) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stats.MemoryTotal = c.vm.Total
+	stats.MemoryUsed = c.vm.Used
+	stats.MemoryPercent = c.vm.UsedPercent
+	stats.SwapTotal = c.swap.Total
+	stats.SwapUsed = c.swap.Used
+	stats.SwapPercent = c.swap.UsedPercent
+}
+
+// diskCollector reads usage of the root filesystem and every mounted partition
+type diskCollector struct {
+	source DiskSource
+
+	mu         sync.RWMutex
+	root       disk.UsageStat
+	partitions []PartitionStats
+}
+
+func (c *diskCollector) Name() string            { return "disk" }
+func (c *diskCollector) Interval() time.Duration { return 10 * time.Second }
+
+func (c *diskCollector) Collect(ctx context.Context) ([]Metric, error) {
+	root, err := c.source.Usage(ctx, "/")
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := collectPartitions(ctx, c.source)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.root, c.partitions = *root, partitions
+	c.mu.Unlock()
+
+	metrics := []Metric{
+		{Name: "disk_total_bytes", Value: float64(root.Total)},
+		{Name: "disk_used_bytes", Value: float64(root.Used)},
+		{Name: "disk_percent", Value: root.UsedPercent},
+	}
+	for _, p := range partitions {
+		metrics = append(metrics, Metric{Name: "filesystem_percent", Value: p.UsedPercent, Labels: map[string]string{"mountpoint": p.Mountpoint}})
+	}
+	return metrics, nil
+}
+
+func (c *diskCollector) apply(stats *SystemStats) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stats.DiskTotal = c.root.Total
+	stats.DiskUsed = c.root.Used
+	stats.DiskFree = c.root.Free
+	stats.DiskPercent = c.root.UsedPercent
+	stats.Partitions = c.partitions
+}
+
+// collectPartitions returns usage for every mounted physical partition
+func collectPartitions(ctx context.Context, source DiskSource) ([]PartitionStats, error) {
+	partitions, err := source.Partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]PartitionStats, 0, len(partitions))
+	seen := make(map[string]bool)
+	for _, part := range partitions {
+		if seen[part.Mountpoint] {
+			continue
+		}
+		seen[part.Mountpoint] = true
+
+		// Unreadable mounts (e.g. permission denied) are skipped, not fatal
+		usage, err := source.Usage(ctx, part.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+		result = append(result, PartitionStats{
+			Device:      part.Device,
+			Mountpoint:  part.Mountpoint,
+			Fstype:      part.Fstype,
+			Total:       usage.Total,
+			Used:        usage.Used,
+			Free:        usage.Free,
+			UsedPercent: usage.UsedPercent,
+		})
+	}
+	return result, nil
+}
+
+// diskIOCollector turns cumulative block device counters into rates
+type diskIOCollector struct {
+	source DiskSource
+
+	mu       sync.RWMutex
+	stats    []DiskIOStats
+	last     map[string]disk.IOCountersStat
+	lastTime time.Time
+}
+
+func (c *diskIOCollector) Name() string            { return "diskio" }
+func (c *diskIOCollector) Interval() time.Duration { return 2 * time.Second }
+
+func (c *diskIOCollector) Collect(ctx context.Context) ([]Metric, error) {
+	counters, err := c.source.IOCounters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := sinceLast(c.lastTime, now)
+	stats := make([]DiskIOStats, 0, len(counters))
+	var metrics []Metric
+	for name, cur := range counters {
+		ds := DiskIOStats{Device: name}
+		if prev, ok := c.last[name]; ok {
+			ds.ReadIOPS = perSecond(prev.ReadCount, cur.ReadCount, elapsed)
+			ds.WriteIOPS = perSecond(prev.WriteCount, cur.WriteCount, elapsed)
+			ds.ReadBytesPS = perSecond(prev.ReadBytes, cur.ReadBytes, elapsed)
+			ds.WriteBytesPS = perSecond(prev.WriteBytes, cur.WriteBytes, elapsed)
+		}
+		stats = append(stats, ds)
+
+		labels := map[string]string{"device": name}
+		metrics = append(metrics,
+			Metric{Name: "disk_read_bytes_per_second", Value: ds.ReadBytesPS, Labels: labels},
+			Metric{Name: "disk_write_bytes_per_second", Value: ds.WriteBytesPS, Labels: labels})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Device < stats[j].Device })
+
+	c.stats, c.last, c.lastTime = stats, counters, now
+	return metrics, nil
+}
+
+func (c *diskIOCollector) apply(stats *SystemStats) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stats.DiskIO = c.stats
+}
+
+// networkCollector turns cumulative interface counters into rates
+type networkCollector struct {
+	mu       sync.RWMutex
+	stats    []NetworkStats
+	last     map[string]net.IOCountersStat
+	lastTime time.Time
+}
+
+func (c *networkCollector) Name() string            { return "network" }
+func (c *networkCollector) Interval() time.Duration { return 2 * time.Second }
+
+func (c *networkCollector) Collect(ctx context.Context) ([]Metric, error) {
+	counters, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := sinceLast(c.lastTime, now)
+	stats := make([]NetworkStats, 0, len(counters))
+	last := make(map[string]net.IOCountersStat, len(counters))
+	var metrics []Metric
+	for _, cur := range counters {
+		ns := NetworkStats{
+			Interface:   cur.Name,
+			BytesSent:   cur.BytesSent,
+			BytesRecv:   cur.BytesRecv,
+			PacketsSent: cur.PacketsSent,
+			PacketsRecv: cur.PacketsRecv,
+			Errors:      cur.Errin + cur.Errout,
+			Drops:       cur.Dropin + cur.Dropout,
+		}
+		if prev, ok := c.last[cur.Name]; ok {
+			ns.RxBytesPS = perSecond(prev.BytesRecv, cur.BytesRecv, elapsed)
+			ns.TxBytesPS = perSecond(prev.BytesSent, cur.BytesSent, elapsed)
+		}
+		last[cur.Name] = cur
+		stats = append(stats, ns)
+
+		labels := map[string]string{"interface": cur.Name}
+		metrics = append(metrics,
+			Metric{Name: "network_receive_bytes_per_second", Value: ns.RxBytesPS, Labels: labels},
+			Metric{Name: "network_transmit_bytes_per_second", Value: ns.TxBytesPS, Labels: labels})
+	}
+
+	c.stats, c.last, c.lastTime = stats, last, now
+	return metrics, nil
+}
+
+func (c *networkCollector) apply(stats *SystemStats) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stats.Network = c.stats
+}
+
+// loadCollector reads the 1, 5 and 15 minute load averages
+type loadCollector struct {
+	mu  sync.RWMutex
+	avg load.AvgStat
+}
+
+func (c *loadCollector) Name() string            { return "load" }
+func (c *loadCollector) Interval() time.Duration { return 2 * time.Second }
+
+func (c *loadCollector) Collect(ctx context.Context) ([]Metric, error) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.avg = *avg
+	c.mu.Unlock()
+
+	return []Metric{
+		{Name: "load1", Value: avg.Load1},
+		{Name: "load5", Value: avg.Load5},
+		{Name: "load15", Value: avg.Load15},
+	}, nil
+}
+
+func (c *loadCollector) apply(stats *SystemStats) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stats.Load1 = c.avg.Load1
+	stats.Load5 = c.avg.Load5
+	stats.Load15 = c.avg.Load15
+}
+
+// sinceLast returns the seconds between two samples, or 0 for the first one
+func sinceLast(last, now time.Time) float64 {
+	if last.IsZero() {
+		return 0
+	}
+	return now.Sub(last).Seconds()
+}
+
+// perSecond returns the rate between two counter readings, treating a
+// counter reset (e.g. interface re-created) as no activity
+func perSecond(prev, cur uint64, elapsed float64) float64 {
+	if elapsed <= 0 || cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / elapsed
+}
+
+// average returns the mean of the given values
+func average(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
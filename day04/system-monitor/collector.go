@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metric is a single named reading produced by a collector
+type Metric struct {
+	Name   string            `json:"name"`
+	Value  float64           `json:"value"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Collector gathers one group of metrics on its own schedule.
+// Implementations are registered with a Registry, which runs each
+// collector in its own goroutine so a slow one never stalls the rest.
+type Collector interface {
+	// Name identifies the collector in the API and in error reports
+	Name() string
+	// Interval is how often Collect is called
+	Interval() time.Duration
+	// Collect takes one reading; ctx is cancelled once Interval elapses
+	Collect(ctx context.Context) ([]Metric, error)
+}
+
+// statsApplier is implemented by the built-in collectors that fill in
+// the typed SystemStats fields from their latest successful reading
+type statsApplier interface {
+	apply(stats *SystemStats)
+}
+
+// CollectorStatus reports the health of a registered collector
+type CollectorStatus struct {
+	Name       string    `json:"name"`
+	Interval   string    `json:"interval"`
+	LastRun    time.Time `json:"last_run"`
+	LastOK     time.Time `json:"last_ok"`
+	DurationMS float64   `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+	Metrics    []Metric  `json:"metrics"`
+}
+
+// collectorState holds the latest result of a single collector
+type collectorState struct {
+	collector Collector
+	cancel    context.CancelFunc // stops loop; set once running
+	done      chan struct{}      // closed once loop has returned
+
+	mu       sync.RWMutex
+	metrics  []Metric
+	err      error
+	lastRun  time.Time
+	lastOK   time.Time
+	duration time.Duration
+}
+
+// run calls Collect once and records the outcome
+func (cs *collectorState) run(parent context.Context) {
+	ctx, cancel := context.WithTimeout(parent, cs.collector.Interval())
+	defer cancel()
+
+	start := time.Now()
+	metrics, err := cs.collector.Collect(ctx)
+	elapsed := time.Since(start)
+	if err != nil && parent.Err() != nil {
+		return // stopped mid-reading, which isn't a failure
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err != nil && cs.err == nil {
+		log.Printf("Collector %s failed: %v", cs.collector.Name(), err)
+	}
+	cs.err = err
+	cs.lastRun = start
+	cs.duration = elapsed
+	if err == nil {
+		cs.metrics = metrics
+		cs.lastOK = start
+	}
+}
+
+// loop runs the collector immediately and then on every interval
+func (cs *collectorState) loop(ctx context.Context) {
+	ticker := time.NewTicker(cs.collector.Interval())
+	defer ticker.Stop()
+
+	cs.run(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cs.run(ctx)
+		}
+	}
+}
+
+// Registry holds the registered collectors and their latest results
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []*collectorState
+	byName     map[string]*collectorState
+	ctx        context.Context // set once Start is called
+	running    sync.WaitGroup
+}
+
+// NewRegistry creates an empty collector registry
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*collectorState)}
+}
+
+// Register adds a collector; collectors registered after Start begin
+// running immediately
+func (r *Registry) Register(c Collector) error {
+	if c.Interval() <= 0 {
+		return fmt.Errorf("collector %s: interval must be positive", c.Name())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.byName[c.Name()]; exists {
+		return fmt.Errorf("collector %s already registered", c.Name())
+	}
+	cs := &collectorState{collector: c}
+	r.collectors = append(r.collectors, cs)
+	r.byName[c.Name()] = cs
+
+	if r.ctx != nil {
+		r.start(cs)
+	}
+	return nil
+}
+
+// Unregister stops and removes a collector, reporting whether it existed.
+// It returns once any Collect call in progress has finished, so a
+// replacement registered under the same name never runs alongside it.
+func (r *Registry) Unregister(name string) bool {
+	cs := r.remove(name)
+	if cs == nil {
+		return false
+	}
+	if cs.cancel != nil {
+		cs.cancel()
+		<-cs.done
+	}
+	return true
+}
+
+// remove takes a collector out of the registry, returning nil if it
+// wasn't registered
+func (r *Registry) remove(name string) *collectorState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cs, exists := r.byName[name]
+	if !exists {
+		return nil
+	}
+	delete(r.byName, name)
+	for i, other := range r.collectors {
+		if other == cs {
+			r.collectors = append(r.collectors[:i], r.collectors[i+1:]...)
+			break
+		}
+	}
+	return cs
+}
+
+// Registered reports whether a collector with this name is registered
+func (r *Registry) Registered(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, exists := r.byName[name]
+	return exists
+}
+
+// Start runs every registered collector until ctx is cancelled
+func (r *Registry) Start(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ctx = ctx
+	for _, cs := range r.collectors {
+		r.start(cs)
+	}
+}
+
+// start runs a collector until the registry stops or it is unregistered
+func (r *Registry) start(cs *collectorState) {
+	if r.ctx.Err() != nil {
+		return // shutting down
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	cs.cancel, cs.done = cancel, make(chan struct{})
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		defer close(cs.done)
+		cs.loop(ctx)
+	}()
+}
+
+// Wait blocks until every collector has stopped after the context given
+// to Start was cancelled, including any Collect call in progress
+func (r *Registry) Wait() {
+	r.running.Wait()
+}
+
+// snapshot fills stats from the latest reading of every collector
+// without waiting on any of them
+func (r *Registry) snapshot(stats *SystemStats) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, cs := range r.collectors {
+		cs.mu.RLock()
+		if cs.err != nil {
+			if stats.Errors == nil {
+				stats.Errors = make(map[string]string)
+			}
+			stats.Errors[cs.collector.Name()] = cs.err.Error()
+		}
+		if applier, ok := cs.collector.(statsApplier); ok {
+			applier.apply(stats)
+		} else {
+			stats.Metrics = append(stats.Metrics, cs.metrics...)
+		}
+		cs.mu.RUnlock()
+	}
+}
+
+// Status returns the state of every collector, sorted by name
+func (r *Registry) Status() []CollectorStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make([]CollectorStatus, 0, len(r.collectors))
+	for _, cs := range r.collectors {
+		cs.mu.RLock()
+		status := CollectorStatus{
+			Name:       cs.collector.Name(),
+			Interval:   cs.collector.Interval().String(),
+			LastRun:    cs.lastRun,
+			LastOK:     cs.lastOK,
+			DurationMS: float64(cs.duration.Microseconds()) / 1000,
+			Metrics:    append([]Metric{}, cs.metrics...),
+		}
+		if cs.err != nil {
+			status.Error = cs.err.Error()
+		}
+		cs.mu.RUnlock()
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func (m *Monitor) handleCollectors(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(m.registry.Status())
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// blockingCollector stays in Collect until released, whatever its
+// context says
+type blockingCollector struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingCollector) Name() string            { return "blocking" }
+func (c *blockingCollector) Interval() time.Duration { return time.Minute }
+
+func (c *blockingCollector) Collect(ctx context.Context) ([]Metric, error) {
+	c.entered <- struct{}{}
+	<-c.release
+	return nil, nil
+}
+
+func TestUnregisterWaitsForCollect(t *testing.T) {
+	r := NewRegistry()
+	c := &blockingCollector{entered: make(chan struct{}), release: make(chan struct{})}
+	if err := r.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Start(ctx)
+	<-c.entered
+
+	unregistered := make(chan bool)
+	go func() { unregistered <- r.Unregister("blocking") }()
+	select {
+	case <-unregistered:
+		t.Fatal("Unregister returned while Collect was still running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if r.Registered("blocking") {
+		t.Fatal("collector still registered while stopping")
+	}
+
+	close(c.release)
+	if !<-unregistered {
+		t.Fatal("Unregister reported the collector missing")
+	}
+	if r.Unregister("blocking") {
+		t.Fatal("second Unregister found the collector")
+	}
+	// Registering a replacement under the same name works straight away
+	replacement := &blockingCollector{entered: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(replacement.release)
+	if err := r.Register(replacement); err != nil {
+		t.Fatal(err)
+	}
+}
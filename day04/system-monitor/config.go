@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the standalone monitor's settings. They come from the
+// defaults, then the YAML config file, then command-line flags; the
+// file is re-read on SIGHUP.
+type Config struct {
+	// Listen is the address to serve on; changing it needs a restart
+	Listen string `yaml:"listen"`
+	// SampleInterval is how often a sample is stored and broadcast
+	SampleInterval time.Duration `yaml:"sample_interval"`
+	// Retention is how far back the in-memory history goes
+	Retention time.Duration `yaml:"retention"`
+	// HistoryLimit is the default number of samples the history API returns
+	HistoryLimit int `yaml:"history_limit"`
+	// CPUWindow is how long each CPU usage reading is measured over
+	CPUWindow time.Duration `yaml:"cpu_window"`
+	// Collectors lists the built-in collectors to run; empty means all
+	Collectors []string `yaml:"collectors"`
+	// LogFormat is "text" or "json"
+	LogFormat string `yaml:"log_format"`
+	// Logs are the files to follow and the patterns to count in them
+	Logs []LogTailConfig `yaml:"logs"`
+	// Probes are synthetic checks of services on or near the host
+	Probes []ProbeConfig `yaml:"probes"`
+	// HistoryFile, if set, keeps the history across restarts: it is read
+	// at startup and written on shutdown. Changing it needs a restart.
+	HistoryFile string `yaml:"history_file"`
+}
+
+// defaultHistoryLimit is the number of samples the history APIs return
+// when no limit is given
+const defaultHistoryLimit = 50
+
+// defaultRetention keeps the 100 samples the monitor has always held at
+// the default interval; longer history is opt-in through retention
+const defaultRetention = 100 * 2 * time.Second
+
+// defaultConfig returns the built-in settings; PORT still sets the
+// listen address for backwards compatibility
+func defaultConfig() Config {
+	listen := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		listen = ":" + port
+	}
+	return Config{
+		Listen:         listen,
+		SampleInterval: 2 * time.Second,
+		Retention:      defaultRetention,
+		HistoryLimit:   defaultHistoryLimit,
+		CPUWindow:      time.Second,
+		LogFormat:      "text",
+	}
+}
+
+// maxSamples is the number of samples kept to cover Retention
+func (c Config) maxSamples() int {
+	return int(c.Retention / c.SampleInterval)
+}
+
+// enabled reports whether the named built-in collector should run
+func (c Config) enabled(name string) bool {
+	if len(c.Collectors) == 0 {
+		return true
+	}
+	for _, enabled := range c.Collectors {
+		if enabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) validate() error {
+	switch {
+	case c.Listen == "":
+		return fmt.Errorf("listen address must not be empty")
+	case c.SampleInterval < 100*time.Millisecond:
+		return fmt.Errorf("sample_interval must be at least 100ms")
+	case c.Retention < c.SampleInterval:
+		return fmt.Errorf("retention must be at least one sample_interval")
+	case c.HistoryLimit <= 0:
+		return fmt.Errorf("history_limit must be positive")
+	case c.CPUWindow < 10*time.Millisecond:
+		return fmt.Errorf("cpu_window must be at least 10ms")
+	case c.LogFormat != "text" && c.LogFormat != "json":
+		return fmt.Errorf("log_format must be text or json")
+	}
+	for _, name := range c.Collectors {
+		if !builtinCollectors[name] {
+			return fmt.Errorf("unknown collector %q (have %s)", name, strings.Join(builtinCollectorNames(), ", "))
+		}
+	}
+	if err := validateLogs(c.Logs); err != nil {
+		return err
+	}
+	return validateProbes(c.Probes)
+}
+
+// builtinCollectorNames lists the built-in collectors in name order
+func builtinCollectorNames() []string {
+	names := make([]string, 0, len(builtinCollectors))
+	for name := range builtinCollectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configLoader builds the effective config from the file and flags, and
+// can do so again on reload with the same flags
+type configLoader struct {
+	path string
+	// overrides apply the flags given on the command line
+	overrides []func(*Config)
+}
+
+// newConfigLoader parses the standalone flags
+func newConfigLoader(args []string) *configLoader {
+	fs := flag.NewFlagSet("standalone", flag.ExitOnError)
+	l := &configLoader{}
+	defaults := defaultConfig()
+
+	fs.StringVar(&l.path, "config", os.Getenv("SYSMON_CONFIG"), "YAML config file, re-read on SIGHUP")
+	listen := fs.String("listen", defaults.Listen, "address to serve on")
+	sampleInterval := fs.Duration("sample-interval", defaults.SampleInterval, "how often to take a sample")
+	retention := fs.Duration("retention", defaults.Retention, "how much history to keep in memory")
+	historyLimit := fs.Int("history-limit", defaults.HistoryLimit, "default number of samples returned by the history API")
+	cpuWindow := fs.Duration("cpu-window", defaults.CPUWindow, "how long each CPU reading is measured over")
+	collectors := fs.String("collectors", "", "comma separated built-in collectors to run (default all)")
+	logFormat := fs.String("log-format", defaults.LogFormat, "log format: text or json")
+	historyFile := fs.String("history-file", "", "file to keep the history in across restarts")
+	fs.Parse(args)
+
+	// Only flags given explicitly override the config file
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			l.overrides = append(l.overrides, func(c *Config) { c.Listen = *listen })
+		case "sample-interval":
+			l.overrides = append(l.overrides, func(c *Config) { c.SampleInterval = *sampleInterval })
+		case "retention":
+			l.overrides = append(l.overrides, func(c *Config) { c.Retention = *retention })
+		case "history-limit":
+			l.overrides = append(l.overrides, func(c *Config) { c.HistoryLimit = *historyLimit })
+		case "cpu-window":
+			l.overrides = append(l.overrides, func(c *Config) { c.CPUWindow = *cpuWindow })
+		case "collectors":
+			l.overrides = append(l.overrides, func(c *Config) { c.Collectors = splitList(*collectors) })
+		case "log-format":
+			l.overrides = append(l.overrides, func(c *Config) { c.LogFormat = *logFormat })
+		case "history-file":
+			l.overrides = append(l.overrides, func(c *Config) { c.HistoryFile = *historyFile })
+		}
+	})
+	return l
+}
+
+// load reads the config file (if any), applies the flags and validates
+func (l *configLoader) load() (Config, error) {
+	cfg := defaultConfig()
+	if l.path != "" {
+		data, err := os.ReadFile(l.path)
+		if err != nil {
+			return cfg, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && err != io.EOF {
+			return cfg, fmt.Errorf("%s: %v", l.path, err)
+		}
+	}
+	for _, override := range l.overrides {
+		override(&cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("invalid config: %v", err)
+	}
+	return cfg, nil
+}
+
+// jsonLogWriter turns each log line into a JSON object
+type jsonLogWriter struct {
+	out io.Writer
+}
+
+func (w jsonLogWriter) Write(p []byte) (int, error) {
+	line, _ := json.Marshal(map[string]string{
+		"time": time.Now().UTC().Format(time.RFC3339Nano),
+		"msg":  strings.TrimSuffix(string(p), "\n"),
+	})
+	if _, err := w.out.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// setLogFormat switches the standard logger between text and JSON lines
+func setLogFormat(format string) {
+	if format == "json" {
+		log.SetFlags(0)
+		log.SetOutput(jsonLogWriter{out: os.Stderr})
+		return
+	}
+	log.SetFlags(log.LstdFlags)
+	log.SetOutput(os.Stderr)
+}
+
+// applyConfig puts cfg into effect. Connected WebSocket clients are kept;
+// only the listen address needs a restart to change. A collector that
+// fails to register is reported and the rest of cfg still applied.
+func (m *Monitor) applyConfig(cfg Config) error {
+	m.statsMu.Lock()
+	intervalChanged := cfg.SampleInterval != m.sampleInterval
+	cpuWindowChanged := cfg.CPUWindow != m.cpuWindow
+	logsChanged := !reflect.DeepEqual(cfg.Logs, m.logConfig)
+	m.logConfig = cfg.Logs
+	m.maxSamples = cfg.maxSamples()
+	m.historyLimit = cfg.HistoryLimit
+	m.sampleInterval = cfg.SampleInterval
+	m.cpuWindow = cfg.CPUWindow
+	if len(m.stats) > m.maxSamples {
+		m.stats = m.stats[len(m.stats)-m.maxSamples:]
+	}
+	m.statsMu.Unlock()
+
+	if intervalChanged {
+		m.hub.setSampleInterval(cfg.SampleInterval)
+		select {
+		case m.reconfigured <- struct{}{}:
+		default:
+		}
+	}
+
+	var errs []error
+	for _, name := range builtinCollectorNames() {
+		registered := m.registry.Registered(name)
+		changed := (name == "cpu" && cpuWindowChanged) || (name == "logs" && logsChanged)
+		if registered && (!cfg.enabled(name) || changed) {
+			m.registry.Unregister(name)
+			registered = false
+			if name == "logs" {
+				m.logTail.stop()
+				m.logTail = nil
+			}
+		}
+		if registered || !cfg.enabled(name) {
+			continue
+		}
+
+		var c Collector
+		switch name {
+		case "processes":
+			c = m.processes
+		case "cgroup":
+			if cgroup := newCgroupCollector(cgroupRoot); cgroup != nil {
+				c = cgroup
+			}
+		case "logs":
+			if len(cfg.Logs) > 0 {
+				m.logTail = newLogTailCollector(cfg.Logs, m.hub.publishLog)
+				c = m.logTail
+			}
+		default:
+			c = newSystemCollector(name, m.sources, cfg.CPUWindow)
+		}
+		if c != nil {
+			if err := m.registry.Register(c); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if err := m.applyProbes(cfg.Probes); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
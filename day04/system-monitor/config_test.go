@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	file := write("sysmon.yaml", "sample_interval: 5s\nretention: 10m\ncollectors: [cpu, memory]\nlog_format: json\n")
+	empty := write("empty.yaml", "")
+
+	cases := []struct {
+		args    []string
+		check   func(c Config) bool
+		wantErr string
+	}{
+		{nil, func(c Config) bool { return c.SampleInterval == 2*time.Second && c.maxSamples() == 100 }, ""},
+		{[]string{"-config", empty}, func(c Config) bool { return c.HistoryLimit == defaultHistoryLimit }, ""},
+		{[]string{"-config", file}, func(c Config) bool {
+			return c.SampleInterval == 5*time.Second && c.maxSamples() == 120 &&
+				reflect.DeepEqual(c.Collectors, []string{"cpu", "memory"}) && c.LogFormat == "json"
+		}, ""},
+		// Flags given explicitly win over the file
+		{[]string{"-config", file, "-sample-interval", "1s", "-collectors", "load"}, func(c Config) bool {
+			return c.SampleInterval == time.Second && c.Retention == 10*time.Minute &&
+				reflect.DeepEqual(c.Collectors, []string{"load"})
+		}, ""},
+		{[]string{"-history-limit", "0"}, nil, "history_limit"},
+		{[]string{"-collectors", "cpu,gpu"}, nil, `unknown collector "gpu"`},
+		{[]string{"-retention", "1s"}, nil, "retention"},
+		{[]string{"-config", write("typo.yaml", "sample_intervall: 5s\n")}, nil, "sample_intervall"},
+		{[]string{"-config", filepath.Join(dir, "missing.yaml")}, nil, "no such file"},
+	}
+	for _, c := range cases {
+		cfg, err := newConfigLoader(c.args).load()
+		if c.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Fatalf("load(%v) error=%v want %q", c.args, err, c.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("load(%v) error: %v", c.args, err)
+		}
+		if !c.check(cfg) {
+			t.Fatalf("load(%v)=%+v", c.args, cfg)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	m := newTestMonitor(t)
+	for i := 0; i < 100; i++ {
+		m.store(sample(i))
+	}
+
+	cfg := defaultConfig()
+	cfg.Retention = 20 * time.Second
+	cfg.HistoryLimit = 3
+	cfg.Collectors = []string{"cpu", "memory"}
+	if err := m.applyConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.stats) != 10 || m.stats[0].CPUPercent != 90 {
+		t.Fatalf("history len=%d oldest=%v want the newest 10 samples", len(m.stats), m.stats[0].CPUPercent)
+	}
+	if m.historyLimit != 3 {
+		t.Fatalf("history limit=%d want 3", m.historyLimit)
+	}
+	for _, name := range builtinCollectorNames() {
+		want := name == "cpu" || name == "memory"
+		if got := m.registry.Registered(name); got != want {
+			t.Fatalf("collector %s registered=%v want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// webFS holds the dashboard pages, scripts and styles. Everything is
+// compiled into the binary so the dashboards work without internet access.
+//
+//go:embed web
+var webFS embed.FS
+
+// staticHandler serves the embedded assets under /static/
+func staticHandler() http.Handler {
+	sub, err := fs.Sub(webFS, "web")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/static/", http.FileServer(http.FS(sub)))
+}
+
+// servePage returns a handler that serves one embedded HTML page
+func servePage(name string) http.HandlerFunc {
+	page, err := webFS.ReadFile("web/" + name)
+	if err != nil {
+		panic(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// exportColumn is one scalar SystemStats field in CSV exports and reports
+type exportColumn struct {
+	name  string
+	value func(s SystemStats) float64
+}
+
+// exportColumns lists the scalar metrics, in CSV column order. Nested
+// fields (per-core, partitions, network) are only in JSON exports.
+var exportColumns = []exportColumn{
+	{"cpu_percent", func(s SystemStats) float64 { return s.CPUPercent }},
+	{"memory_total", func(s SystemStats) float64 { return float64(s.MemoryTotal) }},
+	{"memory_used", func(s SystemStats) float64 { return float64(s.MemoryUsed) }},
+	{"memory_percent", func(s SystemStats) float64 { return s.MemoryPercent }},
+	{"swap_total", func(s SystemStats) float64 { return float64(s.SwapTotal) }},
+	{"swap_used", func(s SystemStats) float64 { return float64(s.SwapUsed) }},
+	{"swap_percent", func(s SystemStats) float64 { return s.SwapPercent }},
+	{"disk_total", func(s SystemStats) float64 { return float64(s.DiskTotal) }},
+	{"disk_used", func(s SystemStats) float64 { return float64(s.DiskUsed) }},
+	{"disk_percent", func(s SystemStats) float64 { return s.DiskPercent }},
+	{"load1", func(s SystemStats) float64 { return s.Load1 }},
+	{"load5", func(s SystemStats) float64 { return s.Load5 }},
+	{"load15", func(s SystemStats) float64 { return s.Load15 }},
+	{"goroutines", func(s SystemStats) float64 { return float64(s.Goroutines) }},
+	{"network_rx_bytes_per_sec", func(s SystemStats) float64 {
+		var total float64
+		for _, n := range s.Network {
+			total += n.RxBytesPS
+		}
+		return total
+	}},
+	{"network_tx_bytes_per_sec", func(s SystemStats) float64 {
+		var total float64
+		for _, n := range s.Network {
+			total += n.TxBytesPS
+		}
+		return total
+	}},
+}
+
+// metricValue looks up a scalar metric of a sample by its export name
+func metricValue(s SystemStats, name string) (float64, bool) {
+	for _, column := range exportColumns {
+		if column.name == name {
+			return column.value(s), true
+		}
+	}
+	return 0, false
+}
+
+// parseTimeRange reads the optional RFC 3339 from and to query parameters
+func parseTimeRange(r *http.Request) (from, to time.Time, err error) {
+	for name, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		if value := r.URL.Query().Get(name); value != "" {
+			if *t, err = time.Parse(time.RFC3339, value); err != nil {
+				return from, to, fmt.Errorf("invalid %s time %q: use RFC 3339", name, value)
+			}
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return from, to, fmt.Errorf("to must not be before from")
+	}
+	return from, to, nil
+}
+
+// statsBetween returns the samples in [from, to]; zero times are unbounded.
+// stats must be in time order.
+func statsBetween(stats []SystemStats, from, to time.Time) []SystemStats {
+	if !from.IsZero() {
+		stats = stats[sort.Search(len(stats), func(i int) bool { return !stats[i].Timestamp.Before(from) }):]
+	}
+	if !to.IsZero() {
+		stats = stats[:sort.Search(len(stats), func(i int) bool { return stats[i].Timestamp.After(to) })]
+	}
+	return stats
+}
+
+// historyBetween returns the stored samples in [from, to]. Samples are
+// never modified once stored, so the result can be used after unlocking.
+func (m *Monitor) historyBetween(from, to time.Time) []SystemStats {
+	m.statsMu.RLock()
+	defer m.statsMu.RUnlock()
+
+	return statsBetween(m.stats, from, to)
+}
+
+// handleExport streams stored samples as CSV, a JSON array or NDJSON
+func (m *Monitor) handleExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	contentTypes := map[string]string{
+		"csv":    "text/csv",
+		"json":   "application/json",
+		"ndjson": "application/x-ndjson",
+	}
+	contentType, ok := contentTypes[format]
+	from, to, err := parseTimeRange(r)
+	if !ok {
+		err = fmt.Errorf("invalid format %q: use csv, json or ndjson", format)
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	stats := m.historyBetween(from, to)
+	filename := fmt.Sprintf("sysmon-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	out := bufio.NewWriter(w)
+	switch format {
+	case "csv":
+		writeCSV(out, stats)
+	case "json":
+		out.WriteString("[")
+		for i, s := range stats {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			data, _ := json.Marshal(s)
+			out.Write(data)
+		}
+		out.WriteString("]\n")
+	case "ndjson":
+		encoder := json.NewEncoder(out)
+		for _, s := range stats {
+			encoder.Encode(s)
+		}
+	}
+	out.Flush()
+}
+
+// writeCSV writes one row per sample with the scalar export columns
+func writeCSV(out *bufio.Writer, stats []SystemStats) {
+	writer := csv.NewWriter(out)
+	header := []string{"timestamp"}
+	for _, column := range exportColumns {
+		header = append(header, column.name)
+	}
+	writer.Write(header)
+
+	row := make([]string, len(header))
+	for _, s := range stats {
+		row[0] = s.Timestamp.UTC().Format(time.RFC3339Nano)
+		for i, column := range exportColumns {
+			row[i+1] = strconv.FormatFloat(column.value(s), 'f', -1, 64)
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+}
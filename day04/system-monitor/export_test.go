@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedHistory returns five samples a minute apart from start, with CPU
+// at 10, 20, ... 50%
+func fixedHistory(start time.Time) []SystemStats {
+	stats := make([]SystemStats, 5)
+	for i := range stats {
+		stats[i] = SystemStats{
+			Timestamp:     start.Add(time.Duration(i) * time.Minute),
+			CPUPercent:    float64(i+1) * 10,
+			MemoryTotal:   8000,
+			MemoryUsed:    uint64(i+1) * 1000,
+			MemoryPercent: 12.5 * float64(i+1),
+			Load1:         0.5,
+			Goroutines:    7,
+			Network: []NetworkStats{
+				{Interface: "eth0", RxBytesPS: 100, TxBytesPS: 10},
+				{Interface: "wlan0", RxBytesPS: 50, TxBytesPS: 5},
+			},
+		}
+	}
+	return stats
+}
+
+func TestExport(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	m := NewMonitor(Sources{CPU: newFakeSources(), Memory: newFakeSources(), Disk: newFakeSources(), Host: newFakeSources()})
+	m.stats = fixedHistory(start)
+	server := httptest.NewServer(newRouter(m))
+	defer server.Close()
+
+	get := func(query string) *http.Response {
+		resp, err := http.Get(server.URL + "/api/stats/export?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := get("format=csv")
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHeader := "timestamp,cpu_percent,memory_total,memory_used,memory_percent,swap_total,swap_used,swap_percent," +
+		"disk_total,disk_used,disk_percent,load1,load5,load15,goroutines,network_rx_bytes_per_sec,network_tx_bytes_per_sec"
+	if header := strings.Join(rows[0], ","); header != wantHeader {
+		t.Fatalf("CSV header=%s want %s", header, wantHeader)
+	}
+	if len(rows) != 6 {
+		t.Fatalf("CSV has %d rows want a header and 5 samples", len(rows))
+	}
+	wantRow := "2024-05-01T10:01:00Z,20,8000,2000,25,0,0,0,0,0,0,0.5,0,0,7,150,15"
+	if row := strings.Join(rows[2], ","); row != wantRow {
+		t.Fatalf("CSV row=%s want %s", row, wantRow)
+	}
+
+	cases := []struct {
+		query string
+		want  []float64 // CPU of the exported samples
+	}{
+		{"", []float64{10, 20, 30, 40, 50}},
+		{"from=2024-05-01T10:01:00Z", []float64{20, 30, 40, 50}},
+		{"to=2024-05-01T10:02:00Z", []float64{10, 20, 30}},
+		{"from=2024-05-01T10:00:30Z&to=2024-05-01T10:03:00Z", []float64{20, 30, 40}},
+		{"from=2024-05-01T11:00:00Z", []float64{}},
+	}
+	for _, c := range cases {
+		resp := get("format=json&" + c.query)
+		var stats []SystemStats
+		err := json.NewDecoder(resp.Body).Decode(&stats)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", c.query, err)
+		}
+		got := make([]float64, len(stats))
+		for i, s := range stats {
+			got[i] = s.CPUPercent
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Fatalf("export?%s CPU=%v want %v", c.query, got, c.want)
+		}
+	}
+
+	for _, query := range []string{"format=xml", "from=yesterday", "from=2024-05-01T11:00:00Z&to=2024-05-01T10:00:00Z"} {
+		resp := get(query)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("export?%s status=%d want 400", query, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Host statuses derived from when a host last reported
+const (
+	hostOnline  = "online"
+	hostStale   = "stale"
+	hostOffline = "offline"
+)
+
+// HostSummary describes one host in the fleet
+type HostSummary struct {
+	Hostname string       `json:"hostname"`
+	Info     SystemInfo   `json:"info"`
+	LastSeen time.Time    `json:"last_seen"`
+	Status   string       `json:"status"`
+	Latest   *SystemStats `json:"latest,omitempty"`
+}
+
+// hostState holds what the server knows about a single host
+type hostState struct {
+	info     SystemInfo
+	lastSeen time.Time
+	stats    []SystemStats
+}
+
+// Fleet aggregates stats pushed by agents
+type Fleet struct {
+	mu           sync.RWMutex
+	hosts        map[string]*hostState
+	token        string
+	maxSamples   int
+	staleAfter   time.Duration
+	offlineAfter time.Duration
+}
+
+// NewFleet creates an empty fleet that accepts pushes carrying token
+func NewFleet(token string, maxSamples int, staleAfter, offlineAfter time.Duration) *Fleet {
+	return &Fleet{
+		hosts:        make(map[string]*hostState),
+		token:        token,
+		maxSamples:   maxSamples,
+		staleAfter:   staleAfter,
+		offlineAfter: offlineAfter,
+	}
+}
+
+// ingest stores a report from an agent
+func (f *Fleet) ingest(report AgentReport) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	host, exists := f.hosts[report.Host.Hostname]
+	if !exists {
+		host = &hostState{}
+		f.hosts[report.Host.Hostname] = host
+		log.Printf("New host reporting: %s", report.Host.Hostname)
+	}
+	host.info = report.Host
+	host.lastSeen = time.Now()
+
+	// Buffered samples can arrive late; keep the history ordered
+	host.stats = append(host.stats, report.Samples...)
+	sort.SliceStable(host.stats, func(i, j int) bool {
+		return host.stats[i].Timestamp.Before(host.stats[j].Timestamp)
+	})
+	if len(host.stats) > f.maxSamples {
+		host.stats = host.stats[len(host.stats)-f.maxSamples:]
+	}
+}
+
+// status classifies a host by how long ago it last reported
+func (f *Fleet) status(lastSeen time.Time) string {
+	switch age := time.Since(lastSeen); {
+	case age > f.offlineAfter:
+		return hostOffline
+	case age > f.staleAfter:
+		return hostStale
+	default:
+		return hostOnline
+	}
+}
+
+// summary must be called with f.mu held
+func (f *Fleet) summary(name string, host *hostState) HostSummary {
+	s := HostSummary{
+		Hostname: name,
+		Info:     host.info,
+		LastSeen: host.lastSeen,
+		Status:   f.status(host.lastSeen),
+	}
+	if len(host.stats) > 0 {
+		latest := host.stats[len(host.stats)-1]
+		s.Latest = &latest
+	}
+	return s
+}
+
+// authorized checks the bearer token in constant time
+func (f *Fleet) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(f.token)) == 1
+}
+
+func (f *Fleet) handleIngest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !f.authorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid token"})
+		return
+	}
+
+	var report AgentReport
+	r.Body = http.MaxBytesReader(w, r.Body, 16<<20)
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid report: " + err.Error()})
+		return
+	}
+	if report.Host.Hostname == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "report has no hostname"})
+		return
+	}
+
+	f.ingest(report)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int{"accepted": len(report.Samples)})
+}
+
+func (f *Fleet) handleHosts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	f.mu.RLock()
+	hosts := make([]HostSummary, 0, len(f.hosts))
+	for name, host := range f.hosts {
+		hosts = append(hosts, f.summary(name, host))
+	}
+	f.mu.RUnlock()
+
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Hostname < hosts[j].Hostname })
+	json.NewEncoder(w).Encode(hosts)
+}
+
+func (f *Fleet) handleHost(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	name := mux.Vars(r)["host"]
+	f.mu.RLock()
+	host, exists := f.hosts[name]
+	var summary HostSummary
+	if exists {
+		summary = f.summary(name, host)
+	}
+	f.mu.RUnlock()
+
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unknown host"})
+		return
+	}
+	json.NewEncoder(w).Encode(summary)
+}
+
+func (f *Fleet) handleHostHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	host, exists := f.hosts[mux.Vars(r)["host"]]
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unknown host"})
+		return
+	}
+
+	history, err := selectHistory(host.stats, r, defaultHistoryLimit)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(history)
+}
+
+// runServer parses server flags and serves the fleet dashboard
+func runServer(args []string) {
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	token := fs.String("token", os.Getenv("SYSMON_TOKEN"), "shared ingest token agents must present")
+	maxSamples := fs.Int("retention", 1000, "samples kept per host")
+	staleAfter := fs.Duration("stale-after", 30*time.Second, "mark a host stale after this long without a push")
+	offlineAfter := fs.Duration("offline-after", 2*time.Minute, "mark a host offline after this long without a push")
+	fs.Parse(args)
+
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, "server mode requires -token (or SYSMON_TOKEN)")
+		os.Exit(2)
+	}
+
+	fleet := NewFleet(*token, *maxSamples, *staleAfter, *offlineAfter)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/ingest", fleet.handleIngest).Methods("POST")
+	router.HandleFunc("/api/hosts", fleet.handleHosts).Methods("GET")
+	router.HandleFunc("/api/hosts/{host}", fleet.handleHost).Methods("GET")
+	router.HandleFunc("/api/hosts/{host}/stats/history", fleet.handleHostHistory).Methods("GET")
+	router.HandleFunc("/api/health", handleHealth).Methods("GET")
+	router.PathPrefix("/static/").Handler(staticHandler())
+	router.HandleFunc("/hosts/{host}", servePage("host.html")).Methods("GET")
+	router.HandleFunc("/", servePage("fleet.html")).Methods("GET")
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	// Agents authenticate to /api/ingest with their own token
+	security := securityConfigFromEnv()
+	security.PublicPaths = append(security.PublicPaths, "/api/ingest")
+	security.PublicPrefixes = append(security.PublicPrefixes, "/hosts/")
+
+	scheme := "http"
+	if security.tlsEnabled() {
+		scheme = "https"
+	}
+	fmt.Printf("🚀 System Monitor fleet server starting on port %s\n", port)
+	fmt.Printf("📊 Fleet dashboard: %s://localhost:%s\n", scheme, port)
+
+	ctx, stop := shutdownContext()
+	defer stop()
+	if err := security.serve(ctx, ":"+port, security.wrap(router)); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Stopped")
+}
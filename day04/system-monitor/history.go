@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// loadHistory restores samples written by saveHistory, skipping any that
+// are older than the retention
+func (m *Monitor) loadHistory(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var saved []SystemStats
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+
+	cutoff := time.Now().Add(-time.Duration(m.maxSamples) * m.sampleInterval)
+	stats := statsBetween(saved, cutoff, time.Time{})
+	m.stats = append(append([]SystemStats{}, stats...), m.stats...)
+	if len(m.stats) > m.maxSamples {
+		m.stats = m.stats[len(m.stats)-m.maxSamples:]
+	}
+	return nil
+}
+
+// saveHistory writes the history to path, replacing the previous file
+// only once the new one is complete
+func (m *Monitor) saveHistory(path string) error {
+	m.statsMu.RLock()
+	data, err := json.Marshal(m.stats)
+	m.statsMu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
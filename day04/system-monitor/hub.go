@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the client
+	writeWait = 10 * time.Second
+	// Time allowed to read the next pong message from the client
+	pongWait = 60 * time.Second
+	// Send pings with this period; must be less than pongWait
+	pingPeriod = (pongWait * 9) / 10
+	// Maximum size of a message from the client
+	maxMessageSize = 4096
+	// Messages queued per client before it is considered too slow
+	sendQueueSize = 32
+)
+
+// metricGroups maps subscription groups to the SystemStats JSON fields
+// they include; the timestamp is always sent
+var metricGroups = map[string][]string{
+	"cpu":       {"cpu_percent", "cpu_per_core"},
+	"memory":    {"memory_total", "memory_used", "memory_percent", "swap_total", "swap_used", "swap_percent"},
+	"disk":      {"disk_total", "disk_used", "disk_free", "disk_percent", "partitions", "disk_io"},
+	"network":   {"network"},
+	"load":      {"load1", "load5", "load15"},
+	"container": {"container"},
+	"logs":      {"logs"},
+	"probes":    {"probes"},
+	"system":    {"goroutines", "metrics", "errors"},
+}
+
+// subscribeMessage is sent by clients to choose what they receive.
+// An empty group list means every group; interval is a Go duration
+// string such as "5s" and is never faster than the sampling interval.
+// Matching log lines are only streamed to clients that name the logs
+// group. The same choice can be made when connecting, with the groups
+// (comma separated) and interval query parameters of /ws.
+type subscribeMessage struct {
+	Type     string   `json:"type"`
+	Groups   []string `json:"groups"`
+	Interval string   `json:"interval"`
+}
+
+// wsClient is a single WebSocket connection with its own send queue
+type wsClient struct {
+	hub  *Hub
+	conn *websocket.Conn
+	send chan []byte
+
+	// Owned by the hub goroutine
+	groups   []string // sorted; nil means all groups but no log lines
+	interval time.Duration
+	lastSent time.Time
+	// closeMessage is the close frame payload sent once send is closed
+	closeMessage []byte
+}
+
+// subscription is a request from a client's read loop to the hub;
+// problem is set when the request was invalid
+type subscription struct {
+	client   *wsClient
+	groups   []string
+	interval time.Duration
+	problem  string
+}
+
+// Hub fans samples out to WebSocket clients. All client bookkeeping
+// happens on the hub goroutine, so no lock is held while writing and a
+// slow client only fills its own queue.
+type Hub struct {
+	clients    map[*wsClient]bool
+	register   chan *wsClient
+	unregister chan *wsClient
+	subscribe  chan subscription
+	broadcast  chan SystemStats
+	logs       chan LogLine
+
+	// sampleInterval is the fastest rate clients can ask for; it can
+	// change on a config reload
+	sampleInterval atomic.Int64
+
+	// done is closed once run has returned
+	done chan struct{}
+	// writers tracks the client write loops so shutdown can wait for
+	// their close frames to go out
+	writers sync.WaitGroup
+}
+
+// NewHub creates a hub for samples taken every sampleInterval
+func NewHub(sampleInterval time.Duration) *Hub {
+	h := &Hub{
+		clients:    make(map[*wsClient]bool),
+		register:   make(chan *wsClient),
+		unregister: make(chan *wsClient),
+		subscribe:  make(chan subscription),
+		broadcast:  make(chan SystemStats, 1),
+		logs:       make(chan LogLine, 256),
+		done:       make(chan struct{}),
+	}
+	h.setSampleInterval(sampleInterval)
+	return h
+}
+
+// setSampleInterval changes the sampling interval clients are served at
+// without disconnecting them
+func (h *Hub) setSampleInterval(d time.Duration) {
+	h.sampleInterval.Store(int64(d))
+}
+
+// run processes hub events until ctx is cancelled, then closes every
+// client with a going-away close frame and waits for those to be sent
+func (h *Hub) run(ctx context.Context) {
+	defer close(h.done)
+	for {
+		select {
+		case <-ctx.Done():
+			for c := range h.clients {
+				c.closeMessage = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				h.remove(c)
+			}
+			h.writers.Wait()
+			return
+		case c := <-h.register:
+			h.clients[c] = true
+			h.writers.Add(1) // the client's writePump
+		case c := <-h.unregister:
+			h.remove(c)
+		case sub := <-h.subscribe:
+			h.applySubscription(sub)
+		case stats := <-h.broadcast:
+			h.fanOut(stats)
+		case line := <-h.logs:
+			h.fanOutLog(line)
+		}
+	}
+}
+
+// applySubscription updates a client's subscription or reports why it
+// was rejected
+func (h *Hub) applySubscription(sub subscription) {
+	c := sub.client
+	if !h.clients[c] {
+		return
+	}
+	if sub.problem != "" {
+		reply, _ := json.Marshal(map[string]string{"type": "error", "error": sub.problem})
+		select {
+		case c.send <- reply:
+		default:
+		}
+		return
+	}
+	c.groups = sub.groups
+	c.interval = sub.interval
+}
+
+// clientInterval is how often c is sent samples: its requested
+// interval, but never faster than samples are taken
+func (h *Hub) clientInterval(c *wsClient) time.Duration {
+	if sample := time.Duration(h.sampleInterval.Load()); c.interval < sample {
+		return sample
+	}
+	return c.interval
+}
+
+// remove drops a client and closes its queue, which stops its writer
+func (h *Hub) remove(c *wsClient) {
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+// fanOut queues a sample for every client that is due one
+func (h *Hub) fanOut(stats SystemStats) {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		log.Println("Failed to encode stats:", err)
+		return
+	}
+
+	sample := time.Duration(h.sampleInterval.Load())
+	var fields map[string]json.RawMessage
+	payloads := make(map[string][]byte) // filtered payload per group set
+	for c := range h.clients {
+		// Allow some jitter so a 4s subscription isn't pushed to 6s
+		if interval := h.clientInterval(c); interval > sample && stats.Timestamp.Sub(c.lastSent) < interval-sample/2 {
+			continue
+		}
+
+		payload := data
+		if c.groups != nil {
+			key := strings.Join(c.groups, ",")
+			if payloads[key] == nil {
+				if fields == nil {
+					json.Unmarshal(data, &fields)
+				}
+				payloads[key] = filterGroups(fields, c.groups)
+			}
+			payload = payloads[key]
+		}
+
+		select {
+		case c.send <- payload:
+			c.lastSent = stats.Timestamp
+		default:
+			// The client can't keep up; drop it rather than stall everyone
+			log.Println("Dropping slow WebSocket client:", c.conn.RemoteAddr())
+			h.remove(c)
+		}
+	}
+}
+
+// fanOutLog queues a matching log line for every client that named the
+// logs group. Lines are skipped for a client whose queue is full rather
+// than dropping it, since a burst of log lines is expected.
+func (h *Hub) fanOutLog(line LogLine) {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	for c := range h.clients {
+		if !slices.Contains(c.groups, "logs") {
+			continue
+		}
+		select {
+		case c.send <- data:
+		default:
+		}
+	}
+}
+
+// filterGroups keeps only the fields belonging to the given groups
+func filterGroups(fields map[string]json.RawMessage, groups []string) []byte {
+	filtered := map[string]json.RawMessage{"timestamp": fields["timestamp"]}
+	for _, group := range groups {
+		for _, field := range metricGroups[group] {
+			if value, ok := fields[field]; ok {
+				filtered[field] = value
+			}
+		}
+	}
+	data, _ := json.Marshal(filtered)
+	return data
+}
+
+// publish hands a sample to the hub without blocking the sampler; if
+// the hub is still busy with the previous sample the older one is dropped
+func (h *Hub) publish(stats SystemStats) {
+	for {
+		select {
+		case h.broadcast <- stats:
+			return
+		default:
+		}
+		select {
+		case <-h.broadcast:
+		default:
+		}
+	}
+}
+
+// publishLog hands a matching log line to the hub without blocking the
+// collector; lines are dropped while the hub is behind
+func (h *Hub) publishLog(line LogLine) {
+	select {
+	case h.logs <- line:
+	default:
+	}
+}
+
+// parseSubscription validates a subscribe message; a zero interval
+// means every sample
+func (h *Hub) parseSubscription(msg subscribeMessage) ([]string, time.Duration, string) {
+	var groups []string
+	for _, group := range msg.Groups {
+		if _, ok := metricGroups[group]; !ok {
+			return nil, 0, "unknown group " + group
+		}
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	var interval time.Duration
+	if msg.Interval != "" {
+		d, err := time.ParseDuration(msg.Interval)
+		if err != nil || d <= 0 {
+			return nil, 0, "invalid interval " + msg.Interval
+		}
+		interval = d
+	}
+	return groups, interval, ""
+}
+
+// sendToHub hands a request to the hub goroutine, giving up once it has stopped
+func sendToHub[T any](h *Hub, ch chan<- T, v T) bool {
+	select {
+	case ch <- v:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// readPump handles subscribe messages and pongs until the connection fails
+func (c *wsClient) readPump() {
+	defer func() {
+		sendToHub(c.hub, c.hub.unregister, c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println("WebSocket read failed:", err)
+			}
+			return
+		}
+
+		// The hub owns the send queue, so even error replies go through it
+		var msg subscribeMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "subscribe" {
+			sendToHub(c.hub, c.hub.subscribe, subscription{client: c, problem: "expected a subscribe message"})
+			continue
+		}
+		groups, interval, problem := c.hub.parseSubscription(msg)
+		sendToHub(c.hub, c.hub.subscribe, subscription{client: c, groups: groups, interval: interval, problem: problem})
+	}
+}
+
+// writePump writes queued messages and pings; it is the only goroutine
+// that writes to the connection
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+		c.hub.writers.Done()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the queue
+				c.conn.WriteMessage(websocket.CloseMessage, c.closeMessage)
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (m *Monitor) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	groups, interval, problem := m.hub.parseSubscription(subscribeMessage{
+		Groups:   splitList(query.Get("groups")),
+		Interval: query.Get("interval"),
+	})
+	if problem != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": problem})
+		return
+	}
+
+	conn, err := m.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("WebSocket upgrade failed:", err)
+		return
+	}
+
+	client := &wsClient{
+		hub:      m.hub,
+		conn:     conn,
+		send:     make(chan []byte, sendQueueSize),
+		groups:   groups,
+		interval: interval,
+	}
+
+	// Queue the current stats before registering so they arrive first
+	m.statsMu.RLock()
+	if len(m.stats) > 0 {
+		data, _ := json.Marshal(m.stats[len(m.stats)-1])
+		if groups != nil {
+			var fields map[string]json.RawMessage
+			json.Unmarshal(data, &fields)
+			data = filterGroups(fields, groups)
+		}
+		client.send <- data
+	}
+	m.statsMu.RUnlock()
+
+	if !sendToHub(m.hub, m.hub.register, client) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+	go client.writePump()
+	client.readPump()
+}
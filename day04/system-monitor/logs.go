@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxLogLineLength caps a line that never ends, and lines sent to clients
+	maxLogLineLength = 16 * 1024
+	// maxStreamedLines is how many matching lines per file and poll are
+	// streamed; a burst beyond that is still counted
+	maxStreamedLines = 50
+)
+
+// LogTailConfig is a file to follow and the rules its lines are matched
+// against
+type LogTailConfig struct {
+	Path  string    `yaml:"path"`
+	Rules []LogRule `yaml:"rules"`
+}
+
+// LogRule counts the lines matching Pattern. Warning and Critical, when
+// set, raise alerts once that many lines match within a minute.
+type LogRule struct {
+	Name     string  `yaml:"name"`
+	Pattern  string  `yaml:"pattern"`
+	Warning  float64 `yaml:"warning"`
+	Critical float64 `yaml:"critical"`
+}
+
+// LogRuleStats reports how often a rule has matched
+type LogRuleStats struct {
+	File      string  `json:"file"`
+	Rule      string  `json:"rule"`
+	PerMinute int     `json:"per_minute"`
+	Total     uint64  `json:"total"`
+	Warning   float64 `json:"warning,omitempty"`
+	Critical  float64 `json:"critical,omitempty"`
+}
+
+// LogLine is a matching line streamed to WebSocket clients
+type LogLine struct {
+	Type      string    `json:"type"` // always "log"
+	Timestamp time.Time `json:"timestamp"`
+	File      string    `json:"file"`
+	Rule      string    `json:"rule"`
+	Line      string    `json:"line"`
+}
+
+// validateLogs checks the log tail settings of a config
+func validateLogs(logs []LogTailConfig) error {
+	for _, tail := range logs {
+		if tail.Path == "" {
+			return fmt.Errorf("logs: path must not be empty")
+		}
+		if len(tail.Rules) == 0 {
+			return fmt.Errorf("logs: %s has no rules", tail.Path)
+		}
+		seen := make(map[string]bool)
+		for _, rule := range tail.Rules {
+			if rule.Name == "" || seen[rule.Name] {
+				return fmt.Errorf("logs: %s needs a unique name for every rule", tail.Path)
+			}
+			seen[rule.Name] = true
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("logs: %s rule %s: %v", tail.Path, rule.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// rateWindow counts events over the last minute in one-second buckets
+type rateWindow struct {
+	counts  [60]int
+	seconds [60]int64 // the unix second each bucket is counting
+}
+
+func (w *rateWindow) add(t time.Time, n int) {
+	s := t.Unix()
+	i := s % 60
+	if w.seconds[i] != s {
+		w.seconds[i], w.counts[i] = s, 0
+	}
+	w.counts[i] += n
+}
+
+func (w *rateWindow) perMinute(now time.Time) int {
+	total := 0
+	for i, s := range w.seconds {
+		if now.Unix()-s < 60 {
+			total += w.counts[i]
+		}
+	}
+	return total
+}
+
+// logRule is a compiled rule and its match counts
+type logRule struct {
+	LogRule
+	re     *regexp.Regexp
+	total  uint64
+	recent rateWindow
+}
+
+// fileTail follows one file by polling, like tail -F: it notices when
+// the file is replaced (rename or delete and recreate) and finishes the
+// old file before reading the new one from the start, and it starts over
+// when the file is truncated in place
+type fileTail struct {
+	path    string
+	rules   []*logRule
+	file    *os.File
+	info    os.FileInfo // of the open file
+	reader  *bufio.Reader
+	partial []byte // a line still waiting for its newline
+	started bool
+}
+
+// poll reads what was appended since the last call and passes every
+// line on to match
+func (t *fileTail) poll(match func(line string)) error {
+	if t.file == nil {
+		// The first time round only new lines are of interest; a file
+		// that appears later is read in full
+		if err := t.open(!t.started); err != nil {
+			t.started = true
+			return err
+		}
+		t.started = true
+	}
+	if err := t.readLines(match); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(t.path)
+	switch {
+	case err != nil:
+		// Rotated away and not recreated yet; keep the old file
+		return nil
+	case !os.SameFile(info, t.info):
+		// Rotated: anything written to the old file before the switch
+		// has been read above
+		t.close()
+		if err := t.open(false); err != nil {
+			return err
+		}
+		return t.readLines(match)
+	default:
+		offset, err := t.file.Seek(0, io.SeekCurrent)
+		if err == nil && info.Size() < offset-int64(t.reader.Buffered()) {
+			// Truncated in place (copytruncate)
+			t.file.Seek(0, io.SeekStart)
+			t.reader.Reset(t.file)
+			t.partial = nil
+			return t.readLines(match)
+		}
+	}
+	return nil
+}
+
+// open opens the file, at its end or start
+func (t *fileTail) open(atEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if atEnd {
+		f.Seek(0, io.SeekEnd)
+	}
+	t.file, t.info = f, info
+	t.reader = bufio.NewReader(f)
+	t.partial = nil
+	return nil
+}
+
+func (t *fileTail) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// readLines reads complete lines up to the end of the file; an
+// unterminated last line is kept until the rest of it is written
+func (t *fileTail) readLines(match func(line string)) error {
+	for {
+		chunk, err := t.reader.ReadSlice('\n')
+		t.partial = append(t.partial, chunk...)
+		switch {
+		case err == nil:
+			match(strings.TrimSuffix(string(t.partial[:len(t.partial)-1]), "\r"))
+			t.partial = t.partial[:0]
+		case errors.Is(err, bufio.ErrBufferFull):
+			if len(t.partial) >= maxLogLineLength {
+				match(string(t.partial))
+				t.partial = t.partial[:0]
+			}
+		case err == io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// logTailCollector follows log files, counts the lines matching each
+// rule and hands matching lines to sink
+type logTailCollector struct {
+	sink func(LogLine)
+
+	mu      sync.Mutex
+	tails   []*fileTail
+	stopped bool
+}
+
+// newLogTailCollector follows the configured files; their patterns must
+// have been checked by validateLogs
+func newLogTailCollector(logs []LogTailConfig, sink func(LogLine)) *logTailCollector {
+	c := &logTailCollector{sink: sink}
+	for _, cfg := range logs {
+		tail := &fileTail{path: cfg.Path}
+		for _, rule := range cfg.Rules {
+			tail.rules = append(tail.rules, &logRule{LogRule: rule, re: regexp.MustCompile(rule.Pattern)})
+		}
+		c.tails = append(c.tails, tail)
+	}
+	return c
+}
+
+func (c *logTailCollector) Name() string            { return "logs" }
+func (c *logTailCollector) Interval() time.Duration { return time.Second }
+
+func (c *logTailCollector) Collect(ctx context.Context) ([]Metric, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return nil, nil
+	}
+
+	now := time.Now()
+	var errs []error
+	var metrics []Metric
+	for _, tail := range c.tails {
+		streamed := 0
+		err := tail.poll(func(line string) {
+			// Rules match the whole line; only the copy sent to clients is capped
+			shown := line
+			if len(shown) > maxLogLineLength {
+				shown = shown[:maxLogLineLength]
+			}
+			for _, rule := range tail.rules {
+				if !rule.re.MatchString(line) {
+					continue
+				}
+				rule.total++
+				rule.recent.add(now, 1)
+				if c.sink != nil && streamed < maxStreamedLines {
+					streamed++
+					c.sink(LogLine{Type: "log", Timestamp: now, File: tail.path, Rule: rule.Name, Line: shown})
+				}
+			}
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", tail.path, err))
+		}
+
+		for _, rule := range tail.rules {
+			metrics = append(metrics, Metric{
+				Name:   "log_matches_per_minute",
+				Value:  float64(rule.recent.perMinute(now)),
+				Labels: map[string]string{"file": tail.path, "rule": rule.Name},
+			})
+		}
+	}
+	return metrics, errors.Join(errs...)
+}
+
+func (c *logTailCollector) apply(stats *SystemStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tail := range c.tails {
+		for _, rule := range tail.rules {
+			stats.Logs = append(stats.Logs, LogRuleStats{
+				File:      tail.path,
+				Rule:      rule.Name,
+				PerMinute: rule.recent.perMinute(stats.Timestamp),
+				Total:     rule.total,
+				Warning:   rule.Warning,
+				Critical:  rule.Critical,
+			})
+		}
+	}
+}
+
+// stop closes the followed files once the collector is unregistered
+func (c *logTailCollector) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stopped = true
+	for _, tail := range c.tails {
+		tail.close()
+	}
+}
+
+// logAlerts checks the match rates of rules that have thresholds
+func logAlerts(stats SystemStats) []AlertEvent {
+	var events []AlertEvent
+	for _, l := range stats.Logs {
+		if l.Warning <= 0 && l.Critical <= 0 {
+			continue
+		}
+		value := float64(l.PerMinute)
+		severity, threshold := severityResolved, l.Warning
+		switch {
+		case l.Critical > 0 && value >= l.Critical:
+			severity, threshold = severityCritical, l.Critical
+		case l.Warning > 0 && value >= l.Warning:
+			severity = severityWarning
+		}
+		metric := l.File + ":" + l.Rule
+		events = append(events, AlertEvent{
+			Time:      stats.Timestamp,
+			Source:    "logs",
+			Metric:    metric,
+			Severity:  severity,
+			Value:     value,
+			Threshold: threshold,
+			Message:   fmt.Sprintf("%s matched %d lines in the last minute (%s at %.0f)", metric, l.PerMinute, severity, threshold),
+		})
+	}
+	return events
+}
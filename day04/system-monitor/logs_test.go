@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLogTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendLog := func(text string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(text)
+		f.Close()
+	}
+
+	var streamed []string
+	collector := newLogTailCollector([]LogTailConfig{{
+		Path:  path,
+		Rules: []LogRule{{Name: "errors", Pattern: "ERROR"}, {Name: "timeouts", Pattern: "(?i)timeout"}},
+	}}, func(l LogLine) { streamed = append(streamed, l.Rule+": "+l.Line) })
+
+	cases := []struct {
+		name   string
+		change func()
+		want   []string // lines streamed by the next poll
+	}{
+		{"missing file", func() {}, nil},
+		{"created later is read from the start", func() { appendLog("ERROR one\nINFO fine\n") }, []string{"errors: ERROR one"}},
+		{"appended", func() { appendLog("ERROR db Timeout\n") }, []string{"errors: ERROR db Timeout", "timeouts: ERROR db Timeout"}},
+		{"partial line waits", func() { appendLog("ERROR par") }, nil},
+		{"partial line completed", func() { appendLog("tial\r\n") }, []string{"errors: ERROR partial"}},
+		{"rotated", func() {
+			appendLog("ERROR before rotation\n")
+			os.Rename(path, path+".1")
+			appendLog("ERROR after rotation\n")
+		}, []string{"errors: ERROR before rotation", "errors: ERROR after rotation"}},
+		{"truncated", func() {
+			os.Truncate(path, 0)
+			appendLog("timeout\n")
+		}, []string{"timeouts: timeout"}},
+		{"nothing new", func() {}, nil},
+	}
+	for _, c := range cases {
+		c.change()
+		streamed = nil
+		collector.Collect(context.Background())
+		if !reflect.DeepEqual(streamed, c.want) {
+			t.Fatalf("%s: streamed %q want %q", c.name, streamed, c.want)
+		}
+	}
+
+	stats := SystemStats{Timestamp: time.Now()}
+	collector.apply(&stats)
+	want := []LogRuleStats{
+		{File: path, Rule: "errors", PerMinute: 5, Total: 5},
+		{File: path, Rule: "timeouts", PerMinute: 2, Total: 2},
+	}
+	if !reflect.DeepEqual(stats.Logs, want) {
+		t.Fatalf("rule stats %+v want %+v", stats.Logs, want)
+	}
+}
+
+func TestLogAlerts(t *testing.T) {
+	cases := []struct {
+		perMinute int
+		severity  string
+	}{
+		{0, severityResolved},
+		{9, severityResolved},
+		{10, severityWarning},
+		{99, severityWarning},
+		{100, severityCritical},
+	}
+	for _, c := range cases {
+		stats := SystemStats{Logs: []LogRuleStats{
+			{File: "app.log", Rule: "errors", PerMinute: c.perMinute, Warning: 10, Critical: 100},
+			{File: "app.log", Rule: "no thresholds", PerMinute: c.perMinute},
+		}}
+		events := logAlerts(stats)
+		if len(events) != 1 || events[0].Severity != c.severity || events[0].Metric != "app.log:errors" {
+			t.Fatalf("logAlerts(%d per minute)=%+v want one %s event", c.perMinute, events, c.severity)
+		}
+	}
+}
@@ -1,35 +1,55 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
-	"github.com/shirou/gopsutil/v3/mem"
 )
 
 // SystemStats represents system resource statistics
 type SystemStats struct {
-	Timestamp     time.Time `json:"timestamp"`
-	CPUPercent    float64   `json:"cpu_percent"`
-	MemoryTotal   uint64    `json:"memory_total"`
-	MemoryUsed    uint64    `json:"memory_used"`
-	MemoryPercent float64   `json:"memory_percent"`
-	DiskTotal     uint64    `json:"disk_total"`
-	DiskUsed      uint64    `json:"disk_used"`
-	DiskPercent   float64   `json:"disk_percent"`
-	Goroutines    int       `json:"goroutines"`
+	Timestamp     time.Time         `json:"timestamp"`
+	CPUPercent    float64           `json:"cpu_percent"`
+	CPUPerCore    []float64         `json:"cpu_per_core"`
+	MemoryTotal   uint64            `json:"memory_total"`
+	MemoryUsed    uint64            `json:"memory_used"`
+	MemoryPercent float64           `json:"memory_percent"`
+	SwapTotal     uint64            `json:"swap_total"`
+	SwapUsed      uint64            `json:"swap_used"`
+	SwapPercent   float64           `json:"swap_percent"`
+	DiskTotal     uint64            `json:"disk_total"`
+	DiskUsed      uint64            `json:"disk_used"`
+	DiskFree      uint64            `json:"disk_free"` // usable space left, less than total-used with reserved blocks
+	DiskPercent   float64           `json:"disk_percent"`
+	Partitions    []PartitionStats  `json:"partitions"`
+	DiskIO        []DiskIOStats     `json:"disk_io"`
+	Network       []NetworkStats    `json:"network"`
+	Load1         float64           `json:"load1"`
+	Load5         float64           `json:"load5"`
+	Load15        float64           `json:"load15"`
+	Goroutines    int               `json:"goroutines"`
+	Container     *ContainerStats   `json:"container,omitempty"`
+	Logs          []LogRuleStats    `json:"logs,omitempty"`
+	Probes        []ProbeStatus     `json:"probes,omitempty"`
+	Metrics       []Metric          `json:"metrics,omitempty"`
+	Errors        map[string]string `json:"errors,omitempty"`
 }
 
 // SystemInfo represents static system information
@@ -47,95 +67,129 @@ type SystemInfo struct {
 type Monitor struct {
 	stats     []SystemStats
 	statsMu   sync.RWMutex
-	clients   map[*websocket.Conn]bool
-	clientsMu sync.RWMutex
+	hub       *Hub
 	upgrader  websocket.Upgrader
+	registry  *Registry
+	processes *processSampler
+	alerts    *Alerts
+	anomalies *AnomalyDetector
+	sources   Sources
+	logTail   *logTailCollector // nil unless logs are configured
+	logConfig []LogTailConfig
+	probesMu  sync.RWMutex
+	probes    map[string]*probe
+
+	// Settings that can change on a config reload; guarded by statsMu
+	maxSamples     int
+	historyLimit   int
+	sampleInterval time.Duration
+	cpuWindow      time.Duration
+	// reconfigured wakes the sampling loop after the interval changed
+	reconfigured chan struct{}
 }
 
-// NewMonitor creates a new system monitor
-func NewMonitor() *Monitor {
-	return &Monitor{
-		stats:   make([]SystemStats, 0),
-		clients: make(map[*websocket.Conn]bool),
-		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins for demo
-			},
-		},
+// NewMonitor creates a system monitor reading the system from sources
+func NewMonitor(sources Sources) *Monitor {
+	cfg := defaultConfig()
+	m := &Monitor{
+		stats:        make([]SystemStats, 0),
+		sources:      sources,
+		probes:       make(map[string]*probe),
+		reconfigured: make(chan struct{}, 1),
+		hub:          NewHub(cfg.SampleInterval),
+		registry:     NewRegistry(),
+		processes:    newProcessSampler(),
+		alerts:       NewAlerts(defaultThresholds),
+		anomalies:    NewAnomalyDetector(),
+		// Only same-origin pages may open a WebSocket until a security
+		// config allows more
+		upgrader: websocket.Upgrader{CheckOrigin: SecurityConfig{}.originAllowed},
 	}
+
+	if err := m.applyConfig(cfg); err != nil {
+		log.Println("Failed to apply the default config:", err)
+	}
+	return m
 }
 
-// collectStats gathers current system statistics
+// collectStats assembles current system statistics from the latest
+// reading of every registered collector
 func (m *Monitor) collectStats() SystemStats {
-	// CPU usage
-	cpuPercent, _ := cpu.Percent(time.Second, false)
-	var cpuUsage float64
-	if len(cpuPercent) > 0 {
-		cpuUsage = cpuPercent[0]
+	stats := SystemStats{
+		Timestamp:  time.Now(),
+		Goroutines: runtime.NumGoroutine(),
 	}
+	m.registry.snapshot(&stats)
+	return stats
+}
 
-	// Memory usage
-	memInfo, _ := mem.VirtualMemory()
-
-	// Disk usage (root partition)
-	diskInfo, _ := disk.Usage("/")
-
-	return SystemStats{
-		Timestamp:     time.Now(),
-		CPUPercent:    cpuUsage,
-		MemoryTotal:   memInfo.Total,
-		MemoryUsed:    memInfo.Used,
-		MemoryPercent: memInfo.UsedPercent,
-		DiskTotal:     diskInfo.Total,
-		DiskUsed:      diskInfo.Used,
-		DiskPercent:   diskInfo.UsedPercent,
-		Goroutines:    runtime.NumGoroutine(),
-	}
+// shutdownTimeout bounds each stage of a graceful shutdown
+const shutdownTimeout = 10 * time.Second
+
+// run collects, samples and broadcasts until ctx is cancelled, and
+// returns once the collectors, the sampler and the WebSocket hub (with
+// its clients) have all stopped
+func (m *Monitor) run(ctx context.Context) {
+	m.registry.Start(ctx)
+	go m.hub.run(ctx)
+	m.startMonitoring(ctx)
+	<-m.hub.done
+	m.registry.Wait()
 }
 
-// startMonitoring begins collecting system stats
-func (m *Monitor) startMonitoring() {
-	ticker := time.NewTicker(2 * time.Second)
+// startMonitoring samples system stats until ctx is cancelled
+func (m *Monitor) startMonitoring(ctx context.Context) {
+	ticker := time.NewTicker(m.interval())
 	defer ticker.Stop()
 
 	for {
 		select {
+		case <-ctx.Done():
+			return
+		case <-m.reconfigured:
+			ticker.Reset(m.interval())
 		case <-ticker.C:
 			stats := m.collectStats()
+			m.store(stats)
 
-			// Store stats (keep last 100 entries)
-			m.statsMu.Lock()
-			m.stats = append(m.stats, stats)
-			if len(m.stats) > 100 {
-				m.stats = m.stats[1:]
+			m.alerts.evaluate(stats)
+			for _, event := range m.anomalies.observe(stats) {
+				m.alerts.update(event)
+			}
+			for _, event := range logAlerts(stats) {
+				m.alerts.update(event)
 			}
-			m.statsMu.Unlock()
 
 			// Broadcast to WebSocket clients
-			m.broadcastStats(stats)
+			m.hub.publish(stats)
 		}
 	}
 }
 
-// broadcastStats sends stats to all connected WebSocket clients
-func (m *Monitor) broadcastStats(stats SystemStats) {
-	m.clientsMu.RLock()
-	defer m.clientsMu.RUnlock()
+// interval returns the current sampling interval
+func (m *Monitor) interval() time.Duration {
+	m.statsMu.RLock()
+	defer m.statsMu.RUnlock()
+	return m.sampleInterval
+}
 
-	data, _ := json.Marshal(stats)
+// store appends a sample to the history, keeping the last maxSamples
+func (m *Monitor) store(stats SystemStats) {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
 
-	for client := range m.clients {
-		err := client.WriteMessage(websocket.TextMessage, data)
-		if err != nil {
-			client.Close()
-			delete(m.clients, client)
-		}
+	m.stats = append(m.stats, stats)
+	if len(m.stats) > m.maxSamples {
+		m.stats = m.stats[len(m.stats)-m.maxSamples:]
 	}
 }
 
-// getSystemInfo returns static system information
-func getSystemInfo() SystemInfo {
-	hostInfo, _ := host.Info()
+// systemInfo returns static system information
+func (m *Monitor) systemInfo() SystemInfo {
+	hostInfo, err := m.sources.Host.Info(context.Background())
+	if err != nil {
+		hostInfo = &host.InfoStat{}
+	}
 
 	return SystemInfo{
 		Hostname:        hostInfo.Hostname,
@@ -150,44 +204,8 @@ func getSystemInfo() SystemInfo {
 
 // HTTP Handlers
 
-func (m *Monitor) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := m.upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println("WebSocket upgrade failed:", err)
-		return
-	}
-	defer conn.Close()
-
-	// Add client
-	m.clientsMu.Lock()
-	m.clients[conn] = true
-	m.clientsMu.Unlock()
-
-	// Send current stats immediately
-	m.statsMu.RLock()
-	if len(m.stats) > 0 {
-		data, _ := json.Marshal(m.stats[len(m.stats)-1])
-		conn.WriteMessage(websocket.TextMessage, data)
-	}
-	m.statsMu.RUnlock()
-
-	// Keep connection alive
-	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			break
-		}
-	}
-
-	// Remove client
-	m.clientsMu.Lock()
-	delete(m.clients, conn)
-	m.clientsMu.Unlock()
-}
-
 func (m *Monitor) handleCurrentStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	stats := m.collectStats()
 	json.NewEncoder(w).Encode(stats)
@@ -195,39 +213,57 @@ func (m *Monitor) handleCurrentStats(w http.ResponseWriter, r *http.Request) {
 
 func (m *Monitor) handleHistoricalStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	m.statsMu.RLock()
+	defer m.statsMu.RUnlock()
+
+	history, err := selectHistory(m.stats, r, m.historyLimit)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(history)
+}
+
+// selectHistory applies the from, to and limit query parameters to
+// stats, which must be in time order. Without from the last
+// defaultLimit samples are returned; with it every sample since then,
+// unless limit is also set.
+func selectHistory(stats []SystemStats, r *http.Request, defaultLimit int) ([]SystemStats, error) {
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		return nil, err
+	}
+	stats = statsBetween(stats, from, to)
+
+	limit := defaultLimit
+	if !from.IsZero() {
+		limit = len(stats)
+	}
 
 	// Get limit parameter
-	limitStr := r.URL.Query().Get("limit")
-	limit := 50 // default
-	if limitStr != "" {
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
 			limit = l
 		}
 	}
 
-	m.statsMu.RLock()
-	defer m.statsMu.RUnlock()
-
-	start := 0
-	if len(m.stats) > limit {
-		start = len(m.stats) - limit
+	if len(stats) > limit {
+		stats = stats[len(stats)-limit:]
 	}
-
-	json.NewEncoder(w).Encode(m.stats[start:])
+	return stats, nil
 }
 
-func handleSystemInfo(w http.ResponseWriter, r *http.Request) {
+func (m *Monitor) handleSystemInfo(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
-	info := getSystemInfo()
+	info := m.systemInfo()
 	json.NewEncoder(w).Encode(info)
 }
 
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	response := map[string]string{
 		"status": "healthy",
@@ -236,273 +272,179 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// Serve static files (dashboard)
-func serveDashboard(w http.ResponseWriter, r *http.Request) {
-	dashboard := `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>System Monitor Dashboard</title>
-    <script src="https://cdn.jsdelivr.net/npm/chart.js"></script>
-    <style>
-        * { margin: 0; padding: 0; box-sizing: border-box; }
-        body { 
-            font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
-            color: #333;
-            min-height: 100vh;
-        }
-        .container { max-width: 1200px; margin: 0 auto; padding: 20px; }
-        .header { 
-            background: rgba(255,255,255,0.95);
-            padding: 20px;
-            border-radius: 15px;
-            margin-bottom: 20px;
-            box-shadow: 0 8px 32px rgba(0,0,0,0.1);
-        }
-        .stats-grid {
-            display: grid;
-            grid-template-columns: repeat(auto-fit, minmax(300px, 1fr));
-            gap: 20px;
-            margin-bottom: 30px;
-        }
-        .stat-card {
-            background: rgba(255,255,255,0.95);
-            padding: 25px;
-            border-radius: 15px;
-            box-shadow: 0 8px 32px rgba(0,0,0,0.1);
-            backdrop-filter: blur(10px);
-        }
-        .stat-value { font-size: 2.5rem; font-weight: bold; color: #4f46e5; }
-        .stat-label { font-size: 0.9rem; color: #6b7280; margin-top: 5px; }
-        .chart-container {
-            background: rgba(255,255,255,0.95);
-            padding: 25px;
-            border-radius: 15px;
-            box-shadow: 0 8px 32px rgba(0,0,0,0.1);
-            height: 400px;
-        }
-        .status { 
-            display: inline-block;
-            padding: 5px 12px;
-            border-radius: 20px;
-            font-size: 0.8rem;
-            font-weight: bold;
-        }
-        .status.online { background: #dcfce7; color: #166534; }
-        .progress-bar {
-            width: 100%;
-            height: 8px;
-            background: #e5e7eb;
-            border-radius: 4px;
-            overflow: hidden;
-            margin-top: 10px;
-        }
-        .progress-fill {
-            height: 100%;
-            background: linear-gradient(90deg, #10b981, #059669);
-            transition: width 0.3s ease;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>🖥️ System Monitor Dashboard</h1>
-            <p>Real-time system resource monitoring</p>
-            <span class="status online" id="connectionStatus">🟢 Connected</span>
-        </div>
-
-        <div class="stats-grid">
-            <div class="stat-card">
-                <div class="stat-value" id="cpuValue">0%</div>
-                <div class="stat-label">CPU Usage</div>
-                <div class="progress-bar">
-                    <div class="progress-fill" id="cpuProgress" style="width: 0%"></div>
-                </div>
-            </div>
-            
-            <div class="stat-card">
-                <div class="stat-value" id="memoryValue">0%</div>
-                <div class="stat-label">Memory Usage</div>
-                <div class="progress-bar">
-                    <div class="progress-fill" id="memoryProgress" style="width: 0%"></div>
-                </div>
-            </div>
-            
-            <div class="stat-card">
-                <div class="stat-value" id="diskValue">0%</div>
-                <div class="stat-label">Disk Usage</div>
-                <div class="progress-bar">
-                    <div class="progress-fill" id="diskProgress" style="width: 0%"></div>
-                </div>
-            </div>
-            
-            <div class="stat-card">
-                <div class="stat-value" id="goroutinesValue">0</div>
-                <div class="stat-label">Active Goroutines</div>
-            </div>
-        </div>
-
-        <div class="chart-container">
-            <canvas id="systemChart"></canvas>
-        </div>
-    </div>
-
-    <script>
-        // WebSocket connection
-        const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = protocol + '//' + window.location.host + '/ws';
-        let ws;
-        let chart;
-        const maxDataPoints = 50;
-
-        // Initialize chart
-        const ctx = document.getElementById('systemChart').getContext('2d');
-        chart = new Chart(ctx, {
-            type: 'line',
-            data: {
-                labels: [],
-                datasets: [
-                    {
-                        label: 'CPU %',
-                        data: [],
-                        borderColor: '#ef4444',
-                        backgroundColor: 'rgba(239, 68, 68, 0.1)',
-                        tension: 0.4
-                    },
-                    {
-                        label: 'Memory %',
-                        data: [],
-                        borderColor: '#3b82f6',
-                        backgroundColor: 'rgba(59, 130, 246, 0.1)',
-                        tension: 0.4
-                    },
-                    {
-                        label: 'Disk %',
-                        data: [],
-                        borderColor: '#10b981',
-                        backgroundColor: 'rgba(16, 185, 129, 0.1)',
-                        tension: 0.4
-                    }
-                ]
-            },
-            options: {
-                responsive: true,
-                maintainAspectRatio: false,
-                plugins: {
-                    title: {
-                        display: true,
-                        text: 'System Resources Over Time'
-                    }
-                },
-                scales: {
-                    y: {
-                        beginAtZero: true,
-                        max: 100,
-                        ticks: {
-                            callback: function(value) {
-                                return value + '%';
-                            }
-                        }
-                    }
-                },
-                animation: {
-                    duration: 750
-                }
-            }
-        });
-
-        function connectWebSocket() {
-            ws = new WebSocket(wsUrl);
-            
-            ws.onopen = function() {
-                document.getElementById('connectionStatus').innerHTML = '🟢 Connected';
-                document.getElementById('connectionStatus').className = 'status online';
-            };
-            
-            ws.onclose = function() {
-                document.getElementById('connectionStatus').innerHTML = '🔴 Disconnected';
-                document.getElementById('connectionStatus').className = 'status offline';
-                // Reconnect after 3 seconds
-                setTimeout(connectWebSocket, 3000);
-            };
-            
-            ws.onmessage = function(event) {
-                const data = JSON.parse(event.data);
-                updateDashboard(data);
-            };
-        }
-
-        function updateDashboard(stats) {
-            // Update stat cards
-            document.getElementById('cpuValue').textContent = stats.cpu_percent.toFixed(1) + '%';
-            document.getElementById('memoryValue').textContent = stats.memory_percent.toFixed(1) + '%';
-            document.getElementById('diskValue').textContent = stats.disk_percent.toFixed(1) + '%';
-            document.getElementById('goroutinesValue').textContent = stats.goroutines;
-
-            // Update progress bars
-            document.getElementById('cpuProgress').style.width = stats.cpu_percent + '%';
-            document.getElementById('memoryProgress').style.width = stats.memory_percent + '%';
-            document.getElementById('diskProgress').style.width = stats.disk_percent + '%';
-
-            // Update chart
-            const time = new Date(stats.timestamp).toLocaleTimeString();
-            
-            chart.data.labels.push(time);
-            chart.data.datasets[0].data.push(stats.cpu_percent);
-            chart.data.datasets[1].data.push(stats.memory_percent);
-            chart.data.datasets[2].data.push(stats.disk_percent);
-
-            // Keep only last N data points
-            if (chart.data.labels.length > maxDataPoints) {
-                chart.data.labels.shift();
-                chart.data.datasets.forEach(dataset => dataset.data.shift());
-            }
-
-            chart.update('none');
-        }
-
-        // Start WebSocket connection
-        connectWebSocket();
-    </script>
-</body>
-</html>`
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(dashboard))
+// registerScriptCollectors adds the collectors listed in COLLECTOR_SCRIPTS
+func registerScriptCollectors(monitor *Monitor) {
+	scripts, err := parseScriptCollectors(os.Getenv("COLLECTOR_SCRIPTS"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, c := range scripts {
+		if err := monitor.registry.Register(c); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
 
-func main() {
-	monitor := NewMonitor()
-
-	// Start monitoring in background
-	go monitor.startMonitoring()
-
-	// Setup routes
+// newRouter builds the standalone API, WebSocket and dashboard routes
+func newRouter(m *Monitor) *mux.Router {
 	router := mux.NewRouter()
 
 	// API endpoints
-	router.HandleFunc("/api/stats/current", monitor.handleCurrentStats).Methods("GET")
-	router.HandleFunc("/api/stats/history", monitor.handleHistoricalStats).Methods("GET")
-	router.HandleFunc("/api/system/info", handleSystemInfo).Methods("GET")
+	router.HandleFunc("/api/stats/current", m.handleCurrentStats).Methods("GET")
+	router.HandleFunc("/api/stats/history", m.handleHistoricalStats).Methods("GET")
+	router.HandleFunc("/api/stats/export", m.handleExport).Methods("GET")
+	router.HandleFunc("/api/report", m.handleReport).Methods("GET")
+	router.HandleFunc("/api/alerts", m.handleAlerts).Methods("GET")
+	router.HandleFunc("/api/anomalies", m.handleAnomalies).Methods("GET")
+	router.HandleFunc("/api/probes", m.handleProbes).Methods("GET")
+	router.HandleFunc("/api/probes/{name}/history", m.handleProbeHistory).Methods("GET")
+	router.HandleFunc("/api/processes", m.handleProcesses).Methods("GET")
+	router.HandleFunc("/api/collectors", m.handleCollectors).Methods("GET")
+	router.HandleFunc("/api/system/info", m.handleSystemInfo).Methods("GET")
 	router.HandleFunc("/api/health", handleHealth).Methods("GET")
 
+	// Prometheus scrape endpoint
+	router.HandleFunc("/metrics", m.handleMetrics).Methods("GET")
+
 	// WebSocket endpoint
-	router.HandleFunc("/ws", monitor.handleWebSocket)
+	router.HandleFunc("/ws", m.handleWebSocket)
 
 	// Dashboard
-	router.HandleFunc("/", serveDashboard).Methods("GET")
+	router.PathPrefix("/static/").Handler(staticHandler())
+	router.HandleFunc("/", servePage("index.html")).Methods("GET")
+
+	return router
+}
 
-	// Get port from environment or default to 8080
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+// runStandalone monitors this host and serves its own dashboard until
+// SIGINT or SIGTERM
+func runStandalone(args []string) {
+	loader := newConfigLoader(args)
+	cfg, err := loader.load()
+	if err != nil {
+		log.Fatal(err)
 	}
+	setLogFormat(cfg.LogFormat)
 
+	monitor := NewMonitor(systemSources())
+	if err := monitor.applyConfig(cfg); err != nil {
+		log.Fatal(err)
+	}
+	registerScriptCollectors(monitor)
+	if cfg.HistoryFile != "" {
+		if err := monitor.loadHistory(cfg.HistoryFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Println("Failed to load history:", err)
+		}
+	}
+
+	security := securityConfigFromEnv()
+	monitor.upgrader.CheckOrigin = security.originAllowed
+
+	ctx, stop := shutdownContext()
+	defer stop()
+
+	// Start collectors and monitoring in background
+	stopped := make(chan struct{})
+	go func() {
+		monitor.run(ctx)
+		close(stopped)
+	}()
+	go reloadOnHangup(ctx, loader, monitor, cfg)
+
+	_, port, _ := net.SplitHostPort(cfg.Listen)
+
+	scheme := "http"
+	if security.tlsEnabled() {
+		scheme = "https"
+	}
 	fmt.Printf("🚀 System Monitor starting on port %s\n", port)
-	fmt.Printf("📊 Dashboard: http://localhost:%s\n", port)
-	fmt.Printf("🔗 API: http://localhost:%s/api/stats/current\n", port)
+	fmt.Printf("📊 Dashboard: %s://localhost:%s\n", scheme, port)
+	fmt.Printf("🔗 API: %s://localhost:%s/api/stats/current\n", scheme, port)
+	fmt.Printf("📈 Metrics: %s://localhost:%s/metrics\n", scheme, port)
+	if security.authEnabled() {
+		fmt.Println("🔒 Authentication required")
+	}
+	if runtimeName, ok := detectContainer(); ok {
+		fmt.Printf("📦 Running in a container (%s)\n", runtimeName)
+	}
+
+	if err := security.serve(ctx, cfg.Listen, security.wrap(newRouter(monitor))); err != nil {
+		log.Fatal(err)
+	}
 
-	log.Fatal(http.ListenAndServe(":"+port, router))
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		log.Println("Timed out waiting for collectors to stop")
+	}
+	if cfg.HistoryFile != "" {
+		if err := monitor.saveHistory(cfg.HistoryFile); err != nil {
+			log.Println("Failed to save history:", err)
+		}
+	}
+	log.Println("Stopped")
+}
+
+// shutdownContext is cancelled on SIGINT or SIGTERM. After the first
+// signal the default handling is restored, so a second one exits at once.
+func shutdownContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, func() {
+		log.Println("Shutting down")
+		stop()
+	})
+	return ctx, stop
+}
+
+// reloadOnHangup re-reads the config on SIGHUP until ctx is cancelled;
+// an invalid config is logged and the running one kept
+func reloadOnHangup(ctx context.Context, loader *configLoader, monitor *Monitor, current Config) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+
+		cfg, err := loader.load()
+		if err != nil {
+			log.Println("Config reload failed, keeping the current config:", err)
+			continue
+		}
+		if cfg.Listen != current.Listen {
+			log.Printf("Listen address change to %s needs a restart", cfg.Listen)
+		}
+		current = cfg
+		setLogFormat(cfg.LogFormat)
+		if err := monitor.applyConfig(cfg); err != nil {
+			log.Println("Config reloaded with errors:", err)
+			continue
+		}
+		log.Println("Config reloaded")
+	}
+}
+
+func main() {
+	// The first argument selects the mode; no argument keeps the
+	// original single-host behaviour
+	mode := "standalone"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		mode, args = args[0], args[1:]
+	}
+
+	switch mode {
+	case "standalone":
+		runStandalone(args)
+	case "agent":
+		runAgent(args)
+	case "server":
+		runServer(args)
+	default:
+		fmt.Fprintln(os.Stderr, "Usage: system-monitor [standalone|agent|server] [flags]")
+		os.Exit(2)
+	}
 }
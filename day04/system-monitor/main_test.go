@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// fakeSources returns fixed readings for every source interface
+type fakeSources struct {
+	perCore    []float64
+	vm         mem.VirtualMemoryStat
+	swap       mem.SwapMemoryStat
+	usage      disk.UsageStat
+	partitions []disk.PartitionStat
+	counters   map[string]disk.IOCountersStat
+	info       host.InfoStat
+}
+
+func (f *fakeSources) PerCore(ctx context.Context, interval time.Duration) ([]float64, error) {
+	return f.perCore, nil
+}
+
+func (f *fakeSources) Virtual(ctx context.Context) (*mem.VirtualMemoryStat, error) {
+	vm := f.vm
+	return &vm, nil
+}
+
+func (f *fakeSources) Swap(ctx context.Context) (*mem.SwapMemoryStat, error) {
+	swap := f.swap
+	return &swap, nil
+}
+
+func (f *fakeSources) Usage(ctx context.Context, path string) (*disk.UsageStat, error) {
+	usage := f.usage
+	usage.Path = path
+	return &usage, nil
+}
+
+func (f *fakeSources) Partitions(ctx context.Context) ([]disk.PartitionStat, error) {
+	return f.partitions, nil
+}
+
+func (f *fakeSources) IOCounters(ctx context.Context) (map[string]disk.IOCountersStat, error) {
+	return f.counters, nil
+}
+
+func (f *fakeSources) Info(ctx context.Context) (*host.InfoStat, error) {
+	info := f.info
+	return &info, nil
+}
+
+func newFakeSources() *fakeSources {
+	return &fakeSources{
+		perCore: []float64{10, 30},
+		vm:      mem.VirtualMemoryStat{Total: 8000, Used: 2000, UsedPercent: 25},
+		swap:    mem.SwapMemoryStat{Total: 1000, Used: 100, UsedPercent: 10},
+		usage:   disk.UsageStat{Total: 500, Used: 200, Free: 300, UsedPercent: 40},
+		partitions: []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"}, // duplicate mount
+		},
+		counters: map[string]disk.IOCountersStat{"sda": {Name: "sda", ReadBytes: 4096}},
+		info: host.InfoStat{
+			Hostname: "test-host", OS: "linux", Platform: "testos",
+			PlatformFamily: "test", PlatformVersion: "1.0", Uptime: 3600,
+		},
+	}
+}
+
+// newTestMonitor builds a monitor over fake sources and takes one
+// reading from each of the collectors they feed
+func newTestMonitor(t *testing.T) *Monitor {
+	t.Helper()
+	m := NewMonitor(Sources{CPU: newFakeSources(), Memory: newFakeSources(), Disk: newFakeSources(), Host: newFakeSources()})
+	for _, cs := range m.registry.collectors {
+		switch cs.collector.Name() {
+		case "cpu", "memory", "disk", "diskio":
+			cs.run(context.Background())
+		}
+	}
+	return m
+}
+
+// sample returns a stored-style sample with a distinct timestamp
+func sample(i int) SystemStats {
+	return SystemStats{
+		Timestamp:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(i) * 2 * time.Second),
+		CPUPercent: float64(i),
+	}
+}
+
+func TestSelectHistory(t *testing.T) {
+	var stats []SystemStats
+	for i := 0; i < 120; i++ {
+		stats = append(stats, sample(i))
+	}
+
+	cases := []struct {
+		query     string
+		wantLen   int
+		wantFirst float64
+	}{
+		{"", 50, 70},
+		{"limit=10", 10, 110},
+		{"limit=500", 120, 0},
+		{"limit=0", 50, 70},
+		{"limit=-5", 50, 70},
+		{"limit=abc", 50, 70},
+		{"from=2024-01-01T00:03:00Z", 30, 90},
+		{"from=2024-01-01T00:03:00Z&limit=5", 5, 115},
+		{"from=2024-01-01T00:00:00Z&to=2024-01-01T00:00:10Z", 6, 0},
+		{"from=2030-01-01T00:00:00Z", 0, 0},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/api/stats/history?"+c.query, nil)
+		got, err := selectHistory(stats, r, defaultHistoryLimit)
+		if err != nil {
+			t.Fatalf("selectHistory(%q) error: %v", c.query, err)
+		}
+		if len(got) != c.wantLen {
+			t.Fatalf("selectHistory(%q) returned %d samples want %d", c.query, len(got), c.wantLen)
+		}
+		if len(got) > 0 && got[0].CPUPercent != c.wantFirst {
+			t.Fatalf("selectHistory(%q) starts at %v want %v", c.query, got[0].CPUPercent, c.wantFirst)
+		}
+	}
+
+	for _, query := range []string{"from=yesterday", "from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z"} {
+		r := httptest.NewRequest("GET", "/api/stats/history?"+query, nil)
+		if _, err := selectHistory(stats, r, defaultHistoryLimit); err == nil {
+			t.Fatalf("selectHistory(%q) should fail", query)
+		}
+	}
+}
+
+func TestStoreTrimsHistory(t *testing.T) {
+	max := defaultConfig().maxSamples()
+	cases := []struct {
+		stored    int
+		wantLen   int
+		wantFirst float64
+	}{
+		{1, 1, 0},
+		{max, max, 0},
+		{max + 1, max, 1},
+		{max + 25, max, 25},
+	}
+	for _, c := range cases {
+		m := newTestMonitor(t)
+		for i := 0; i < c.stored; i++ {
+			m.store(sample(i))
+		}
+		if len(m.stats) != c.wantLen {
+			t.Fatalf("after storing %d samples len=%d want %d", c.stored, len(m.stats), c.wantLen)
+		}
+		if m.stats[0].CPUPercent != c.wantFirst {
+			t.Fatalf("after storing %d samples oldest=%v want %v", c.stored, m.stats[0].CPUPercent, c.wantFirst)
+		}
+	}
+}
+
+func TestAPIHandlers(t *testing.T) {
+	m := newTestMonitor(t)
+	for i := 0; i < 3; i++ {
+		m.store(sample(i))
+	}
+	server := httptest.NewServer(newRouter(m))
+	defer server.Close()
+
+	cases := []struct {
+		path   string
+		status int
+		check  func(t *testing.T, body []byte)
+	}{
+		{"/api/stats/current", http.StatusOK, func(t *testing.T, body []byte) {
+			var stats SystemStats
+			json.Unmarshal(body, &stats)
+			if stats.CPUPercent != 20 || len(stats.CPUPerCore) != 2 {
+				t.Fatalf("cpu=%v per core=%v want 20 over 2 cores", stats.CPUPercent, stats.CPUPerCore)
+			}
+			if stats.MemoryUsed != 2000 || stats.MemoryPercent != 25 || stats.SwapPercent != 10 {
+				t.Fatalf("memory=%v (%v%%) swap=%v%% want 2000 (25%%) and 10%%", stats.MemoryUsed, stats.MemoryPercent, stats.SwapPercent)
+			}
+			if stats.DiskUsed != 200 || len(stats.Partitions) != 1 || len(stats.DiskIO) != 1 {
+				t.Fatalf("disk=%v partitions=%d devices=%d want 200, 1 and 1", stats.DiskUsed, len(stats.Partitions), len(stats.DiskIO))
+			}
+		}},
+		{"/api/stats/history", http.StatusOK, func(t *testing.T, body []byte) {
+			var history []SystemStats
+			json.Unmarshal(body, &history)
+			if len(history) != 3 || history[2].CPUPercent != 2 {
+				t.Fatalf("history=%v want the 3 stored samples", history)
+			}
+		}},
+		{"/api/stats/history?limit=1", http.StatusOK, func(t *testing.T, body []byte) {
+			var history []SystemStats
+			json.Unmarshal(body, &history)
+			if len(history) != 1 || history[0].CPUPercent != 2 {
+				t.Fatalf("history=%v want only the newest sample", history)
+			}
+		}},
+		{"/api/stats/history?from=soon", http.StatusBadRequest, func(t *testing.T, body []byte) {
+			if !strings.Contains(string(body), "invalid from time") {
+				t.Fatalf("body=%s want an invalid from error", body)
+			}
+		}},
+		{"/api/system/info", http.StatusOK, func(t *testing.T, body []byte) {
+			var info SystemInfo
+			json.Unmarshal(body, &info)
+			if info.Hostname != "test-host" || info.Platform != "testos" || info.Uptime != 3600 {
+				t.Fatalf("info=%+v want the fake host", info)
+			}
+		}},
+	}
+	for _, c := range cases {
+		resp, err := http.Get(server.URL + c.path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", c.path, err)
+		}
+		var body json.RawMessage
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status {
+			t.Fatalf("GET %s status=%d want %d", c.path, resp.StatusCode, c.status)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("GET %s content type=%q want application/json", c.path, ct)
+		}
+		c.check(t, body)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	m := newTestMonitor(t)
+	m.store(m.collectStats())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.hub.run(ctx)
+
+	server := httptest.NewServer(newRouter(m))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	read := func() map[string]json.RawMessage {
+		t.Helper()
+		var msg map[string]json.RawMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	// The latest sample is sent straight away
+	first := read()
+	if string(first["cpu_percent"]) != "20" || string(first["memory_used"]) != "2000" {
+		t.Fatalf("first message cpu=%s memory=%s want 20 and 2000", first["cpu_percent"], first["memory_used"])
+	}
+
+	cases := []struct {
+		request string
+		want    []string // fields expected in the next message
+		absent  []string
+	}{
+		{`{"type":"subscribe","groups":["nope"]}`, []string{"type", "error"}, nil},
+		{`{"type":"subscribe","interval":"soon"}`, []string{"type", "error"}, nil},
+		{`not json`, []string{"type", "error"}, nil},
+		{`{"type":"subscribe","groups":["cpu"]}`, []string{"timestamp", "cpu_percent", "cpu_per_core"}, []string{"memory_used", "load1"}},
+		{`{"type":"subscribe","groups":["memory","load"]}`, []string{"memory_used", "swap_percent", "load1"}, []string{"cpu_percent"}},
+		{`{"type":"subscribe"}`, []string{"cpu_percent", "memory_used", "disk_used"}, nil},
+	}
+	for _, c := range cases {
+		conn.WriteMessage(websocket.TextMessage, []byte(c.request))
+		if c.want[0] != "type" {
+			// The hub handles messages in order, so once this error reply
+			// arrives the subscription above is in effect
+			conn.WriteMessage(websocket.TextMessage, []byte(`{}`))
+			read()
+			m.hub.publish(m.collectStats())
+		}
+		msg := read()
+		for _, field := range c.want {
+			if _, ok := msg[field]; !ok {
+				t.Fatalf("after %s message %v lacks %s", c.request, keys(msg), field)
+			}
+		}
+		for _, field := range c.absent {
+			if _, ok := msg[field]; ok {
+				t.Fatalf("after %s message %v has %s", c.request, keys(msg), field)
+			}
+		}
+	}
+}
+
+func TestWebSocketGroups(t *testing.T) {
+	m := newTestMonitor(t)
+	m.store(m.collectStats())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.hub.run(ctx)
+
+	server := httptest.NewServer(newRouter(m))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url+"?groups=nope", nil); err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("dial with an unknown group: %v want status 400", err)
+	}
+
+	// dial connects with the given query and waits until the hub has
+	// registered the client, returning the first sample it was sent
+	dial := func(query string) (*websocket.Conn, map[string]json.RawMessage) {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial(url+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var first, reply map[string]json.RawMessage
+		if err := conn.ReadJSON(&first); err != nil {
+			t.Fatal(err)
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`{}`))
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatal(err)
+		}
+		return conn, first
+	}
+
+	cpu, first := dial("?groups=cpu")
+	if _, ok := first["cpu_percent"]; !ok {
+		t.Fatalf("first message %v lacks cpu_percent", keys(first))
+	}
+	if _, ok := first["memory_used"]; ok {
+		t.Fatalf("first message %v has memory_used with only cpu subscribed", keys(first))
+	}
+	logs, _ := dial("?groups=logs")
+	all, first := dial("")
+	if _, ok := first["memory_used"]; !ok {
+		t.Fatalf("first message %v lacks memory_used with every group subscribed", keys(first))
+	}
+
+	// Once the logs client has the line every client has been offered it
+	m.hub.publishLog(LogLine{Type: "log", Timestamp: time.Now(), File: "app.log", Rule: "error", Line: "boom"})
+	var msg map[string]json.RawMessage
+	if err := logs.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if string(msg["type"]) != `"log"` {
+		t.Fatalf("logs client got %v want the log line", keys(msg))
+	}
+	m.hub.publish(m.collectStats())
+	for name, conn := range map[string]*websocket.Conn{"cpu": cpu, "all": all} {
+		msg = nil
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := msg["type"]; ok {
+			t.Fatalf("%s client got %v want the sample and no log line", name, keys(msg))
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	m := newTestMonitor(t)
+	m.store(m.collectStats())
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		m.run(ctx)
+		close(stopped)
+	}()
+
+	server := httptest.NewServer(newRouter(m))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	conn.ReadMessage() // the latest sample
+
+	cancel()
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue // a sample sent just before the shutdown
+		}
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Fatalf("read after shutdown: %v want a going away close frame", err)
+		}
+		break
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("monitor still running after shutdown")
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	m := newTestMonitor(t)
+	now := time.Now()
+	for _, age := range []time.Duration{10 * time.Minute, 2 * time.Minute, time.Minute} {
+		m.store(SystemStats{Timestamp: now.Add(-age), CPUPercent: age.Minutes()})
+	}
+	if err := m.saveHistory(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Samples older than the default retention are dropped on load
+	restored := newTestMonitor(t)
+	if err := restored.loadHistory(path); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.stats) != 2 || restored.stats[0].CPUPercent != 2 || restored.stats[1].CPUPercent != 1 {
+		t.Fatalf("restored %v want the samples from 2 and 1 minutes ago", restored.stats)
+	}
+	if err := restored.loadHistory(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("loading a missing file returned %v want not exist", err)
+	}
+}
+
+func keys(msg map[string]json.RawMessage) []string {
+	var names []string
+	for name := range msg {
+		names = append(names, name)
+	}
+	return names
+}
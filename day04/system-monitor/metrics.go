@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// promWriter writes metrics in the Prometheus text exposition format
+type promWriter struct {
+	w      *bufio.Writer
+	labels []string // constant label pairs added to every series
+}
+
+// family writes the HELP and TYPE header for a metric family
+func (p *promWriter) family(name, help, kind string) {
+	p.w.WriteString("# HELP " + name + " " + help + "\n")
+	p.w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// sample writes a single series; labels are given as name/value pairs
+func (p *promWriter) sample(name string, value float64, labels ...string) {
+	p.w.WriteString(name)
+	all := append(append([]string{}, p.labels...), labels...)
+	if len(all) > 0 {
+		p.w.WriteByte('{')
+		for i := 0; i+1 < len(all); i += 2 {
+			if i > 0 {
+				p.w.WriteByte(',')
+			}
+			p.w.WriteString(all[i] + `="` + escapeLabel(all[i+1]) + `"`)
+		}
+		p.w.WriteByte('}')
+	}
+	p.w.WriteByte(' ')
+	p.w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	p.w.WriteByte('\n')
+}
+
+// gauge writes a metric family with a single unlabelled series
+func (p *promWriter) gauge(name, help string, value float64) {
+	p.family(name, help, "gauge")
+	p.sample(name, value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// handleMetrics exposes system and runtime stats for Prometheus scraping
+func (m *Monitor) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	// Prefer the last sample so scrapes don't block on the CPU window
+	m.statsMu.RLock()
+	var stats SystemStats
+	if len(m.stats) > 0 {
+		stats = m.stats[len(m.stats)-1]
+	}
+	m.statsMu.RUnlock()
+	if stats.Timestamp.IsZero() {
+		stats = m.collectStats()
+	}
+
+	info := m.systemInfo()
+	p := &promWriter{w: bufio.NewWriter(w), labels: []string{"host", info.Hostname}}
+	defer p.w.Flush()
+
+	p.family("sysmon_host_info", "Static host information.", "gauge")
+	p.sample("sysmon_host_info", 1,
+		"os", info.OS,
+		"platform", info.Platform,
+		"platform_family", info.PlatformFamily,
+		"platform_version", info.PlatformVersion)
+	p.gauge("sysmon_host_uptime_seconds", "Host uptime in seconds.", float64(info.Uptime))
+	p.gauge("sysmon_cpu_cores", "Number of logical CPU cores.", float64(info.CPUCores))
+
+	// SystemStats fields
+	p.gauge("sysmon_cpu_percent", "Aggregate CPU usage percentage.", stats.CPUPercent)
+	p.gauge("sysmon_memory_total_bytes", "Total physical memory in bytes.", float64(stats.MemoryTotal))
+	p.gauge("sysmon_memory_used_bytes", "Used physical memory in bytes.", float64(stats.MemoryUsed))
+	p.gauge("sysmon_memory_percent", "Physical memory usage percentage.", stats.MemoryPercent)
+	p.gauge("sysmon_disk_total_bytes", "Total size of the root filesystem in bytes.", float64(stats.DiskTotal))
+	p.gauge("sysmon_disk_used_bytes", "Used space on the root filesystem in bytes.", float64(stats.DiskUsed))
+	p.gauge("sysmon_disk_percent", "Root filesystem usage percentage.", stats.DiskPercent)
+	p.gauge("sysmon_goroutines", "Goroutines in the monitor at sample time.", float64(stats.Goroutines))
+
+	p.gauge("sysmon_swap_total_bytes", "Total swap space in bytes.", float64(stats.SwapTotal))
+	p.gauge("sysmon_swap_used_bytes", "Used swap space in bytes.", float64(stats.SwapUsed))
+	p.gauge("sysmon_swap_percent", "Swap usage percentage.", stats.SwapPercent)
+	p.gauge("sysmon_load1", "1-minute load average.", stats.Load1)
+	p.gauge("sysmon_load5", "5-minute load average.", stats.Load5)
+	p.gauge("sysmon_load15", "15-minute load average.", stats.Load15)
+
+	writeCPUCoreMetrics(p, stats.CPUPerCore)
+	writeFilesystemMetrics(p, stats.Partitions)
+	writeDiskIOMetrics(p, stats.DiskIO)
+	writeNetworkMetrics(p, stats.Network)
+	writeContainerMetrics(p, stats.Container)
+	writeLogMetrics(p, stats.Logs)
+	writeProbeMetrics(p, stats.Probes)
+	writeCollectorMetrics(p, m.registry.Status())
+	writeForecastMetrics(p, m.anomalies.Forecasts(), stats.Timestamp)
+	writeRuntimeMetrics(p)
+}
+
+// writeCollectorMetrics writes collector health plus the metrics of
+// custom collectors, which the typed SystemStats fields don't cover
+func writeCollectorMetrics(p *promWriter, statuses []CollectorStatus) {
+	p.family("sysmon_collector_up", "Whether the collector's last run succeeded.", "gauge")
+	for _, s := range statuses {
+		up := 1.0
+		if s.Error != "" || s.LastRun.IsZero() {
+			up = 0
+		}
+		p.sample("sysmon_collector_up", up, "collector", s.Name)
+	}
+	p.family("sysmon_collector_duration_seconds", "Duration of the collector's last run.", "gauge")
+	for _, s := range statuses {
+		p.sample("sysmon_collector_duration_seconds", s.DurationMS/1000, "collector", s.Name)
+	}
+
+	// Group custom metrics into families so each family is contiguous
+	families := make(map[string][]labelledValue)
+	var names []string
+	for _, s := range statuses {
+		if builtinCollectors[s.Name] || strings.HasPrefix(s.Name, probeCollectorPrefix) {
+			continue
+		}
+		for _, metric := range s.Metrics {
+			name := "sysmon_custom_" + sanitizeMetricName(metric.Name)
+			if _, ok := families[name]; !ok {
+				names = append(names, name)
+			}
+			labels := []string{"collector", s.Name}
+			keys := make([]string, 0, len(metric.Labels))
+			for k := range metric.Labels {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			used := map[string]bool{}
+			for _, k := range keys {
+				name := sanitizeLabelName(k)
+				if reservedLabels[name] {
+					name = "exported_" + name
+				}
+				if used[name] {
+					continue // another key sanitized to the same name
+				}
+				used[name] = true
+				labels = append(labels, name, metric.Labels[k])
+			}
+			families[name] = append(families[name], labelledValue{labels, metric.Value})
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p.family(name, "Custom collector metric.", "untyped")
+		for _, lv := range families[name] {
+			p.sample(name, lv.value, lv.labels...)
+		}
+	}
+}
+
+type labelledValue struct {
+	labels []string
+	value  float64
+}
+
+// reservedLabels are set by the monitor on every custom metric; a
+// collector's own labels with these names are renamed exported_<name>,
+// as Prometheus does for clashing target labels
+var reservedLabels = map[string]bool{"collector": true, "host": true}
+
+// sanitizeLabelName makes name a valid label name, [a-zA-Z_][a-zA-Z0-9_]*
+func sanitizeLabelName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// sanitizeMetricName replaces characters that are invalid in metric
+// names with underscores
+func sanitizeMetricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// writeCPUCoreMetrics writes CPU usage per logical core
+func writeCPUCoreMetrics(p *promWriter, perCore []float64) {
+	if len(perCore) == 0 {
+		return
+	}
+	p.family("sysmon_cpu_core_percent", "CPU usage percentage per logical core.", "gauge")
+	for i, pct := range perCore {
+		p.sample("sysmon_cpu_core_percent", pct, "core", strconv.Itoa(i))
+	}
+}
+
+// writeFilesystemMetrics writes usage for every mounted partition
+func writeFilesystemMetrics(p *promWriter, partitions []PartitionStats) {
+	if len(partitions) == 0 {
+		return
+	}
+
+	families := []struct {
+		name, help string
+		value      func(ps PartitionStats) float64
+	}{
+		{"sysmon_filesystem_total_bytes", "Filesystem size in bytes.", func(ps PartitionStats) float64 { return float64(ps.Total) }},
+		{"sysmon_filesystem_used_bytes", "Filesystem used space in bytes.", func(ps PartitionStats) float64 { return float64(ps.Used) }},
+		{"sysmon_filesystem_free_bytes", "Filesystem free space in bytes.", func(ps PartitionStats) float64 { return float64(ps.Free) }},
+		{"sysmon_filesystem_percent", "Filesystem usage percentage.", func(ps PartitionStats) float64 { return ps.UsedPercent }},
+	}
+	for _, f := range families {
+		p.family(f.name, f.help, "gauge")
+		for _, ps := range partitions {
+			p.sample(f.name, f.value(ps),
+				"mountpoint", ps.Mountpoint,
+				"device", ps.Device,
+				"fstype", ps.Fstype)
+		}
+	}
+}
+
+// writeDiskIOMetrics writes read/write rates per block device
+func writeDiskIOMetrics(p *promWriter, diskIO []DiskIOStats) {
+	if len(diskIO) == 0 {
+		return
+	}
+
+	families := []struct {
+		name, help string
+		value      func(d DiskIOStats) float64
+	}{
+		{"sysmon_disk_read_iops", "Read operations per second per device.", func(d DiskIOStats) float64 { return d.ReadIOPS }},
+		{"sysmon_disk_write_iops", "Write operations per second per device.", func(d DiskIOStats) float64 { return d.WriteIOPS }},
+		{"sysmon_disk_read_bytes_per_second", "Bytes read per second per device.", func(d DiskIOStats) float64 { return d.ReadBytesPS }},
+		{"sysmon_disk_write_bytes_per_second", "Bytes written per second per device.", func(d DiskIOStats) float64 { return d.WriteBytesPS }},
+	}
+	for _, f := range families {
+		p.family(f.name, f.help, "gauge")
+		for _, d := range diskIO {
+			p.sample(f.name, f.value(d), "device", d.Device)
+		}
+	}
+}
+
+// writeNetworkMetrics writes per-interface network counters and rates
+func writeNetworkMetrics(p *promWriter, network []NetworkStats) {
+	if len(network) == 0 {
+		return
+	}
+
+	families := []struct {
+		name, help, kind string
+		value            func(n NetworkStats) float64
+	}{
+		{"sysmon_network_receive_bytes_total", "Bytes received per interface.", "counter", func(n NetworkStats) float64 { return float64(n.BytesRecv) }},
+		{"sysmon_network_transmit_bytes_total", "Bytes sent per interface.", "counter", func(n NetworkStats) float64 { return float64(n.BytesSent) }},
+		{"sysmon_network_receive_packets_total", "Packets received per interface.", "counter", func(n NetworkStats) float64 { return float64(n.PacketsRecv) }},
+		{"sysmon_network_transmit_packets_total", "Packets sent per interface.", "counter", func(n NetworkStats) float64 { return float64(n.PacketsSent) }},
+		{"sysmon_network_errors_total", "Receive and transmit errors per interface.", "counter", func(n NetworkStats) float64 { return float64(n.Errors) }},
+		{"sysmon_network_drops_total", "Dropped packets per interface.", "counter", func(n NetworkStats) float64 { return float64(n.Drops) }},
+		{"sysmon_network_receive_bytes_per_second", "Receive throughput per interface.", "gauge", func(n NetworkStats) float64 { return n.RxBytesPS }},
+		{"sysmon_network_transmit_bytes_per_second", "Transmit throughput per interface.", "gauge", func(n NetworkStats) float64 { return n.TxBytesPS }},
+	}
+	for _, f := range families {
+		p.family(f.name, f.help, f.kind)
+		for _, n := range network {
+			p.sample(f.name, f.value(n), "interface", n.Interface)
+		}
+	}
+}
+
+// writeContainerMetrics writes the monitor's own cgroup usage and limits;
+// limits that aren't set are left out
+func writeContainerMetrics(p *promWriter, c *ContainerStats) {
+	if c == nil {
+		return
+	}
+	inContainer := 0.0
+	if c.InContainer {
+		inContainer = 1
+	}
+	p.family("sysmon_container_info", "The monitor's cgroup and whether it runs in a container.", "gauge")
+	p.sample("sysmon_container_info", inContainer, "cgroup", c.Cgroup, "runtime", c.Runtime)
+	p.gauge("sysmon_container_cpu_percent", "Cgroup CPU usage relative to its quota.", c.CPUPercent)
+	p.family("sysmon_container_cpu_usage_seconds_total", "CPU time used by the cgroup.", "counter")
+	p.sample("sysmon_container_cpu_usage_seconds_total", c.CPUUsageSeconds)
+	p.family("sysmon_container_cpu_throttled_periods_total", "Enforcement periods in which the cgroup was throttled.", "counter")
+	p.sample("sysmon_container_cpu_throttled_periods_total", float64(c.ThrottledPeriods))
+	p.family("sysmon_container_cpu_throttled_seconds_total", "Time the cgroup spent throttled.", "counter")
+	p.sample("sysmon_container_cpu_throttled_seconds_total", c.ThrottledSeconds)
+	p.gauge("sysmon_container_memory_used_bytes", "Memory charged to the cgroup.", float64(c.MemoryUsed))
+	p.gauge("sysmon_container_swap_used_bytes", "Swap charged to the cgroup.", float64(c.SwapUsed))
+	p.family("sysmon_container_oom_kills_total", "Processes in the cgroup killed by the OOM killer.", "counter")
+	p.sample("sysmon_container_oom_kills_total", float64(c.OOMKills))
+	p.gauge("sysmon_container_pids", "Processes and threads in the cgroup.", float64(c.PIDs))
+	if c.CPUQuotaCores > 0 {
+		p.gauge("sysmon_container_cpu_quota_cores", "Cgroup CPU limit in cores.", c.CPUQuotaCores)
+	}
+	if c.MemoryLimit > 0 {
+		p.gauge("sysmon_container_memory_limit_bytes", "Cgroup memory limit.", float64(c.MemoryLimit))
+	}
+	if c.PIDsLimit > 0 {
+		p.gauge("sysmon_container_pids_limit", "Cgroup process limit.", float64(c.PIDsLimit))
+	}
+}
+
+// writeLogMetrics writes how often each log rule has matched
+func writeLogMetrics(p *promWriter, logs []LogRuleStats) {
+	if len(logs) == 0 {
+		return
+	}
+	p.family("sysmon_log_matches_per_minute", "Log lines matching the rule in the last minute.", "gauge")
+	for _, l := range logs {
+		p.sample("sysmon_log_matches_per_minute", float64(l.PerMinute), "file", l.File, "rule", l.Rule)
+	}
+	p.family("sysmon_log_matches_total", "Log lines matching the rule since the monitor started.", "counter")
+	for _, l := range logs {
+		p.sample("sysmon_log_matches_total", float64(l.Total), "file", l.File, "rule", l.Rule)
+	}
+}
+
+// writeProbeMetrics writes the latest result and uptime of every probe
+func writeProbeMetrics(p *promWriter, probes []ProbeStatus) {
+	if len(probes) == 0 {
+		return
+	}
+
+	families := []struct {
+		name, help string
+		value      func(s ProbeStatus) float64
+	}{
+		{"sysmon_probe_up", "Whether the probe's last check succeeded.", func(s ProbeStatus) float64 {
+			if s.Up {
+				return 1
+			}
+			return 0
+		}},
+		{"sysmon_probe_latency_seconds", "Duration of the probe's last check.", func(s ProbeStatus) float64 { return s.LatencyMS / 1000 }},
+		{"sysmon_probe_uptime_percent", "Share of the probe's recent checks that succeeded.", func(s ProbeStatus) float64 { return s.UptimePercent }},
+	}
+	for _, f := range families {
+		p.family(f.name, f.help, "gauge")
+		for _, s := range probes {
+			p.sample(f.name, f.value(s), "probe", s.Name, "type", s.Type, "target", s.Target)
+		}
+	}
+}
+
+// writeForecastMetrics writes the projected time until disk and memory
+// run out; resources that aren't growing have no series
+func writeForecastMetrics(p *promWriter, forecasts []Forecast, now time.Time) {
+	p.family("sysmon_exhaustion_seconds", "Projected seconds until the resource reaches its limit.", "gauge")
+	for _, f := range forecasts {
+		if f.ExhaustedAt != nil {
+			p.sample("sysmon_exhaustion_seconds", f.ExhaustedAt.Sub(now).Seconds(), "resource", f.Metric)
+		}
+	}
+	p.family("sysmon_growth_per_hour", "Fitted growth of the resource per hour.", "gauge")
+	for _, f := range forecasts {
+		p.sample("sysmon_growth_per_hour", f.GrowthPerHour, "resource", f.Metric)
+	}
+}
+
+// writeRuntimeMetrics writes Go runtime stats for the monitor process itself
+func writeRuntimeMetrics(p *promWriter) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	p.gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine()))
+	p.gauge("go_memstats_alloc_bytes", "Bytes of allocated heap objects.", float64(ms.Alloc))
+	p.gauge("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", float64(ms.Sys))
+	p.gauge("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", float64(ms.HeapInuse))
+	p.gauge("go_memstats_heap_objects", "Number of allocated heap objects.", float64(ms.HeapObjects))
+
+	p.family("go_memstats_mallocs_total", "Cumulative count of heap objects allocated.", "counter")
+	p.sample("go_memstats_mallocs_total", float64(ms.Mallocs))
+	p.family("go_memstats_frees_total", "Cumulative count of heap objects freed.", "counter")
+	p.sample("go_memstats_frees_total", float64(ms.Frees))
+	p.family("go_gc_cycles_total", "Number of completed GC cycles.", "counter")
+	p.sample("go_gc_cycles_total", float64(ms.NumGC))
+	p.family("go_gc_pause_seconds_total", "Cumulative GC stop-the-world pause time.", "counter")
+	p.sample("go_gc_pause_seconds_total", float64(ms.PauseTotalNs)/1e9)
+
+	p.family("go_info", "Go runtime version.", "gauge")
+	p.sample("go_info", 1, "version", runtime.Version())
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+// staticCollector returns the same metrics on every run
+type staticCollector struct {
+	name    string
+	metrics []Metric
+}
+
+func (c staticCollector) Name() string            { return c.name }
+func (c staticCollector) Interval() time.Duration { return time.Minute }
+
+func (c staticCollector) Collect(ctx context.Context) ([]Metric, error) {
+	return c.metrics, nil
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"queue", "queue"},
+		{"queue:depth", "queue_depth"},
+		{"http-status", "http_status"},
+		{"9lives", "_9lives"},
+		{"", "_"},
+		{"Zone_2", "Zone_2"},
+	}
+	for _, c := range cases {
+		if got := sanitizeLabelName(c.name); got != c.want {
+			t.Fatalf("sanitizeLabelName(%q)=%q want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	m := newTestMonitor(t)
+	custom := staticCollector{name: "queues", metrics: []Metric{
+		{Name: "queue_depth", Value: 7, Labels: map[string]string{
+			"queue:name": "mail",
+			"collector":  "spoofed",
+			"host":       "elsewhere",
+			"9lives":     "yes",
+		}},
+		// Both keys sanitize to the same label name
+		{Name: "queue_age", Value: 30, Labels: map[string]string{"a-b": "first", "a_b": "second"}},
+	}}
+	if err := m.registry.Register(custom); err != nil {
+		t.Fatal(err)
+	}
+	for _, cs := range m.registry.collectors {
+		if cs.collector.Name() == custom.name {
+			cs.run(context.Background())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	m.handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d want 200", w.Code)
+	}
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(w.Body)
+	if err != nil {
+		t.Fatalf("scrape rejected: %v", err)
+	}
+
+	if mf := families["sysmon_cpu_percent"]; mf == nil || mf.GetMetric()[0].GetGauge().GetValue() != 20 {
+		t.Fatalf("sysmon_cpu_percent=%v want 20", mf)
+	}
+	cases := []struct {
+		family string
+		labels map[string]string
+	}{
+		{"sysmon_custom_queue_depth", map[string]string{
+			"host": "test-host", "collector": "queues", "queue_name": "mail",
+			"exported_collector": "spoofed", "exported_host": "elsewhere", "_9lives": "yes",
+		}},
+		{"sysmon_custom_queue_age", map[string]string{"host": "test-host", "collector": "queues", "a_b": "first"}},
+	}
+	for _, c := range cases {
+		mf := families[c.family]
+		if mf == nil || len(mf.GetMetric()) != 1 {
+			t.Fatalf("%s=%v want one series", c.family, mf)
+		}
+		got := map[string]string{}
+		for _, l := range mf.GetMetric()[0].GetLabel() {
+			got[l.GetName()] = l.GetValue()
+		}
+		if len(got) != len(c.labels) {
+			t.Fatalf("%s labels=%v want %v", c.family, got, c.labels)
+		}
+		for k, v := range c.labels {
+			if got[k] != v {
+				t.Fatalf("%s labels=%v want %v", c.family, got, c.labels)
+			}
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// probeCollectorPrefix names the collector that runs each probe
+	probeCollectorPrefix = "probe:"
+	// probeHistorySize is how many results are kept per probe
+	probeHistorySize = 1000
+	// probeCriticalFailures is how many failures in a row turn a probe
+	// alert from warning to critical
+	probeCriticalFailures = 3
+	// maxProbeBody is how much of an HTTP response is matched against
+	maxProbeBody = 1 << 20
+)
+
+// ProbeConfig is a synthetic check of a service the host provides or
+// depends on. Target is a URL for "http", host:port for "tcp" and a
+// host name for "dns".
+type ProbeConfig struct {
+	Name     string        `yaml:"name"`
+	Type     string        `yaml:"type"`
+	Target   string        `yaml:"target"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	// ExpectStatus is the HTTP status a healthy service answers with
+	ExpectStatus int `yaml:"expect_status"`
+	// ExpectBody, if set, is a regular expression the HTTP body must match
+	ExpectBody string `yaml:"expect_body"`
+	// Server is the DNS server to ask instead of the system resolver
+	Server string `yaml:"server"`
+}
+
+// withDefaults fills in the optional settings
+func (c ProbeConfig) withDefaults() ProbeConfig {
+	if c.Interval == 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.Timeout == 0 {
+		c.Timeout = min(5*time.Second, c.Interval)
+	}
+	if c.Type == "http" && c.ExpectStatus == 0 {
+		c.ExpectStatus = http.StatusOK
+	}
+	return c
+}
+
+// validateProbes checks the probe settings of a config
+func validateProbes(probes []ProbeConfig) error {
+	seen := make(map[string]bool)
+	for _, p := range probes {
+		if p.Name == "" || seen[p.Name] {
+			return fmt.Errorf("probes: every probe needs a unique name")
+		}
+		seen[p.Name] = true
+
+		p = p.withDefaults()
+		switch {
+		case p.Target == "":
+			return fmt.Errorf("probe %s: target must not be empty", p.Name)
+		case p.Interval < time.Second:
+			return fmt.Errorf("probe %s: interval must be at least 1s", p.Name)
+		case p.Timeout <= 0 || p.Timeout > p.Interval:
+			return fmt.Errorf("probe %s: timeout must be positive and at most the interval", p.Name)
+		}
+
+		switch p.Type {
+		case "http":
+			if u, err := url.Parse(p.Target); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("probe %s: target must be an http or https URL", p.Name)
+			}
+			if _, err := regexp.Compile(p.ExpectBody); err != nil {
+				return fmt.Errorf("probe %s: expect_body: %v", p.Name, err)
+			}
+		case "tcp":
+			if _, _, err := net.SplitHostPort(p.Target); err != nil {
+				return fmt.Errorf("probe %s: target must be host:port", p.Name)
+			}
+		case "dns":
+			if p.Server != "" {
+				if _, _, err := net.SplitHostPort(p.Server); err != nil {
+					return fmt.Errorf("probe %s: server must be host:port", p.Name)
+				}
+			}
+		default:
+			return fmt.Errorf("probe %s: type must be http, tcp or dns", p.Name)
+		}
+	}
+	return nil
+}
+
+// ProbeResult is the outcome of a single check
+type ProbeResult struct {
+	Time      time.Time `json:"time"`
+	OK        bool      `json:"ok"`
+	LatencyMS float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ProbeStatus summarises the recent results of a probe
+type ProbeStatus struct {
+	Name                string    `json:"name"`
+	Type                string    `json:"type"`
+	Target              string    `json:"target"`
+	Up                  bool      `json:"up"`
+	LastCheck           time.Time `json:"last_check"`
+	LatencyMS           float64   `json:"latency_ms"`
+	UptimePercent       float64   `json:"uptime_percent"`
+	Checks              int       `json:"checks"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+// probe runs one configured check as a collector and keeps its history
+type probe struct {
+	cfg    ProbeConfig
+	body   *regexp.Regexp // nil when the body isn't checked
+	client *http.Client
+	alerts *Alerts
+
+	mu       sync.RWMutex
+	results  []ProbeResult
+	failures int  // consecutive
+	retired  bool // removed by a reload; a check still running is ignored
+}
+
+// newProbe creates a probe reporting failures to alerts; cfg must have
+// been checked by validateProbes
+func newProbe(cfg ProbeConfig, alerts *Alerts) *probe {
+	cfg = cfg.withDefaults()
+	p := &probe{
+		cfg:    cfg,
+		alerts: alerts,
+		client: &http.Client{
+			// Keep-alives would hide a service that stopped accepting
+			// new connections
+			Transport: &http.Transport{DisableKeepAlives: true, Proxy: http.ProxyFromEnvironment},
+		},
+	}
+	if cfg.ExpectBody != "" {
+		p.body = regexp.MustCompile(cfg.ExpectBody)
+	}
+	return p
+}
+
+func (p *probe) Name() string            { return probeCollectorPrefix + p.cfg.Name }
+func (p *probe) Interval() time.Duration { return p.cfg.Interval }
+
+// Collect runs the check. A failing check is a reading, not a collector
+// error, so it is only reported through the result and the alerts.
+func (p *probe) Collect(parent context.Context) ([]Metric, error) {
+	ctx, cancel := context.WithTimeout(parent, p.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := p.check(ctx)
+	if err != nil && parent.Err() != nil {
+		return nil, parent.Err() // stopped, not failed
+	}
+	result := ProbeResult{Time: start, OK: err == nil, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	p.record(result)
+
+	up := 0.0
+	if result.OK {
+		up = 1
+	}
+	return []Metric{
+		{Name: "probe_up", Value: up},
+		{Name: "probe_latency_ms", Value: result.LatencyMS},
+	}, nil
+}
+
+// check runs the probe once
+func (p *probe) check(ctx context.Context) error {
+	switch p.cfg.Type {
+	case "http":
+		return p.checkHTTP(ctx)
+	case "tcp":
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", p.cfg.Target)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "dns":
+		addrs, err := p.resolver().LookupHost(ctx, p.cfg.Target)
+		if err == nil && len(addrs) == 0 {
+			err = fmt.Errorf("no addresses for %s", p.cfg.Target)
+		}
+		return err
+	}
+	return fmt.Errorf("unknown probe type %s", p.cfg.Type)
+}
+
+func (p *probe) checkHTTP(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.Target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "system-monitor-probe")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != p.cfg.ExpectStatus {
+		return fmt.Errorf("status %d, expected %d", resp.StatusCode, p.cfg.ExpectStatus)
+	}
+	if p.body == nil {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return err
+	}
+	if !p.body.Match(body) {
+		return fmt.Errorf("body does not match %s", p.cfg.ExpectBody)
+	}
+	return nil
+}
+
+// resolver asks the configured DNS server, or the system's
+func (p *probe) resolver() *net.Resolver {
+	if p.cfg.Server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, p.cfg.Server)
+		},
+	}
+}
+
+// record adds a result to the history and raises or resolves the
+// probe's alert
+func (p *probe) record(result ProbeResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.retired {
+		return
+	}
+	p.results = append(p.results, result)
+	if len(p.results) > probeHistorySize {
+		p.results = p.results[1:]
+	}
+	if result.OK {
+		p.failures = 0
+	} else {
+		p.failures++
+	}
+	failures := p.failures
+
+	event := AlertEvent{
+		Time:     result.Time,
+		Source:   "probe",
+		Metric:   p.cfg.Name,
+		Severity: severityResolved,
+		Value:    result.LatencyMS,
+	}
+	if !result.OK {
+		event.Severity = severityWarning
+		if failures >= probeCriticalFailures {
+			event.Severity = severityCritical
+		}
+		event.Message = fmt.Sprintf("%s probe %s (%s) failed: %s (%d in a row)",
+			p.cfg.Type, p.cfg.Name, p.cfg.Target, result.Error, failures)
+	}
+	p.alerts.update(event)
+}
+
+// retire resolves the probe's alert once it has been removed or
+// replaced, so the alert doesn't stay active with nothing to clear it
+func (p *probe) retire(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.retired = true
+	p.alerts.update(AlertEvent{
+		Time:     now,
+		Source:   "probe",
+		Metric:   p.cfg.Name,
+		Severity: severityResolved,
+	})
+}
+
+// status summarises the history
+func (p *probe) status() ProbeStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	s := ProbeStatus{
+		Name:                p.cfg.Name,
+		Type:                p.cfg.Type,
+		Target:              p.cfg.Target,
+		Checks:              len(p.results),
+		ConsecutiveFailures: p.failures,
+	}
+	if len(p.results) == 0 {
+		return s
+	}
+	last := p.results[len(p.results)-1]
+	s.Up, s.LastCheck, s.LatencyMS, s.LastError = last.OK, last.Time, last.LatencyMS, last.Error
+
+	ok := 0
+	for _, r := range p.results {
+		if r.OK {
+			ok++
+		}
+	}
+	s.UptimePercent = float64(ok) / float64(len(p.results)) * 100
+	return s
+}
+
+// between returns the results in [from, to]; zero times are unbounded
+func (p *probe) between(from, to time.Time) []ProbeResult {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	results := []ProbeResult{}
+	for _, r := range p.results {
+		if (from.IsZero() || !r.Time.Before(from)) && (to.IsZero() || !r.Time.After(to)) {
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+func (p *probe) apply(stats *SystemStats) {
+	stats.Probes = append(stats.Probes, p.status())
+}
+
+// applyProbes registers the configured probes. Probes whose settings
+// are unchanged keep running, and keep their history; removed and
+// changed probes have their alerts resolved.
+func (m *Monitor) applyProbes(configs []ProbeConfig) error {
+	m.probesMu.Lock()
+	defer m.probesMu.Unlock()
+
+	wanted := make(map[string]ProbeConfig)
+	for _, cfg := range configs {
+		wanted[cfg.Name] = cfg.withDefaults()
+	}
+	for name, p := range m.probes {
+		if cfg, ok := wanted[name]; !ok || cfg != p.cfg {
+			m.registry.Unregister(p.Name())
+			p.retire(time.Now())
+			delete(m.probes, name)
+		}
+	}
+
+	var errs []error
+	for _, cfg := range configs {
+		if _, running := m.probes[cfg.Name]; running {
+			continue
+		}
+		p := newProbe(cfg, m.alerts)
+		if err := m.registry.Register(p); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m.probes[cfg.Name] = p
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Monitor) handleProbes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	m.probesMu.RLock()
+	defer m.probesMu.RUnlock()
+
+	statuses := []ProbeStatus{}
+	for _, p := range m.probes {
+		statuses = append(statuses, p.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func (m *Monitor) handleProbeHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	m.probesMu.RLock()
+	p, ok := m.probes[mux.Vars(r)["name"]]
+	m.probesMu.RUnlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "unknown probe"})
+		return
+	}
+
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(p.between(from, to))
+}
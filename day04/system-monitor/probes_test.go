@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProbeChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			fmt.Fprint(w, `{"status":"ok","db":"connected"}`)
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// A port nothing listens on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	cases := []struct {
+		cfg     ProbeConfig
+		wantErr string // "" when the check should pass
+	}{
+		{ProbeConfig{Type: "http", Target: server.URL + "/health"}, ""},
+		{ProbeConfig{Type: "http", Target: server.URL + "/health", ExpectBody: `"db":"connected"`}, ""},
+		{ProbeConfig{Type: "http", Target: server.URL + "/health", ExpectBody: `"db":"down"`}, "body does not match"},
+		{ProbeConfig{Type: "http", Target: server.URL + "/missing"}, "status 404, expected 200"},
+		{ProbeConfig{Type: "http", Target: server.URL + "/missing", ExpectStatus: 404}, ""},
+		{ProbeConfig{Type: "http", Target: server.URL + "/slow", Timeout: 100 * time.Millisecond}, "deadline exceeded"},
+		{ProbeConfig{Type: "http", Target: "http://" + closedAddr}, "refused"},
+		{ProbeConfig{Type: "tcp", Target: server.Listener.Addr().String()}, ""},
+		{ProbeConfig{Type: "tcp", Target: closedAddr}, "refused"},
+		{ProbeConfig{Type: "dns", Target: "localhost"}, ""},
+		{ProbeConfig{Type: "dns", Target: "service.invalid", Server: closedAddr, Timeout: time.Second}, "service.invalid"},
+	}
+	for _, c := range cases {
+		c.cfg.Name = "test"
+		if err := validateProbes([]ProbeConfig{c.cfg}); err != nil {
+			t.Fatalf("validateProbes(%+v): %v", c.cfg, err)
+		}
+		p := newProbe(c.cfg, NewAlerts(nil))
+		p.Collect(context.Background())
+
+		s := p.status()
+		if c.wantErr == "" && !s.Up {
+			t.Fatalf("%s %s failed: %s", c.cfg.Type, c.cfg.Target, s.LastError)
+		}
+		if c.wantErr != "" && (s.Up || !strings.Contains(s.LastError, c.wantErr)) {
+			t.Fatalf("%s %s error=%q want %q", c.cfg.Type, c.cfg.Target, s.LastError, c.wantErr)
+		}
+	}
+}
+
+func TestProbeUptimeAndAlerts(t *testing.T) {
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	m := newTestMonitor(t)
+	m.applyProbes([]ProbeConfig{{Name: "api", Type: "http", Target: server.URL}})
+	p := m.probes["api"]
+
+	cases := []struct {
+		healthy      bool
+		wantUptime   float64
+		wantSeverity string // latest alert, "" for none
+	}{
+		{true, 100, ""},
+		{false, 50, severityWarning},
+		{false, 100.0 / 3, severityWarning},
+		{false, 25, severityCritical},
+		{true, 40, severityResolved},
+	}
+	for i, c := range cases {
+		healthy.Store(c.healthy)
+		p.Collect(context.Background())
+
+		s := p.status()
+		if s.Up != c.healthy || math.Abs(s.UptimePercent-c.wantUptime) > 1e-9 || s.Checks != i+1 {
+			t.Fatalf("check %d: up=%v uptime=%v checks=%d want %v, %v and %d", i, s.Up, s.UptimePercent, s.Checks, c.healthy, c.wantUptime, i+1)
+		}
+		events := m.alerts.between(time.Time{}, time.Time{})
+		severity := ""
+		if len(events) > 0 {
+			severity = events[len(events)-1].Severity
+		}
+		if severity != c.wantSeverity {
+			t.Fatalf("check %d: latest alert %q want %q", i, severity, c.wantSeverity)
+		}
+	}
+
+	// Unchanged probes keep their history across a reload
+	m.applyProbes([]ProbeConfig{{Name: "api", Type: "http", Target: server.URL}, {Name: "db", Type: "tcp", Target: "127.0.0.1:5432"}})
+	if m.probes["api"] != p || !m.registry.Registered("probe:db") {
+		t.Fatal("reload replaced an unchanged probe or skipped a new one")
+	}
+	m.applyProbes(nil)
+	if len(m.probes) != 0 || m.registry.Registered("probe:api") {
+		t.Fatal("removed probes are still registered")
+	}
+
+	// A failing probe that is changed or removed has its alert resolved
+	healthy.Store(false)
+	for _, reload := range [][]ProbeConfig{
+		{{Name: "api", Type: "http", Target: server.URL + "/v2"}},
+		nil,
+	} {
+		m.applyProbes([]ProbeConfig{{Name: "api", Type: "http", Target: server.URL}})
+		m.probes["api"].Collect(context.Background())
+		m.applyProbes(reload)
+		events := m.alerts.between(time.Time{}, time.Time{})
+		if last := events[len(events)-1]; last.Metric != "api" || last.Severity != severityResolved {
+			t.Fatalf("after reloading with %v latest alert=%+v want api resolved", reload, last)
+		}
+	}
+	healthy.Store(true)
+
+	// The API reports probes by name
+	m.applyProbes([]ProbeConfig{{Name: "api", Type: "http", Target: server.URL}})
+	m.probes["api"].Collect(context.Background())
+	router := newRouter(m)
+	for _, c := range []struct {
+		path   string
+		status int
+	}{
+		{"/api/probes", http.StatusOK},
+		{"/api/probes/api/history", http.StatusOK},
+		{"/api/probes/nope/history", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", c.path, nil))
+		if rec.Code != c.status {
+			t.Fatalf("GET %s status=%d want %d", c.path, rec.Code, c.status)
+		}
+		var body []json.RawMessage
+		if c.status == http.StatusOK && (json.Unmarshal(rec.Body.Bytes(), &body) != nil || len(body) != 1) {
+			t.Fatalf("GET %s body=%s want one entry", c.path, rec.Body)
+		}
+	}
+}
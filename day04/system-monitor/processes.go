@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcessStats represents resource usage of a single process
+type ProcessStats struct {
+	PID           int32   `json:"pid"`
+	Name          string  `json:"name"`
+	Username      string  `json:"username"`
+	Cmdline       string  `json:"cmdline"`
+	CPUPercent    float64 `json:"cpu_percent"`
+	RSS           uint64  `json:"rss"`
+	MemoryPercent float64 `json:"memory_percent"`
+	Threads       int32   `json:"threads"`
+}
+
+// procKey identifies a process across samples; the create time guards
+// against a recycled PID inheriting another process's CPU history
+type procKey struct {
+	pid     int32
+	created int64
+}
+
+// procSample is what we remember about a process between samples
+type procSample struct {
+	cpuTime  float64 // user + system seconds
+	name     string
+	username string
+	cmdline  string
+}
+
+// processSampler periodically samples every process and computes
+// CPU usage from the change in CPU time between two samples
+type processSampler struct {
+	mu       sync.RWMutex
+	procs    []ProcessStats
+	last     map[procKey]procSample
+	lastTime time.Time
+}
+
+func newProcessSampler() *processSampler {
+	return &processSampler{last: make(map[procKey]procSample)}
+}
+
+func (ps *processSampler) Name() string            { return "processes" }
+func (ps *processSampler) Interval() time.Duration { return 3 * time.Second }
+
+// Collect takes one snapshot of all processes
+func (ps *processSampler) Collect(ctx context.Context) ([]Metric, error) {
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalMem uint64
+	if vm, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+		totalMem = vm.Total
+	}
+
+	// A collector that is unregistered and registered again can briefly
+	// have two loops sampling, so the previous sample is read under the lock
+	ps.mu.RLock()
+	last, lastTime := ps.last, ps.lastTime
+	ps.mu.RUnlock()
+
+	now := time.Now()
+	elapsed := 0.0
+	if !lastTime.IsZero() {
+		elapsed = now.Sub(lastTime).Seconds()
+	}
+
+	current := make(map[procKey]procSample, len(procs))
+	result := make([]ProcessStats, 0, len(procs))
+	var threads int32
+	for _, p := range procs {
+		// Processes can exit mid-sample; skip anything we can't read
+		created, err := p.CreateTime()
+		if err != nil {
+			continue
+		}
+		times, err := p.Times()
+		if err != nil {
+			continue
+		}
+		key := procKey{p.Pid, created}
+
+		prev, seen := last[key]
+		cur := procSample{cpuTime: times.User + times.System}
+		if seen {
+			cur.name, cur.username, cur.cmdline = prev.name, prev.username, prev.cmdline
+		} else {
+			cur.name, _ = p.Name()
+			cur.username, _ = p.Username()
+			cur.cmdline, _ = p.Cmdline()
+		}
+		current[key] = cur
+
+		stats := ProcessStats{
+			PID:      p.Pid,
+			Name:     cur.name,
+			Username: cur.username,
+			Cmdline:  cur.cmdline,
+		}
+		if seen && elapsed > 0 && cur.cpuTime >= prev.cpuTime {
+			stats.CPUPercent = (cur.cpuTime - prev.cpuTime) / elapsed * 100
+		}
+		if memInfo, err := p.MemoryInfo(); err == nil {
+			stats.RSS = memInfo.RSS
+			if totalMem > 0 {
+				stats.MemoryPercent = float64(memInfo.RSS) / float64(totalMem) * 100
+			}
+		}
+		stats.Threads, _ = p.NumThreads()
+		threads += stats.Threads
+		result = append(result, stats)
+	}
+
+	ps.mu.Lock()
+	ps.procs = result
+	ps.last = current
+	ps.lastTime = now
+	ps.mu.Unlock()
+
+	return []Metric{
+		{Name: "process_count", Value: float64(len(result))},
+		{Name: "process_threads", Value: float64(threads)},
+	}, nil
+}
+
+// processSorters maps the sort query parameter to a "less" function
+// that orders the biggest consumers first
+var processSorters = map[string]func(a, b ProcessStats) bool{
+	"cpu":     func(a, b ProcessStats) bool { return a.CPUPercent > b.CPUPercent },
+	"memory":  func(a, b ProcessStats) bool { return a.RSS > b.RSS },
+	"threads": func(a, b ProcessStats) bool { return a.Threads > b.Threads },
+	"pid":     func(a, b ProcessStats) bool { return a.PID < b.PID },
+	"name":    func(a, b ProcessStats) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) },
+}
+
+// top returns a sorted copy of the latest sample, limited to n entries
+func (ps *processSampler) top(sortBy string, n int) []ProcessStats {
+	less, ok := processSorters[sortBy]
+	if !ok {
+		less = processSorters["cpu"]
+	}
+
+	ps.mu.RLock()
+	procs := make([]ProcessStats, len(ps.procs))
+	copy(procs, ps.procs)
+	ps.mu.RUnlock()
+
+	sort.SliceStable(procs, func(i, j int) bool { return less(procs[i], procs[j]) })
+	if n > 0 && len(procs) > n {
+		procs = procs[:n]
+	}
+	return procs
+}
+
+func (m *Monitor) handleProcesses(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		sortBy = "cpu"
+	}
+	if _, ok := processSorters[sortBy]; !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "sort must be one of cpu, memory, threads, pid, name"})
+		return
+	}
+
+	limit := 20 // default
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	json.NewEncoder(w).Encode(m.processes.top(sortBy, limit))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// defaultReportWindow is reported on when no from time is given
+const defaultReportWindow = time.Hour
+
+// topAlertEvents caps the alert events included in a report
+const topAlertEvents = 10
+
+// MetricSummary aggregates one metric over a report window
+type MetricSummary struct {
+	Metric string  `json:"metric"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Avg    float64 `json:"avg"`
+	P95    float64 `json:"p95"`
+}
+
+// Report summarises the samples and alerts in a time window
+type Report struct {
+	Hostname    string          `json:"hostname"`
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+	Generated   time.Time       `json:"generated"`
+	Samples     int             `json:"samples"`
+	Metrics     []MetricSummary `json:"metrics"`
+	AlertCount  int             `json:"alert_count"`
+	TopAlerts   []AlertEvent    `json:"top_alerts"`
+	AlertCounts map[string]int  `json:"alert_counts"`
+}
+
+// reportTemplate renders a Report as a self-contained HTML page
+var reportTemplate = template.Must(template.New("report.html").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05") },
+}).ParseFS(webFS, "web/templates/report.html"))
+
+// buildReport summarises stats and alert events for [from, to]
+func buildReport(stats []SystemStats, events []AlertEvent, from, to time.Time) Report {
+	hostname, _ := os.Hostname()
+	report := Report{
+		Hostname:    hostname,
+		From:        from,
+		To:          to,
+		Generated:   time.Now(),
+		Samples:     len(stats),
+		Metrics:     []MetricSummary{},
+		AlertCount:  len(events),
+		AlertCounts: make(map[string]int),
+	}
+
+	if len(stats) > 0 {
+		values := make([]float64, len(stats))
+		for _, column := range exportColumns {
+			for i, s := range stats {
+				values[i] = column.value(s)
+			}
+			report.Metrics = append(report.Metrics, summarize(column.name, values))
+		}
+	}
+
+	for _, e := range events {
+		report.AlertCounts[e.Severity]++
+	}
+
+	// Most severe first, then most recent
+	top := append([]AlertEvent{}, events...)
+	sort.SliceStable(top, func(i, j int) bool {
+		if ri, rj := severityRank(top[i].Severity), severityRank(top[j].Severity); ri != rj {
+			return ri < rj
+		}
+		return top[i].Time.After(top[j].Time)
+	})
+	if len(top) > topAlertEvents {
+		top = top[:topAlertEvents]
+	}
+	report.TopAlerts = top
+	return report
+}
+
+// summarize computes min, max, mean and the nearest-rank 95th percentile
+func summarize(name string, values []float64) MetricSummary {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	return MetricSummary{
+		Metric: name,
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		Avg:    sum / float64(len(sorted)),
+		P95:    sorted[rank],
+	}
+}
+
+// handleReport serves a summary of a window as JSON or, with
+// format=html, as a printable page
+func (m *Monitor) handleReport(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r)
+	format := r.URL.Query().Get("format")
+	if err == nil && format != "" && format != "json" && format != "html" {
+		err = fmt.Errorf("invalid format %q: use json or html", format)
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultReportWindow)
+	}
+	report := buildReport(m.historyBetween(from, to), m.alerts.between(from, to), from, to)
+
+	if format == "html" {
+		var page bytes.Buffer
+		if err := reportTemplate.Execute(&page, report); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		page.WriteTo(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
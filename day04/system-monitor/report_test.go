@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarize(t *testing.T) {
+	ramp := make([]float64, 20)
+	for i := range ramp {
+		ramp[i] = float64(20 - i) // 20..1, unsorted
+	}
+
+	cases := []struct {
+		values []float64
+		want   MetricSummary
+	}{
+		{[]float64{42}, MetricSummary{Min: 42, Max: 42, Avg: 42, P95: 42}},
+		{[]float64{3, 1, 2}, MetricSummary{Min: 1, Max: 3, Avg: 2, P95: 3}},
+		// Nearest rank: ceil(0.95*20) = 19th smallest
+		{ramp, MetricSummary{Min: 1, Max: 20, Avg: 10.5, P95: 19}},
+		// ceil(0.95*10) = 10th smallest, so the top value counts
+		{[]float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 100}, MetricSummary{Min: 1, Max: 100, Avg: 10.9, P95: 100}},
+	}
+	for _, c := range cases {
+		c.want.Metric = "cpu_percent"
+		if got := summarize("cpu_percent", c.values); got != c.want {
+			t.Fatalf("summarize(%v)=%+v want %+v", c.values, got, c.want)
+		}
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	stats := fixedHistory(start)
+	events := []AlertEvent{
+		{Time: start.Add(time.Minute), Severity: "warning", Metric: "cpu_percent"},
+		{Time: start.Add(2 * time.Minute), Severity: "critical", Metric: "memory_percent"},
+		{Time: start.Add(3 * time.Minute), Severity: "warning", Metric: "disk_percent"},
+	}
+
+	report := buildReport(stats, events, start, start.Add(4*time.Minute))
+	if report.Samples != 5 || len(report.Metrics) != len(exportColumns) || report.AlertCount != 3 {
+		t.Fatalf("report has %d samples, %d metrics, %d alerts", report.Samples, len(report.Metrics), report.AlertCount)
+	}
+	if cpu := report.Metrics[0]; cpu != (MetricSummary{Metric: "cpu_percent", Min: 10, Max: 50, Avg: 30, P95: 50}) {
+		t.Fatalf("cpu summary=%+v", cpu)
+	}
+	if report.AlertCounts["warning"] != 2 || report.AlertCounts["critical"] != 1 {
+		t.Fatalf("alert counts=%v", report.AlertCounts)
+	}
+	if top := report.TopAlerts; top[0].Severity != "critical" || top[1].Metric != "disk_percent" {
+		t.Fatalf("top alerts=%+v want critical first, then the latest warning", top)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scriptCollector runs an external command and parses its output, one
+// metric per line, in the form:
+//
+//	name value
+//	name{label="value",other="value"} value
+//
+// Blank lines and lines starting with # are ignored. This lets teams add
+// collectors for Docker, nginx status pages or anything else scriptable.
+type scriptCollector struct {
+	name     string
+	interval time.Duration
+	command  string
+	args     []string
+}
+
+// NewScriptCollector creates a collector that runs command on every interval
+func NewScriptCollector(name string, interval time.Duration, command string, args ...string) Collector {
+	return &scriptCollector{name: name, interval: interval, command: command, args: args}
+}
+
+func (s *scriptCollector) Name() string            { return s.name }
+func (s *scriptCollector) Interval() time.Duration { return s.interval }
+
+func (s *scriptCollector) Collect(ctx context.Context) ([]Metric, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.command, s.args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return parseMetricLines(out)
+}
+
+// parseMetricLines parses the script output format described above
+func parseMetricLines(out []byte) ([]Metric, error) {
+	var metrics []Metric
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sep := strings.LastIndexAny(line, " \t")
+		if sep < 0 {
+			return nil, fmt.Errorf("line %d: expected \"name value\"", lineNo)
+		}
+		value, err := strconv.ParseFloat(line[sep+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value: %v", lineNo, err)
+		}
+
+		metric := Metric{Name: strings.TrimSpace(line[:sep]), Value: value}
+		if open := strings.IndexByte(metric.Name, '{'); open >= 0 {
+			if !strings.HasSuffix(metric.Name, "}") {
+				return nil, fmt.Errorf("line %d: unterminated labels", lineNo)
+			}
+			metric.Labels = parseLabels(metric.Name[open+1 : len(metric.Name)-1])
+			metric.Name = metric.Name[:open]
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, scanner.Err()
+}
+
+// parseLabels parses key="value" pairs separated by commas
+func parseLabels(s string) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		labels[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"`)
+	}
+	return labels
+}
+
+// parseScriptCollectors parses the COLLECTOR_SCRIPTS setting, a comma
+// separated list of name=command@interval entries, e.g.
+// "nginx=/usr/local/bin/nginx-status.sh@30s". The interval defaults to 30s.
+func parseScriptCollectors(spec string) ([]Collector, error) {
+	var collectors []Collector
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, command, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || command == "" {
+			return nil, fmt.Errorf("invalid collector script %q: expected name=command[@interval]", entry)
+		}
+		interval := 30 * time.Second
+		if at := strings.LastIndexByte(command, '@'); at >= 0 {
+			d, err := time.ParseDuration(command[at+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid interval for collector %s: %v", name, err)
+			}
+			interval, command = d, command[:at]
+		}
+
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("collector %s has no command", name)
+		}
+		collectors = append(collectors, NewScriptCollector(name, interval, fields[0], fields[1:]...))
+	}
+	return collectors, nil
+}
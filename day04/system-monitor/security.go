@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SecurityConfig controls who may reach the dashboard, API and WebSocket
+type SecurityConfig struct {
+	// AllowedOrigins lists browser origins allowed to call the API and
+	// open WebSockets; same-origin requests are always allowed and "*"
+	// allows any origin, but without credentials
+	AllowedOrigins []string
+	// APIKeys are accepted in the X-API-Key header, as a bearer token,
+	// or in the api_key query parameter of a WebSocket upgrade
+	APIKeys []string
+	// BasicAuthUser and BasicAuthPass enable HTTP basic auth
+	BasicAuthUser string
+	BasicAuthPass string
+	// PublicPaths are served without authentication
+	PublicPaths []string
+	// PublicPrefixes serve every path under them without authentication.
+	// The dashboard pages and scripts hold no data, so they load without
+	// credentials and then send the API key with each request.
+	PublicPrefixes []string
+
+	// TLSCert and TLSKey are PEM files to serve HTTPS with
+	TLSCert string
+	TLSKey  string
+	// TLSSelfSigned serves HTTPS with a generated certificate when no
+	// cert/key files are configured
+	TLSSelfSigned bool
+}
+
+// securityConfigFromEnv reads the security settings from the environment:
+//
+//	ALLOWED_ORIGINS  comma separated origins, e.g. https://ops.example.com
+//	API_KEYS         comma separated API keys
+//	BASIC_AUTH       user:password
+//	PUBLIC_HEALTH    set to "false" to require auth for /api/health
+//	TLS_CERT         certificate file
+//	TLS_KEY          private key file
+//	TLS_SELF_SIGNED  set to "true" to generate a self-signed certificate
+//
+// The dashboard pages are always public. With API_KEYS set they ask for a
+// key once and send it with every API request and WebSocket; with
+// BASIC_AUTH the browser asks for the password instead.
+func securityConfigFromEnv() SecurityConfig {
+	cfg := SecurityConfig{
+		AllowedOrigins: splitList(os.Getenv("ALLOWED_ORIGINS")),
+		APIKeys:        splitList(os.Getenv("API_KEYS")),
+		TLSCert:        os.Getenv("TLS_CERT"),
+		TLSKey:         os.Getenv("TLS_KEY"),
+		TLSSelfSigned:  os.Getenv("TLS_SELF_SIGNED") == "true",
+		PublicPaths:    []string{"/"},
+		PublicPrefixes: []string{"/static/"},
+	}
+	if user, pass, ok := strings.Cut(os.Getenv("BASIC_AUTH"), ":"); ok {
+		cfg.BasicAuthUser, cfg.BasicAuthPass = user, pass
+	}
+	if os.Getenv("PUBLIC_HEALTH") != "false" {
+		cfg.PublicPaths = append(cfg.PublicPaths, "/api/health")
+	}
+	return cfg
+}
+
+// splitList splits a comma separated setting, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// authEnabled reports whether any form of authentication is configured
+func (c SecurityConfig) authEnabled() bool {
+	return len(c.APIKeys) > 0 || c.BasicAuthUser != ""
+}
+
+// tlsEnabled reports whether the server should speak HTTPS
+func (c SecurityConfig) tlsEnabled() bool {
+	return (c.TLSCert != "" && c.TLSKey != "") || c.TLSSelfSigned
+}
+
+// originAllowed reports whether a browser origin may use the API.
+// Requests without an Origin header don't come from a browser page.
+func (c SecurityConfig) originAllowed(r *http.Request) bool {
+	if r.Header.Get("Origin") == "" || c.originTrusted(r) {
+		return true
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// originTrusted reports whether the request comes from this server's own
+// pages or from an origin named in AllowedOrigins. Only those may send
+// credentials; "*" lets any page in, but without them.
+func (c SecurityConfig) originTrusted(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorized checks the request's credentials in constant time
+func (c SecurityConfig) authorized(r *http.Request) bool {
+	if !c.authEnabled() {
+		return true
+	}
+
+	if c.BasicAuthUser != "" {
+		if user, pass, ok := r.BasicAuth(); ok {
+			userOK := subtle.ConstantTimeCompare([]byte(user), []byte(c.BasicAuthUser))
+			passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(c.BasicAuthPass))
+			if userOK&passOK == 1 {
+				return true
+			}
+		}
+	}
+
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if key == "" && websocket.IsWebSocketUpgrade(r) {
+		// Browsers can't set headers on a WebSocket. Anywhere else the
+		// key would end up in proxy and access logs.
+		key = r.URL.Query().Get("api_key")
+	}
+	if key == "" {
+		return false
+	}
+	for _, valid := range c.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(valid)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// isPublic reports whether path is served without authentication
+func (c SecurityConfig) isPublic(path string) bool {
+	for _, public := range c.PublicPaths {
+		if path == public {
+			return true
+		}
+	}
+	for _, prefix := range c.PublicPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrap applies CORS, origin and authentication checks in front of next
+func (c SecurityConfig) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			w.Header().Add("Vary", "Origin")
+			if !c.originAllowed(r) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]string{"error": "origin not allowed"})
+				return
+			}
+			if c.originTrusted(r) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		if !c.isPublic(r.URL.Path) && !c.authorized(r) {
+			if c.BasicAuthUser != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="System Monitor", charset="UTF-8"`)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "authentication required"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serve serves handler over HTTP or HTTPS depending on the config until
+// ctx is cancelled, then stops accepting connections and gives in-flight
+// requests up to shutdownTimeout to finish. Only a failure to serve is
+// returned.
+func (c SecurityConfig) serve(ctx context.Context, addr string, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- c.listenAndServe(server) }()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("HTTP shutdown incomplete:", err)
+	}
+	return nil
+}
+
+// listenAndServe runs server over HTTP or HTTPS until it is shut down
+func (c SecurityConfig) listenAndServe(server *http.Server) error {
+	var err error
+	switch {
+	case c.TLSCert != "" && c.TLSKey != "":
+		err = server.ListenAndServeTLS(c.TLSCert, c.TLSKey)
+	case c.TLSSelfSigned:
+		cert, certErr := selfSignedCertificate()
+		if certErr != nil {
+			return fmt.Errorf("failed to generate certificate: %v", certErr)
+		}
+		log.Println("Serving HTTPS with a self-signed certificate")
+		server.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		err = server.ListenAndServeTLS("", "")
+	default:
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// selfSignedCertificate generates a certificate valid for this host's
+// name and the loopback addresses
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hostname, Organization: []string{"System Monitor"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
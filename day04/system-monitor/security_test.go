@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// upgrade makes a request a WebSocket handshake with the given query
+func upgrade(query string) func(r *http.Request) {
+	return func(r *http.Request) {
+		r.URL.RawQuery = query
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+	}
+}
+
+func TestAuthorized(t *testing.T) {
+	cfg := SecurityConfig{APIKeys: []string{"k1", "k2"}, BasicAuthUser: "admin", BasicAuthPass: "secret"}
+
+	cases := []struct {
+		name    string
+		cfg     SecurityConfig
+		prepare func(r *http.Request)
+		want    bool
+	}{
+		{"no auth configured", SecurityConfig{}, func(r *http.Request) {}, true},
+		{"no credentials", cfg, func(r *http.Request) {}, false},
+		{"header key", cfg, func(r *http.Request) { r.Header.Set("X-API-Key", "k2") }, true},
+		{"wrong header key", cfg, func(r *http.Request) { r.Header.Set("X-API-Key", "k3") }, false},
+		{"bearer token", cfg, func(r *http.Request) { r.Header.Set("Authorization", "Bearer k1") }, true},
+		{"query key", cfg, func(r *http.Request) { r.URL.RawQuery = "api_key=k1" }, false},
+		{"query key on a WebSocket upgrade", cfg, upgrade("api_key=k1"), true},
+		{"empty query key on a WebSocket upgrade", cfg, upgrade("api_key="), false},
+		{"basic auth", cfg, func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, true},
+		{"wrong password", cfg, func(r *http.Request) { r.SetBasicAuth("admin", "guess") }, false},
+		{"basic auth without a user configured", SecurityConfig{APIKeys: []string{"k1"}}, func(r *http.Request) { r.SetBasicAuth("", "") }, false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/api/stats/current", nil)
+		c.prepare(r)
+		if got := c.cfg.authorized(r); got != c.want {
+			t.Fatalf("%s: authorized=%v want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	cases := []struct {
+		allowed []string
+		host    string
+		origin  string
+		want    bool
+	}{
+		{nil, "monitor:8080", "", true},
+		{nil, "monitor:8080", "http://monitor:8080", true},
+		{nil, "monitor:8080", "https://MONITOR:8080", true},
+		{nil, "monitor:8080", "http://monitor:9090", false},
+		{nil, "monitor:8080", "https://evil.example.com", false},
+		{[]string{"https://ops.example.com"}, "monitor:8080", "https://ops.example.com", true},
+		{[]string{"https://ops.example.com"}, "monitor:8080", "https://ops.example.com.evil.net", false},
+		{[]string{"*"}, "monitor:8080", "https://anything.example.com", true},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/ws", nil)
+		r.Host = c.host
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		cfg := SecurityConfig{AllowedOrigins: c.allowed}
+		if got := cfg.originAllowed(r); got != c.want {
+			t.Fatalf("originAllowed(%q on %s, allowed %v)=%v want %v", c.origin, c.host, c.allowed, got, c.want)
+		}
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	cfg := SecurityConfig{PublicPaths: []string{"/", "/api/health"}, PublicPrefixes: []string{"/static/"}}
+
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/api/health", true},
+		{"/api/health/", false},
+		{"/static/js/dashboard.js", true},
+		{"/static", false},
+		{"/api/stats/current", false},
+		{"/ws", false},
+		{"/metrics", false},
+	}
+	for _, c := range cases {
+		if got := cfg.isPublic(c.path); got != c.want {
+			t.Fatalf("isPublic(%q)=%v want %v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestWrapServesDashboardWithAPIKeys(t *testing.T) {
+	m := NewMonitor(Sources{CPU: newFakeSources(), Memory: newFakeSources(), Disk: newFakeSources(), Host: newFakeSources()})
+	cfg := SecurityConfig{APIKeys: []string{"k1"}, PublicPaths: []string{"/"}, PublicPrefixes: []string{"/static/"}}
+	server := httptest.NewServer(cfg.wrap(newRouter(m)))
+	defer server.Close()
+
+	cases := []struct {
+		path   string
+		key    string
+		status int
+	}{
+		{"/", "", http.StatusOK},
+		{"/static/js/auth.js", "", http.StatusOK},
+		{"/api/stats/current", "", http.StatusUnauthorized},
+		{"/api/stats/current", "k1", http.StatusOK},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", server.URL+c.path, nil)
+		if c.key != "" {
+			req.Header.Set("X-API-Key", c.key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Fatalf("GET %s with key %q status=%d want %d", c.path, c.key, resp.StatusCode, c.status)
+		}
+	}
+}
+
+func TestWrapCORS(t *testing.T) {
+	cases := []struct {
+		allowed     []string
+		origin      string
+		status      int
+		allowOrigin string
+		credentials bool
+	}{
+		{nil, "https://evil.example.com", http.StatusForbidden, "", false},
+		{[]string{"https://ops.example.com"}, "https://ops.example.com", http.StatusOK, "https://ops.example.com", true},
+		// A wildcard never lets another site send the user's credentials
+		{[]string{"*"}, "https://evil.example.com", http.StatusOK, "*", false},
+		{[]string{"*", "https://ops.example.com"}, "https://ops.example.com", http.StatusOK, "https://ops.example.com", true},
+	}
+	for _, c := range cases {
+		cfg := SecurityConfig{AllowedOrigins: c.allowed}
+		handler := cfg.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		r := httptest.NewRequest("GET", "/api/stats/current", nil)
+		r.Header.Set("Origin", c.origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		credentials := w.Header().Get("Access-Control-Allow-Credentials") == "true"
+		if w.Code != c.status || w.Header().Get("Access-Control-Allow-Origin") != c.allowOrigin || credentials != c.credentials {
+			t.Fatalf("origin %q allowed %v: status=%d allow-origin=%q credentials=%v want %d, %q, %v", c.origin, c.allowed,
+				w.Code, w.Header().Get("Access-Control-Allow-Origin"), credentials, c.status, c.allowOrigin, c.credentials)
+		}
+	}
+}
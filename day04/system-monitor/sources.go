@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// CPUSource reads CPU utilisation
+type CPUSource interface {
+	// PerCore returns the busy percentage of every core over interval
+	PerCore(ctx context.Context, interval time.Duration) ([]float64, error)
+}
+
+// MemorySource reads physical memory and swap usage
+type MemorySource interface {
+	Virtual(ctx context.Context) (*mem.VirtualMemoryStat, error)
+	Swap(ctx context.Context) (*mem.SwapMemoryStat, error)
+}
+
+// DiskSource reads filesystem usage and block device counters
+type DiskSource interface {
+	Usage(ctx context.Context, path string) (*disk.UsageStat, error)
+	// Partitions lists the mounted physical partitions
+	Partitions(ctx context.Context) ([]disk.PartitionStat, error)
+	// IOCounters returns counters for whole block devices
+	IOCounters(ctx context.Context) (map[string]disk.IOCountersStat, error)
+}
+
+// HostSource reads static host information
+type HostSource interface {
+	Info(ctx context.Context) (*host.InfoStat, error)
+}
+
+// Sources are where the built-in collectors read the system from; tests
+// substitute fakes to get deterministic readings
+type Sources struct {
+	CPU    CPUSource
+	Memory MemorySource
+	Disk   DiskSource
+	Host   HostSource
+}
+
+// systemSources reads the real system through gopsutil
+func systemSources() Sources {
+	var g gopsutilSource
+	return Sources{CPU: g, Memory: g, Disk: g, Host: g}
+}
+
+// gopsutilSource implements every source interface with gopsutil
+type gopsutilSource struct{}
+
+func (gopsutilSource) PerCore(ctx context.Context, interval time.Duration) ([]float64, error) {
+	return cpu.PercentWithContext(ctx, interval, true)
+}
+
+func (gopsutilSource) Virtual(ctx context.Context) (*mem.VirtualMemoryStat, error) {
+	return mem.VirtualMemoryWithContext(ctx)
+}
+
+func (gopsutilSource) Swap(ctx context.Context) (*mem.SwapMemoryStat, error) {
+	return mem.SwapMemoryWithContext(ctx)
+}
+
+func (gopsutilSource) Usage(ctx context.Context, path string) (*disk.UsageStat, error) {
+	return disk.UsageWithContext(ctx, path)
+}
+
+func (gopsutilSource) Partitions(ctx context.Context) ([]disk.PartitionStat, error) {
+	return disk.PartitionsWithContext(ctx, false)
+}
+
+// IOCounters drops partitions on Linux so they are not counted twice
+// alongside their parent disk
+func (gopsutilSource) IOCounters(ctx context.Context) (map[string]disk.IOCountersStat, error) {
+	counters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS != "linux" {
+		return counters, nil
+	}
+
+	for name := range counters {
+		if _, err := os.Stat(filepath.Join("/sys/block", name)); err != nil {
+			delete(counters, name)
+		}
+	}
+	return counters, nil
+}
+
+func (gopsutilSource) Info(ctx context.Context) (*host.InfoStat, error) {
+	return host.InfoWithContext(ctx)
+}
@@ -0,0 +1,43 @@
+// Credentials for the dashboards. When the server requires an API key the
+// user is asked for it once; it is kept in localStorage and sent with every
+// request. Basic auth needs nothing here, the browser handles it.
+const Auth = (function () {
+    'use strict';
+
+    const storageKey = 'systemMonitorApiKey';
+
+    function key() {
+        return window.localStorage.getItem(storageKey) || '';
+    }
+
+    // fetch sends the API key in the X-API-Key header and asks for a new
+    // one if the server rejects it
+    function fetchWithKey(url) {
+        const sent = key();
+        return fetch(url, { headers: sent ? { 'X-API-Key': sent } : {} }).then(response => {
+            if (response.status !== 401 || response.headers.has('WWW-Authenticate')) {
+                return response;
+            }
+            // Another request may already have asked while this one was in flight
+            if (key() === sent) {
+                const entered = window.prompt('API key for this monitor');
+                if (!entered || !entered.trim()) {
+                    return response;
+                }
+                window.localStorage.setItem(storageKey, entered.trim());
+            }
+            return fetchWithKey(url);
+        });
+    }
+
+    // webSocketUrl builds the URL for path on this server. Browsers can't
+    // set headers on a WebSocket, so the key goes in the api_key parameter.
+    function webSocketUrl(path) {
+        const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+        const current = key();
+        return protocol + '//' + window.location.host + path +
+            (current ? '?api_key=' + encodeURIComponent(current) : '');
+    }
+
+    return { fetch: fetchWithKey, webSocketUrl: webSocketUrl };
+})();
@@ -0,0 +1,279 @@
+// Minimal canvas charts for the System Monitor dashboards.
+//
+// The dashboards have to work on air-gapped hosts, so instead of pulling
+// a charting library from a CDN this file provides the two chart types
+// they need: a multi-series time chart and a simple bar chart.
+(function (global) {
+    'use strict';
+
+    const FONT = '12px "Segoe UI", Tahoma, Geneva, Verdana, sans-serif';
+    const TITLE_FONT = 'bold 13px "Segoe UI", Tahoma, Geneva, Verdana, sans-serif';
+    const GRID_COLOR = '#e5e7eb';
+    const TEXT_COLOR = '#6b7280';
+    const PADDING = { top: 48, right: 16, bottom: 28, left: 64 };
+
+    // Size the canvas backing store to its CSS size and the pixel ratio
+    function prepare(canvas) {
+        const ratio = window.devicePixelRatio || 1;
+        const width = canvas.clientWidth;
+        const height = canvas.clientHeight;
+        if (canvas.width !== width * ratio || canvas.height !== height * ratio) {
+            canvas.width = width * ratio;
+            canvas.height = height * ratio;
+        }
+        const ctx = canvas.getContext('2d');
+        ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+        ctx.clearRect(0, 0, width, height);
+        ctx.font = FONT;
+        return { ctx: ctx, width: width, height: height };
+    }
+
+    // Pick a "nice" axis maximum and step for the given data maximum
+    function niceScale(max, ticks) {
+        if (!(max > 0)) {
+            return { max: 1, step: 1 / ticks };
+        }
+        const rough = max / ticks;
+        const magnitude = Math.pow(10, Math.floor(Math.log10(rough)));
+        const step = [1, 2, 2.5, 5, 10].map(m => m * magnitude).find(s => s >= rough);
+        return { max: step * ticks, step: step };
+    }
+
+    function drawTitle(ctx, title, width) {
+        if (!title) return;
+        ctx.font = TITLE_FONT;
+        ctx.fillStyle = '#374151';
+        ctx.textAlign = 'center';
+        ctx.textBaseline = 'top';
+        ctx.fillText(title, width / 2, 6);
+        ctx.font = FONT;
+    }
+
+    function drawLegend(ctx, series, width) {
+        let total = 0;
+        const widths = series.map(s => {
+            const w = 22 + ctx.measureText(s.label).width + 14;
+            total += w;
+            return w;
+        });
+        let x = (width - total) / 2;
+        ctx.textAlign = 'left';
+        ctx.textBaseline = 'middle';
+        series.forEach((s, i) => {
+            ctx.fillStyle = s.color;
+            ctx.fillRect(x, 26, 16, 4);
+            ctx.fillStyle = TEXT_COLOR;
+            ctx.fillText(s.label, x + 22, 28);
+            x += widths[i];
+        });
+    }
+
+    function drawYAxis(ctx, scale, area, format) {
+        ctx.strokeStyle = GRID_COLOR;
+        ctx.fillStyle = TEXT_COLOR;
+        ctx.textAlign = 'right';
+        ctx.textBaseline = 'middle';
+        ctx.lineWidth = 1;
+        for (let v = 0; v <= scale.max + scale.step / 2; v += scale.step) {
+            const y = area.bottom - (v / scale.max) * (area.bottom - area.top);
+            ctx.beginPath();
+            ctx.moveTo(area.left, Math.round(y) + 0.5);
+            ctx.lineTo(area.right, Math.round(y) + 0.5);
+            ctx.stroke();
+            ctx.fillText(format(v), area.left - 8, y);
+        }
+    }
+
+    function timeLabel(t) {
+        return new Date(t).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit', second: '2-digit' });
+    }
+
+    // TimeChart plots one or more series against time over a sliding window
+    class TimeChart {
+        // options: title, series [{label, color}], max (fixed y max),
+        // format (y tick formatter), window (visible range in ms)
+        constructor(canvas, options) {
+            this.canvas = canvas;
+            this.title = options.title || '';
+            this.series = options.series;
+            this.max = options.max;
+            this.format = options.format || (v => String(Math.round(v * 100) / 100));
+            this.window = options.window || 5 * 60 * 1000;
+            this.points = []; // [{t, values}]
+            this.annotations = []; // [{t, label, color}]
+            this.frozen = false;
+            if (global.ResizeObserver) {
+                new ResizeObserver(() => this.render()).observe(canvas);
+            }
+        }
+
+        setWindow(ms) {
+            this.window = ms;
+            this.trim();
+            this.render();
+        }
+
+        // Replace all points, e.g. after backfilling from history
+        setData(points) {
+            this.points = points.slice().sort((a, b) => a.t - b.t);
+            this.trim();
+            this.render();
+        }
+
+        push(t, values) {
+            this.points.push({ t: t, values: values });
+            this.trim();
+            this.render();
+        }
+
+        // Mark a point in time, e.g. an anomaly or alert
+        annotate(t, label, color) {
+            this.annotations.push({ t: t, label: label, color: color || '#f59e0b' });
+            this.trim();
+            this.render();
+        }
+
+        clearAnnotations() {
+            this.annotations = [];
+            this.render();
+        }
+
+        // While frozen, data keeps arriving but the view doesn't move
+        freeze(frozen) {
+            this.frozen = frozen;
+            if (!frozen) this.render();
+        }
+
+        trim() {
+            const now = this.points.length ? this.points[this.points.length - 1].t : Date.now();
+            const cutoff = now - this.window;
+            while (this.points.length && this.points[0].t < cutoff) this.points.shift();
+            this.annotations = this.annotations.filter(a => a.t >= cutoff);
+        }
+
+        render() {
+            if (this.frozen) return;
+            const { ctx, width, height } = prepare(this.canvas);
+            const area = {
+                left: PADDING.left, right: width - PADDING.right,
+                top: PADDING.top, bottom: height - PADDING.bottom
+            };
+            if (area.right <= area.left || area.bottom <= area.top) return;
+
+            drawTitle(ctx, this.title, width);
+            drawLegend(ctx, this.series, width);
+
+            let dataMax = 0;
+            this.points.forEach(p => p.values.forEach(v => { if (v > dataMax) dataMax = v; }));
+            const scale = this.max ? { max: this.max, step: this.max / 4 } : niceScale(dataMax, 4);
+            drawYAxis(ctx, scale, area, this.format);
+
+            const end = this.points.length ? this.points[this.points.length - 1].t : Date.now();
+            const start = end - this.window;
+            const x = t => area.left + ((t - start) / this.window) * (area.right - area.left);
+            const y = v => area.bottom - (Math.min(v, scale.max) / scale.max) * (area.bottom - area.top);
+
+            // Time axis
+            ctx.fillStyle = TEXT_COLOR;
+            ctx.textAlign = 'center';
+            ctx.textBaseline = 'top';
+            for (let i = 0; i <= 4; i++) {
+                const t = start + (this.window * i) / 4;
+                ctx.fillText(timeLabel(t), Math.min(Math.max(x(t), area.left + 30), area.right - 30), area.bottom + 8);
+            }
+
+            // Annotations sit behind the lines
+            this.annotations.forEach(a => {
+                const ax = Math.round(x(a.t)) + 0.5;
+                ctx.strokeStyle = a.color;
+                ctx.setLineDash([4, 4]);
+                ctx.beginPath();
+                ctx.moveTo(ax, area.top);
+                ctx.lineTo(ax, area.bottom);
+                ctx.stroke();
+                ctx.setLineDash([]);
+                ctx.fillStyle = a.color;
+                ctx.textAlign = 'left';
+                ctx.textBaseline = 'top';
+                ctx.fillText(a.label, ax + 4, area.top + 2);
+            });
+
+            // Series lines
+            ctx.lineWidth = 2;
+            ctx.lineJoin = 'round';
+            this.series.forEach((s, i) => {
+                ctx.strokeStyle = s.color;
+                ctx.beginPath();
+                let started = false;
+                this.points.forEach(p => {
+                    const v = p.values[i];
+                    if (v === undefined || v === null) {
+                        started = false;
+                        return;
+                    }
+                    if (started) {
+                        ctx.lineTo(x(p.t), y(v));
+                    } else {
+                        ctx.moveTo(x(p.t), y(v));
+                        started = true;
+                    }
+                });
+                ctx.stroke();
+            });
+        }
+    }
+
+    // BarChart shows one value per label, e.g. usage per CPU core
+    class BarChart {
+        // options: title, color, max, format
+        constructor(canvas, options) {
+            this.canvas = canvas;
+            this.title = options.title || '';
+            this.color = options.color || '#6366f1';
+            this.max = options.max;
+            this.format = options.format || (v => String(Math.round(v)));
+            this.labels = [];
+            this.values = [];
+            if (global.ResizeObserver) {
+                new ResizeObserver(() => this.render()).observe(canvas);
+            }
+        }
+
+        set(labels, values) {
+            this.labels = labels;
+            this.values = values;
+            this.render();
+        }
+
+        render() {
+            const { ctx, width, height } = prepare(this.canvas);
+            const area = {
+                left: PADDING.left, right: width - PADDING.right,
+                top: PADDING.top - 16, bottom: height - PADDING.bottom
+            };
+            if (area.right <= area.left || area.bottom <= area.top) return;
+
+            drawTitle(ctx, this.title, width);
+            const scale = this.max ? { max: this.max, step: this.max / 4 } : niceScale(Math.max(0, ...this.values), 4);
+            drawYAxis(ctx, scale, area, this.format);
+
+            const slot = (area.right - area.left) / Math.max(this.values.length, 1);
+            const barWidth = Math.max(2, slot * 0.7);
+            ctx.textAlign = 'center';
+            ctx.textBaseline = 'top';
+            this.values.forEach((v, i) => {
+                const h = (Math.min(v, scale.max) / scale.max) * (area.bottom - area.top);
+                const bx = area.left + slot * i + (slot - barWidth) / 2;
+                ctx.fillStyle = this.color;
+                ctx.fillRect(bx, area.bottom - h, barWidth, h);
+                if (slot > 28) {
+                    ctx.fillStyle = TEXT_COLOR;
+                    ctx.fillText(this.labels[i], bx + barWidth / 2, area.bottom + 8);
+                }
+            });
+        }
+    }
+
+    global.TimeChart = TimeChart;
+    global.BarChart = BarChart;
+})(window);
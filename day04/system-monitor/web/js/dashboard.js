@@ -0,0 +1,385 @@
+// System Monitor dashboard: live stats over WebSocket, backfilled from
+// the history API so charts are populated as soon as the page loads.
+(function () {
+    'use strict';
+
+    let ws;
+    let paused = false;
+    let latest = null;
+
+    // Matching log lines streamed by the server, newest last
+    const maxLogLines = 200;
+    const logLines = [];
+
+    const $ = id => document.getElementById(id);
+
+    function formatBytes(bytes) {
+        const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+        let i = 0;
+        while (bytes >= 1024 && i < units.length - 1) {
+            bytes /= 1024;
+            i++;
+        }
+        return bytes.toFixed(i === 0 ? 0 : 1) + ' ' + units[i];
+    }
+
+    function formatRate(bytes) {
+        return formatBytes(bytes) + '/s';
+    }
+
+    function sum(items, field) {
+        return (items || []).reduce((total, item) => total + item[field], 0);
+    }
+
+    function range() {
+        return Number($('timeRange').value);
+    }
+
+    // Charts
+    const percent = v => Math.round(v) + '%';
+    const charts = {
+        system: new TimeChart($('systemChart'), {
+            title: 'System Resources Over Time',
+            max: 100,
+            format: percent,
+            series: [
+                { label: 'CPU %', color: '#ef4444' },
+                { label: 'Memory %', color: '#3b82f6' },
+                { label: 'Disk %', color: '#10b981' }
+            ]
+        }),
+        network: new TimeChart($('networkChart'), {
+            title: 'Network Throughput',
+            format: formatRate,
+            series: [{ label: 'Received', color: '#3b82f6' }, { label: 'Sent', color: '#f59e0b' }]
+        }),
+        diskIO: new TimeChart($('diskIOChart'), {
+            title: 'Disk I/O',
+            format: formatRate,
+            series: [{ label: 'Read', color: '#10b981' }, { label: 'Write', color: '#ef4444' }]
+        }),
+        load: new TimeChart($('loadChart'), {
+            title: 'Load Average',
+            series: [
+                { label: '1m', color: '#8b5cf6' },
+                { label: '5m', color: '#ec4899' },
+                { label: '15m', color: '#14b8a6' }
+            ]
+        })
+    };
+    const coreChart = new BarChart($('coreChart'), { title: 'Per-Core CPU Usage', max: 100, format: percent });
+
+    // chartValues maps a sample to the values plotted on each time chart
+    function chartValues(stats) {
+        return {
+            system: [stats.cpu_percent, stats.memory_percent, stats.disk_percent],
+            network: [sum(stats.network, 'rx_bytes_per_sec'), sum(stats.network, 'tx_bytes_per_sec')],
+            diskIO: [sum(stats.disk_io, 'read_bytes_per_sec'), sum(stats.disk_io, 'write_bytes_per_sec')],
+            load: [stats.load1, stats.load5, stats.load15]
+        };
+    }
+
+    // Which chart shows each metric the anomaly detector scores
+    const anomalyCharts = {
+        cpu_percent: 'system',
+        memory_percent: 'system',
+        memory_used: 'system',
+        disk_percent: 'system',
+        swap_percent: 'system',
+        network_rx_bytes_per_sec: 'network',
+        network_tx_bytes_per_sec: 'network',
+        load1: 'load'
+    };
+
+    // Mark anomalies on the charts and show the disk-full forecast
+    function refreshAnomalies() {
+        if (paused) return;
+        const from = new Date(Date.now() - range()).toISOString();
+        Auth.fetch('/api/anomalies?from=' + encodeURIComponent(from))
+            .then(response => response.json())
+            .then(result => {
+                Object.values(charts).forEach(chart => chart.clearAnnotations());
+                result.anomalies.forEach(a => {
+                    const chart = charts[anomalyCharts[a.metric]];
+                    if (chart) {
+                        const label = a.method === 'trend' ? '⚠ ' + a.metric + ' growing' : '⚠ ' + a.metric;
+                        chart.annotate(new Date(a.time).getTime(), label, '#f59e0b');
+                    }
+                });
+
+                const disk = result.forecasts.find(f => f.metric === 'disk_used');
+                let text = '';
+                if (disk && disk.exhausted_at) {
+                    const hours = (new Date(disk.exhausted_at) - Date.now()) / 3600000;
+                    text = hours < 24 * 30
+                        ? 'full in ~' + (hours < 48 ? hours.toFixed(1) + ' h' : (hours / 24).toFixed(0) + ' days')
+                        : 'growing ' + formatBytes(disk.growth_per_hour) + '/h';
+                }
+                $('diskForecast').textContent = text;
+            })
+            .catch(err => console.error('Failed to load anomalies:', err));
+    }
+
+    function setWindow(ms) {
+        Object.values(charts).forEach(chart => chart.setWindow(ms));
+    }
+
+    // Load the selected range from the server, replacing chart data
+    function backfill() {
+        const from = new Date(Date.now() - range()).toISOString();
+        return Auth.fetch('/api/stats/history?from=' + encodeURIComponent(from))
+            .then(response => response.json())
+            .then(history => {
+                const points = Object.fromEntries(Object.keys(charts).map(name => [name, []]));
+                history.forEach(stats => {
+                    const t = new Date(stats.timestamp).getTime();
+                    const values = chartValues(stats);
+                    Object.keys(charts).forEach(name => points[name].push({ t: t, values: values[name] }));
+                });
+                Object.entries(charts).forEach(([name, chart]) => chart.setData(points[name]));
+                if (history.length > 0) {
+                    updateCards(history[history.length - 1]);
+                }
+                refreshAnomalies();
+            })
+            .catch(err => console.error('Failed to load history:', err));
+    }
+
+    function setStatus(connected) {
+        const status = $('connectionStatus');
+        status.textContent = connected ? '🟢 Connected' : '🔴 Disconnected';
+        status.className = 'status ' + (connected ? 'online' : 'offline');
+    }
+
+    function connectWebSocket() {
+        ws = new WebSocket(Auth.webSocketUrl('/ws'));
+
+        ws.onopen = function () {
+            setStatus(true);
+            subscribe();
+            backfill();
+        };
+
+        ws.onclose = function () {
+            setStatus(false);
+            // Reconnect after 3 seconds
+            setTimeout(connectWebSocket, 3000);
+        };
+
+        ws.onmessage = function (event) {
+            const data = JSON.parse(event.data);
+            if (data.type === 'error') {
+                console.error('Subscription rejected:', data.error);
+                return;
+            }
+            if (data.type === 'log') {
+                addLogLine(data);
+                return;
+            }
+            addSample(data);
+        };
+    }
+
+    // Every metric group the server has (metricGroups in hub.go). Naming
+    // them, rather than sending none, also streams matching log lines.
+    const groups = ['cpu', 'memory', 'disk', 'network', 'load', 'container', 'logs', 'probes', 'system'];
+
+    // Ask the server for every metric group at the selected rate
+    function subscribe() {
+        if (ws && ws.readyState === WebSocket.OPEN) {
+            ws.send(JSON.stringify({ type: 'subscribe', groups: groups, interval: $('updateRate').value }));
+        }
+    }
+
+    // Charts keep collecting while paused; only the view is frozen
+    function addSample(stats) {
+        const t = new Date(stats.timestamp).getTime();
+        const values = chartValues(stats);
+        Object.entries(charts).forEach(([name, chart]) => chart.push(t, values[name]));
+        latest = stats;
+        if (!paused) {
+            updateCards(stats);
+        }
+    }
+
+    function updateCards(stats) {
+        $('cpuValue').textContent = stats.cpu_percent.toFixed(1) + '%';
+        $('memoryValue').textContent = stats.memory_percent.toFixed(1) + '%';
+        $('diskValue').textContent = stats.disk_percent.toFixed(1) + '%';
+        $('goroutinesValue').textContent = stats.goroutines;
+        $('loadValue').textContent = stats.load1.toFixed(2);
+        $('loadDetail').textContent = '5m ' + stats.load5.toFixed(2) + ' · 15m ' + stats.load15.toFixed(2);
+        $('swapValue').textContent = stats.swap_percent.toFixed(1) + '%';
+
+        $('cpuProgress').style.width = stats.cpu_percent + '%';
+        $('memoryProgress').style.width = stats.memory_percent + '%';
+        $('diskProgress').style.width = stats.disk_percent + '%';
+        $('swapProgress').style.width = stats.swap_percent + '%';
+
+        const rx = sum(stats.network, 'rx_bytes_per_sec');
+        const tx = sum(stats.network, 'tx_bytes_per_sec');
+        $('networkValue').textContent = formatRate(rx + tx);
+        $('networkDetail').textContent = '↓ ' + formatRate(rx) + ' · ↑ ' + formatRate(tx);
+
+        const iops = sum(stats.disk_io, 'read_iops') + sum(stats.disk_io, 'write_iops');
+        $('diskIOValue').textContent = iops.toFixed(0) + ' IOPS';
+        $('diskIODetail').textContent = 'read ' + formatRate(sum(stats.disk_io, 'read_bytes_per_sec')) +
+            ' · write ' + formatRate(sum(stats.disk_io, 'write_bytes_per_sec'));
+
+        const perCore = stats.cpu_per_core || [];
+        coreChart.set(perCore.map((_, i) => 'cpu' + i), perCore);
+
+        updatePartitions(stats.partitions || []);
+        updateContainer(stats.container);
+        updateLogRules(stats.logs);
+        updateProbes(stats.probes);
+
+        // Collector failures are reported instead of silent zeros
+        $('collectorErrors').textContent = Object.entries(stats.errors || {})
+            .map(([name, err]) => '⚠️ ' + name + ': ' + err)
+            .join('  ');
+    }
+
+    // The container card only appears when the monitor reads its cgroup
+    function updateContainer(c) {
+        $('containerCard').hidden = !c;
+        if (!c) return;
+        $('containerLabel').textContent = (c.in_container ? 'Container' : 'Cgroup') + ' CPU (' +
+            (c.cpu_quota_cores > 0 ? c.cpu_quota_cores.toFixed(2) + ' cores quota' : 'no quota') + ')';
+        $('containerCPUValue').textContent = c.cpu_percent.toFixed(1) + '%';
+        $('containerCPUProgress').style.width = Math.min(c.cpu_percent, 100) + '%';
+        $('containerMemory').textContent = 'memory ' + formatBytes(c.memory_used) +
+            (c.memory_limit > 0 ? ' / ' + formatBytes(c.memory_limit) + ' (' + c.memory_percent.toFixed(1) + '%)' : '');
+        $('containerDetail').textContent = 'throttled ' + c.cpu_throttled_periods + '/' + c.cpu_periods +
+            ' periods · pids ' + c.pids + (c.pids_limit > 0 ? '/' + c.pids_limit : '') +
+            (c.oom_kills > 0 ? ' · ' + c.oom_kills + ' OOM kills' : '');
+    }
+
+    // The probes card only appears when probes are configured
+    function updateProbes(probes) {
+        $('probesCard').hidden = !probes;
+        if (!probes) return;
+        fillTable($('probesBody'), probes.map(p => [
+            p.name, p.type, p.target,
+            p.checks === 0 ? '…' : (p.up ? '🟢 up' : '🔴 down'),
+            p.checks === 0 ? '' : p.latency_ms.toFixed(1) + ' ms',
+            p.checks === 0 ? '' : p.uptime_percent.toFixed(2) + '%',
+            p.last_error || ''
+        ]));
+        Array.from($('probesBody').rows).forEach((row, i) => {
+            row.classList.toggle('alerting', probes[i].checks > 0 && !probes[i].up);
+        });
+    }
+
+    // The logs card only appears when the server follows log files
+    function updateLogRules(logs) {
+        $('logsCard').hidden = !logs;
+        if (!logs) return;
+        fillTable($('logRulesBody'), logs.map(l => [l.file, l.rule, l.per_minute, l.total]));
+        Array.from($('logRulesBody').rows).forEach((row, i) => {
+            const l = logs[i];
+            row.classList.toggle('alerting', (l.warning > 0 && l.per_minute >= l.warning) ||
+                (l.critical > 0 && l.per_minute >= l.critical));
+        });
+    }
+
+    // Lines keep arriving while paused; only the view is frozen
+    function addLogLine(line) {
+        logLines.push(line);
+        if (logLines.length > maxLogLines) {
+            logLines.shift();
+        }
+        if (!paused) {
+            renderLogLines();
+        }
+    }
+
+    function renderLogLines() {
+        const container = $('logLines');
+        const atBottom = container.scrollTop + container.clientHeight >= container.scrollHeight - 5;
+        container.innerHTML = '';
+        logLines.forEach(l => {
+            const row = document.createElement('div');
+            row.className = 'log-line';
+            const meta = document.createElement('span');
+            meta.className = 'log-meta';
+            meta.textContent = new Date(l.timestamp).toLocaleTimeString() + ' ' + l.rule;
+            row.appendChild(meta);
+            row.appendChild(document.createTextNode(l.line));
+            container.appendChild(row);
+        });
+        if (atBottom) {
+            container.scrollTop = container.scrollHeight;
+        }
+    }
+
+    function fillTable(body, rows) {
+        body.innerHTML = '';
+        rows.forEach(values => {
+            const row = document.createElement('tr');
+            values.forEach(value => {
+                const cell = document.createElement('td');
+                cell.textContent = value;
+                row.appendChild(cell);
+            });
+            body.appendChild(row);
+        });
+    }
+
+    function updatePartitions(partitions) {
+        fillTable($('partitionsBody'), partitions.map(p => [
+            p.mountpoint, p.device, p.fstype, formatBytes(p.used), formatBytes(p.total),
+            p.used_percent.toFixed(1) + '%'
+        ]));
+    }
+
+    function refreshProcesses() {
+        if (paused) return;
+        Auth.fetch('/api/processes?sort=' + $('processSort').value + '&limit=20')
+            .then(response => response.json())
+            .then(processes => {
+                const body = $('processesBody');
+                fillTable(body, processes.map(p => [
+                    p.pid, p.name, p.username, p.cpu_percent.toFixed(1) + '%', formatBytes(p.rss),
+                    p.memory_percent.toFixed(1) + '%', p.threads, p.cmdline
+                ]));
+                Array.from(body.rows).forEach((row, i) => {
+                    row.lastChild.className = 'cmdline';
+                    row.lastChild.title = processes[i].cmdline;
+                });
+            })
+            .catch(err => console.error('Failed to load processes:', err));
+    }
+
+    function togglePause() {
+        paused = !paused;
+        const button = $('pauseButton');
+        button.textContent = paused ? '▶ Resume' : '⏸ Pause';
+        button.classList.toggle('paused', paused);
+        Object.values(charts).forEach(chart => chart.freeze(paused));
+        if (!paused && latest) {
+            updateCards(latest);
+            renderLogLines();
+            refreshProcesses();
+            refreshAnomalies();
+        }
+    }
+
+    $('timeRange').addEventListener('change', () => {
+        setWindow(range());
+        backfill();
+    });
+    $('updateRate').addEventListener('change', subscribe);
+    $('pauseButton').addEventListener('click', togglePause);
+    $('processSort').addEventListener('change', refreshProcesses);
+
+    setWindow(range());
+    connectWebSocket();
+
+    // Poll the process table
+    refreshProcesses();
+    setInterval(refreshProcesses, 3000);
+
+    // Anomalies are scored server-side on every sample
+    setInterval(refreshAnomalies, 10000);
+})();
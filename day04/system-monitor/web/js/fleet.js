@@ -0,0 +1,71 @@
+// Fleet overview: one card per host, refreshed every few seconds.
+(function () {
+    'use strict';
+
+    function bar(label, percent) {
+        const wrapper = document.createElement('div');
+        wrapper.className = 'metric';
+        wrapper.textContent = label + ' ' + percent.toFixed(1) + '%';
+        const track = document.createElement('div');
+        track.className = 'progress-bar';
+        const fill = document.createElement('div');
+        fill.className = 'progress-fill';
+        fill.style.width = Math.min(percent, 100) + '%';
+        track.appendChild(fill);
+        wrapper.appendChild(track);
+        return wrapper;
+    }
+
+    function ago(timestamp) {
+        const seconds = Math.round((Date.now() - new Date(timestamp)) / 1000);
+        if (seconds < 60) return seconds + 's ago';
+        if (seconds < 3600) return Math.round(seconds / 60) + 'm ago';
+        return Math.round(seconds / 3600) + 'h ago';
+    }
+
+    function render(hosts) {
+        const counts = { online: 0, stale: 0, offline: 0 };
+        hosts.forEach(h => counts[h.status]++);
+        document.getElementById('summary').textContent = hosts.length + ' hosts · ' +
+            counts.online + ' online · ' + counts.stale + ' stale · ' + counts.offline + ' offline';
+
+        const grid = document.getElementById('hosts');
+        grid.innerHTML = '';
+        hosts.forEach(h => {
+            const card = document.createElement('a');
+            card.className = 'card';
+            card.href = '/hosts/' + encodeURIComponent(h.hostname);
+
+            const title = document.createElement('h3');
+            title.textContent = h.hostname;
+            const badge = document.createElement('span');
+            badge.className = 'status ' + h.status;
+            badge.textContent = h.status;
+            title.appendChild(badge);
+            card.appendChild(title);
+
+            const meta = document.createElement('div');
+            meta.className = 'meta';
+            meta.textContent = h.info.platform + ' ' + h.info.platform_version + ' · ' +
+                h.info.cpu_cores + ' cores · seen ' + ago(h.last_seen);
+            card.appendChild(meta);
+
+            if (h.latest) {
+                card.appendChild(bar('CPU', h.latest.cpu_percent));
+                card.appendChild(bar('Memory', h.latest.memory_percent));
+                card.appendChild(bar('Disk', h.latest.disk_percent));
+            }
+            grid.appendChild(card);
+        });
+    }
+
+    function refresh() {
+        Auth.fetch('/api/hosts')
+            .then(response => response.json())
+            .then(render)
+            .catch(err => console.error('Failed to load hosts:', err));
+    }
+
+    refresh();
+    setInterval(refresh, 5000);
+})();
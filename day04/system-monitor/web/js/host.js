@@ -0,0 +1,60 @@
+// Host drill-down: status and recent history for one fleet member.
+(function () {
+    'use strict';
+
+    const host = decodeURIComponent(window.location.pathname.split('/').pop());
+    const api = '/api/hosts/' + encodeURIComponent(host);
+    const WINDOW = 10 * 60 * 1000;
+
+    const usageChart = new TimeChart(document.getElementById('usageChart'), {
+        title: 'Resource Usage %',
+        series: [
+            { label: 'CPU %', color: '#ef4444' },
+            { label: 'Memory %', color: '#3b82f6' },
+            { label: 'Disk %', color: '#10b981' }
+        ],
+        max: 100,
+        window: WINDOW
+    });
+    const loadChart = new TimeChart(document.getElementById('loadChart'), {
+        title: 'Load Average',
+        series: [
+            { label: '1m', color: '#8b5cf6' },
+            { label: '5m', color: '#ec4899' },
+            { label: '15m', color: '#14b8a6' }
+        ],
+        window: WINDOW
+    });
+
+    function refresh() {
+        Auth.fetch(api)
+            .then(response => response.json())
+            .then(h => {
+                document.getElementById('hostname').textContent = '🖥️ ' + h.hostname;
+                document.getElementById('hostMeta').textContent = h.info.os + ' · ' + h.info.platform + ' ' +
+                    h.info.platform_version + ' · ' + h.info.cpu_cores + ' cores · last seen ' +
+                    new Date(h.last_seen).toLocaleTimeString();
+                const status = document.getElementById('hostStatus');
+                status.className = 'status ' + h.status;
+                status.textContent = h.status;
+            });
+
+        const from = new Date(Date.now() - WINDOW).toISOString();
+        Auth.fetch(api + '/stats/history?from=' + encodeURIComponent(from))
+            .then(response => response.json())
+            .then(history => {
+                usageChart.setData(history.map(s => ({
+                    t: new Date(s.timestamp).getTime(),
+                    values: [s.cpu_percent, s.memory_percent, s.disk_percent]
+                })));
+                loadChart.setData(history.map(s => ({
+                    t: new Date(s.timestamp).getTime(),
+                    values: [s.load1, s.load5, s.load15]
+                })));
+            })
+            .catch(err => console.error('Failed to load history:', err));
+    }
+
+    refresh();
+    setInterval(refresh, 5000);
+})();
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Services recognized from a flow's first bytes, whatever its port
+const (
+	serviceHTTP  = "http"
+	serviceHTTPS = "https" // TLS offering an HTTP protocol over ALPN
+	serviceTLS   = "tls"
+	serviceSSH   = "ssh"
+)
+
+// maxStreamBuffer caps the client bytes buffered while looking for a
+// request or ClientHello
+const maxStreamBuffer = 16 * 1024
+
+// maxPendingSegments caps the out-of-order segments held per stream
+const maxPendingSegments = 32
+
+// httpMethods start the request line of plaintext HTTP
+var httpMethods = []string{"GET", "POST", "PUT", "HEAD", "DELETE", "OPTIONS", "PATCH", "CONNECT", "TRACE"}
+
+// errIncomplete means more of the stream is needed to decide
+var errIncomplete = errors.New("incomplete")
+
+// streamBuffer reassembles the start of a TCP stream from segments that
+// may arrive split, out of order or retransmitted
+type streamBuffer struct {
+	started bool
+	next    uint32 // sequence number of the next byte expected
+	data    []byte
+	pending map[uint32][]byte
+}
+
+// start sets the sequence number of the stream's first byte
+func (s *streamBuffer) start(seq uint32) {
+	s.started, s.next = true, seq
+}
+
+// add places a segment and reports whether the buffered data grew
+func (s *streamBuffer) add(seq uint32, payload []byte) bool {
+	if !s.started {
+		s.start(seq)
+	}
+	if ahead := int32(seq - s.next); ahead > 0 {
+		if s.pending == nil {
+			s.pending = make(map[uint32][]byte)
+		}
+		if len(s.pending) < maxPendingSegments {
+			s.pending[seq] = append([]byte(nil), payload...)
+		}
+		return false
+	}
+
+	grew := s.appendFrom(seq, payload)
+	for progress := true; progress; {
+		progress = false
+		for seq, segment := range s.pending {
+			if int32(seq-s.next) <= 0 {
+				delete(s.pending, seq)
+				progress = s.appendFrom(seq, segment) || progress
+			}
+		}
+	}
+	return grew
+}
+
+// appendFrom appends the part of a segment starting at seq that is new
+func (s *streamBuffer) appendFrom(seq uint32, payload []byte) bool {
+	overlap := int(s.next - seq)
+	if overlap >= len(payload) {
+		return false
+	}
+	payload = payload[overlap:]
+	s.data = append(s.data, payload...)
+	s.next += uint32(len(payload))
+	return true
+}
+
+// inspectPayload feeds a client-to-server TCP segment to the flow's
+// stream and classifies the flow once its first request is complete. It
+// reports whether the segment finished the classification.
+func (f *Flow) inspectPayload(tcp *layers.TCP) bool {
+	if f.stream == nil {
+		return false
+	}
+	if tcp.SYN {
+		f.stream.start(tcp.Seq + 1)
+	}
+	if len(tcp.Payload) == 0 || !f.stream.add(tcp.Seq, tcp.Payload) {
+		return false
+	}
+
+	err := f.classify(f.stream.data)
+	if err == errIncomplete && len(f.stream.data) < maxStreamBuffer {
+		return false
+	}
+	f.stream = nil
+	return err == nil
+}
+
+// classify works out a flow's service and hostname from the start of its
+// client stream
+func (f *Flow) classify(data []byte) error {
+	switch {
+	case len(data) > 0 && data[0] == 0x16:
+		hello, err := parseClientHello(data)
+		if err != nil {
+			return err
+		}
+		f.Service, f.Hostname, f.ALPN = serviceTLS, hello.serverName, hello.alpn
+		for _, proto := range hello.alpn {
+			if proto == "h2" || proto == "h3" || strings.HasPrefix(proto, "http/") {
+				f.Service = serviceHTTPS
+			}
+		}
+		return nil
+	case isHTTPRequest(data):
+		method, path, host, err := parseHTTPRequest(data)
+		if err != nil {
+			return err
+		}
+		f.Service, f.Hostname, f.Method, f.Path = serviceHTTP, host, method, path
+		return nil
+	case bytes.HasPrefix(data, []byte("SSH-")):
+		f.Service = serviceSSH
+		return nil
+	case bytes.HasPrefix([]byte("SSH-"), data):
+		return errIncomplete
+	}
+	return errors.New("unrecognized protocol")
+}
+
+// isHTTPRequest reports whether data starts like an HTTP request line, or
+// could once more of it arrives
+func isHTTPRequest(data []byte) bool {
+	for _, method := range httpMethods {
+		prefix := method + " "
+		if len(data) >= len(prefix) && string(data[:len(prefix)]) == prefix {
+			return true
+		}
+		if len(data) < len(prefix) && strings.HasPrefix(prefix, string(data)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHTTPRequest reads the method, path and Host header of a request
+// once all its headers have arrived
+func parseHTTPRequest(data []byte) (method, path, host string, err error) {
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	if end < 0 {
+		return "", "", "", errIncomplete
+	}
+	lines := strings.Split(string(data[:end]), "\r\n")
+	parts := strings.Fields(lines[0])
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/") {
+		return "", "", "", errors.New("malformed request line")
+	}
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Host") {
+			host = strings.ToLower(strings.TrimSpace(value))
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			break
+		}
+	}
+	return parts[0], parts[1], host, nil
+}
+
+// clientHello is what a TLS ClientHello reveals about where a client is
+// going
+type clientHello struct {
+	serverName string
+	alpn       []string
+}
+
+// reader walks a length-prefixed binary structure
+type reader struct {
+	data []byte
+	err  error
+}
+
+// next consumes n bytes, or records an error when there are not enough
+func (r *reader) next(n int) []byte {
+	if r.err != nil || n > len(r.data) {
+		r.err = errIncomplete
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// uint reads a big-endian unsigned integer of n bytes
+func (r *reader) uint(n int) int {
+	v := 0
+	for _, b := range r.next(n) {
+		v = v<<8 | int(b)
+	}
+	return v
+}
+
+// vector reads a block prefixed with an n-byte length
+func (r *reader) vector(n int) *reader {
+	data := r.next(r.uint(n))
+	return &reader{data: data, err: r.err}
+}
+
+// parseClientHello extracts the SNI and ALPN extensions from the first
+// TLS record of a stream
+func parseClientHello(data []byte) (clientHello, error) {
+	var hello clientHello
+	if len(data) < 5 {
+		return hello, errIncomplete
+	}
+	length := int(binary.BigEndian.Uint16(data[3:5]))
+	if len(data) < 5+length {
+		return hello, errIncomplete
+	}
+
+	// A truncated message inside a complete record is malformed, not
+	// something more data will fix
+	malformed := errors.New("malformed ClientHello")
+	handshake := &reader{data: data[5 : 5+length]}
+	if handshake.uint(1) != 1 {
+		return hello, errors.New("not a ClientHello")
+	}
+	body := handshake.vector(3)
+	body.next(2 + 32) // version and random
+	body.vector(1)    // session id
+	body.vector(2)    // cipher suites
+	body.vector(1)    // compression methods
+	if body.err != nil {
+		return hello, malformed
+	}
+	if len(body.data) == 0 {
+		return hello, nil // no extensions
+	}
+
+	extensions := body.vector(2)
+	for extensions.err == nil && len(extensions.data) > 0 {
+		kind := extensions.uint(2)
+		ext := extensions.vector(2)
+		switch kind {
+		case 0: // server_name
+			names := ext.vector(2)
+			for names.err == nil && len(names.data) > 0 {
+				nameType := names.uint(1)
+				name := names.vector(2)
+				if nameType == 0 && name.err == nil {
+					hello.serverName = strings.ToLower(string(name.data))
+				}
+			}
+		case 16: // application_layer_protocol_negotiation
+			protos := ext.vector(2)
+			for protos.err == nil && len(protos.data) > 0 {
+				if proto := protos.vector(1); proto.err == nil {
+					hello.alpn = append(hello.alpn, string(proto.data))
+				}
+			}
+		}
+	}
+	if extensions.err != nil {
+		return hello, malformed
+	}
+	return hello, nil
+}
+
+// AppUsage is a device's traffic to one service and hostname
+type AppUsage struct {
+	Service  string `json:"service"`
+	Hostname string `json:"hostname"`
+	Flows    int    `json:"flows"`
+	Bytes    uint64 `json:"bytes"`
+}
+
+// DeviceApps sums a device's classified flows by service and hostname,
+// busiest first
+func (nm *NetworkMonitor) DeviceApps(mac string) []AppUsage {
+	nm.mutex.RLock()
+	defer nm.mutex.RUnlock()
+	return nm.deviceApps(mac)
+}
+
+// deviceApps is DeviceApps for callers holding the mutex
+func (nm *NetworkMonitor) deviceApps(mac string) []AppUsage {
+	type appKey struct{ service, hostname string }
+	usage := make(map[appKey]*AppUsage)
+	add := func(f *Flow) {
+		if f.Service == "" || (f.ClientMAC != mac && f.ServerMAC != mac) {
+			return
+		}
+		key := appKey{f.Service, f.Hostname}
+		if usage[key] == nil {
+			usage[key] = &AppUsage{Service: f.Service, Hostname: f.Hostname}
+		}
+		usage[key].Flows++
+		usage[key].Bytes += f.BytesToServer + f.BytesToClient
+	}
+	for _, f := range nm.finishedFlows {
+		add(f)
+	}
+	for _, f := range nm.flows {
+		add(f)
+	}
+
+	apps := make([]AppUsage, 0, len(usage))
+	for _, u := range usage {
+		apps = append(apps, *u)
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		if apps[i].Bytes != apps[j].Bytes {
+			return apps[i].Bytes > apps[j].Bytes
+		}
+		return apps[i].Service+apps[i].Hostname < apps[j].Service+apps[j].Hostname
+	})
+	return apps
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApps(t *testing.T) {
+	const laptop = "3c:22:fb:11:22:33"
+	cases := []struct {
+		port     uint16
+		service  string
+		hostname string
+		alpn     []string
+		method   string
+		path     string
+	}{
+		{8443, serviceHTTPS, "api.example.com", []string{"h2", "http/1.1"}, "", ""},
+		{8080, serviceHTTP, "printer.local", nil, "GET", "/status?x=1"},
+		{2222, serviceSSH, "", nil, "", ""},
+		{993, serviceTLS, "mail.example.com", nil, "", ""},
+		{443, "", "", nil, "", ""},
+	}
+
+	nm := NewNetworkMonitor("")
+	if err := nm.ReadFile("testdata/apps.pcapng", false); err != nil {
+		t.Fatal(err)
+	}
+	flows := nm.Flows(laptop)
+	if len(flows) != len(cases) {
+		t.Fatalf("found %d flows want %d", len(flows), len(cases))
+	}
+	for i, c := range cases {
+		f := flows[i]
+		if f.ServerPort != c.port || f.Service != c.service || f.Hostname != c.hostname ||
+			!reflect.DeepEqual(f.ALPN, c.alpn) || f.Method != c.method || f.Path != c.path {
+			t.Fatalf("flow to port %d=%+v want %+v", f.ServerPort, f, c)
+		}
+	}
+	// Every ClientHello counts as HTTPS, and those offering HTTP as HTTPS flows
+	if stats := nm.GetStats(); stats.HTTPRequests != 1 || stats.HTTPSRequests != 2 || stats.HTTPSFlows != 1 {
+		t.Fatalf("HTTP=%d HTTPS=%d HTTPS flows=%d want 1, 2 and 1", stats.HTTPRequests, stats.HTTPSRequests, stats.HTTPSFlows)
+	}
+
+	var got []string
+	for _, app := range nm.DeviceApps(laptop) {
+		if app.Flows != 1 || app.Bytes == 0 {
+			t.Fatalf("app %+v want one flow with traffic", app)
+		}
+		got = append(got, app.Service+" "+app.Hostname)
+	}
+	want := []string{"https api.example.com", "http printer.local", "tls mail.example.com", "ssh "}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("DeviceApps=%q want %q", got, want)
+	}
+}
+
+func TestStreamBuffer(t *testing.T) {
+	cases := []struct {
+		start    uint32
+		segments []string // "seq:payload"
+		want     string
+	}{
+		{100, []string{"100:GET ", "104:/ HTTP"}, "GET / HTTP"},
+		{100, []string{"104:/ HTTP", "100:GET "}, "GET / HTTP"},
+		{100, []string{"100:GET ", "100:GET ", "104:/"}, "GET /"},
+		{100, []string{"100:GET ", "102:T /x"}, "GET /x"},
+		{100, []string{"100:GE", "110:later", "102:T"}, "GET"},
+		{4294967294, []string{"0:cd", "4294967294:ab"}, "abcd"},
+	}
+	for _, c := range cases {
+		var s streamBuffer
+		s.start(c.start)
+		for _, segment := range c.segments {
+			var seq uint32
+			var payload string
+			for i := range segment {
+				if segment[i] == ':' {
+					for _, d := range segment[:i] {
+						seq = seq*10 + uint32(d-'0')
+					}
+					payload = segment[i+1:]
+					break
+				}
+			}
+			s.add(seq, []byte(payload))
+		}
+		if string(s.data) != c.want {
+			t.Fatalf("segments %q reassembled to %q want %q", c.segments, s.data, c.want)
+		}
+	}
+}
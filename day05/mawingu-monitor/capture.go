@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// pcapngMagic is the block type of the section header that starts every
+// pcapng file
+const pcapngMagic = 0x0A0D0D0A
+
+// pcapngByteOrder is the section header's byte-order magic as written
+// by a big-endian machine
+const pcapngByteOrder = 0x1A2B3C4D
+
+// captureReader is what pcapgo's pcap and pcapng readers have in common
+type captureReader interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+}
+
+// openCapture opens a pcap or pcapng file, telling the formats apart by
+// their magic number
+func openCapture(r io.Reader) (captureReader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("reading file header: %w", err)
+	}
+	if binary.LittleEndian.Uint32(magic) == pcapngMagic {
+		return pcapgo.NewNgReader(&ngBlockReader{r: buffered}, pcapgo.DefaultNgReaderOptions)
+	}
+	return pcapgo.NewReader(buffered)
+}
+
+// ngBlockReader passes a pcapng file through, following its block
+// lengths so that a file ending partway through a block reads as
+// io.ErrUnexpectedEOF. pcapgo's pcapng reader reports that as a clean
+// io.EOF, where its pcap reader doesn't.
+type ngBlockReader struct {
+	r         io.Reader
+	offset    uint64 // bytes read so far
+	blockEnd  uint64 // where the current block ends
+	header    []byte // type, length and byte-order magic of the next block
+	bigEndian bool
+}
+
+func (b *ngBlockReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	for data := p[:n]; len(data) > 0; {
+		if b.offset < b.blockEnd {
+			skip := min(b.blockEnd-b.offset, uint64(len(data)))
+			b.offset += skip
+			data = data[skip:]
+			continue
+		}
+		take := min(12-len(b.header), len(data))
+		b.header = append(b.header, data[:take]...)
+		b.offset += uint64(take)
+		data = data[take:]
+		if len(b.header) < 12 {
+			continue
+		}
+		if binary.LittleEndian.Uint32(b.header) == pcapngMagic {
+			b.bigEndian = binary.BigEndian.Uint32(b.header[8:]) == pcapngByteOrder
+		}
+		length := binary.LittleEndian.Uint32(b.header[4:])
+		if b.bigEndian {
+			length = binary.BigEndian.Uint32(b.header[4:])
+		}
+		b.blockEnd = b.offset - 12 + uint64(length)
+		b.header = b.header[:0]
+	}
+	if err == io.EOF && (len(b.header) > 0 || b.offset < b.blockEnd) {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// ReadFile analyzes every packet in a pcap or pcapng file that passes the
+// capture filter. By default the file is read as fast as possible; with
+// realtime the packets are replayed at the pace they were captured. It
+// returns at the end of the file or when the monitor is stopped. A file
+// that ends partway through a packet is reported as truncated, after the
+// packets before the cut have been analyzed.
+func (nm *NetworkMonitor) ReadFile(path string, realtime bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader, err := openCapture(f)
+	if err != nil {
+		return err
+	}
+
+	var filter *pcap.BPF
+	if nm.options.Filter != "" {
+		if filter, err = pcap.NewBPF(reader.LinkType(), nm.options.SnapLen, nm.options.Filter); err != nil {
+			return fmt.Errorf("invalid filter %q: %v", nm.options.Filter, err)
+		}
+	}
+
+	nm.mutex.Lock()
+	nm.offline = true
+	nm.mutex.Unlock()
+
+	source := gopacket.NewPacketSource(reader, reader.LinkType())
+	started := time.Now()
+	var first time.Time
+	count := 0
+	for {
+		packet, err := source.NextPacket()
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("capture truncated after %d packets: %w", count, err)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("packet %d: %w", count+1, err)
+		}
+
+		if realtime {
+			captured := packet.Metadata().Timestamp
+			if first.IsZero() {
+				first = captured
+			}
+			if wait := captured.Sub(first) - time.Since(started); wait > 0 {
+				select {
+				case <-nm.stopChan:
+					return nil
+				case <-time.After(wait):
+				}
+			}
+		}
+		select {
+		case <-nm.stopChan:
+			return nil
+		default:
+		}
+
+		if filter != nil && !filter.Matches(packet.Metadata().CaptureInfo, packet.Data()) {
+			continue
+		}
+		nm.analyzePacket(packet)
+		count++
+	}
+
+	log.Printf("Read %d packets from %s in %s", count, path, time.Since(started).Round(time.Millisecond))
+	return nil
+}
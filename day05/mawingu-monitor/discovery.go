@@ -0,0 +1,235 @@
+package main
+
+import (
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// maxIPHistory caps the address changes kept per device
+const maxIPHistory = 100
+
+// mdnsPort is where multicast DNS announcements are sent
+const mdnsPort = 5353
+
+// IPChange records a device being seen with a new address
+type IPChange struct {
+	Time     time.Time `json:"time"`
+	IP       string    `json:"ip"`
+	Previous string    `json:"previous"` // the device's address before the change, if any
+	Source   string    `json:"source"`   // arp, ndp, dhcp, mdns or ip
+}
+
+// device returns the device for mac, creating it at seen if it is new
+func (nm *NetworkMonitor) device(mac string, seen time.Time) *Device {
+	device, exists := nm.devices[mac]
+	if !exists {
+		hw, _ := net.ParseMAC(mac)
+		device = &Device{
+			MAC:       mac,
+			Vendor:    nm.vendors.lookup(hw),
+			RandomMAC: isLocallyAdministered(hw),
+			FirstSeen: seen,
+			LastSeen:  seen,
+			IsActive:  true,
+		}
+		nm.devices[mac] = device
+		switch {
+		case device.RandomMAC:
+			log.Printf("New device detected: MAC=%s (randomized)", mac)
+		case device.Vendor != "":
+			log.Printf("New device detected: MAC=%s (%s)", mac, device.Vendor)
+		default:
+			log.Printf("New device detected: MAC=%s", mac)
+		}
+	}
+	return device
+}
+
+// learnIP binds an address to mac, recording it when it is new for the
+// device or becomes its primary address again. IPv4 addresses become the
+// device's primary address, IPv6 ones only when the device has nothing
+// better.
+func (nm *NetworkMonitor) learnIP(mac string, ip net.IP, source string, seen time.Time) {
+	if mac == nm.localMAC || !usableIP(ip) {
+		return
+	}
+	device := nm.device(mac, seen)
+	addr := ip.String()
+	known := false
+	for _, existing := range device.IPs {
+		known = known || existing == addr
+	}
+	// Moving back to an earlier address is still a change, however it was seen
+	if known && (device.IP == addr || !preferIP(ip, device.IP)) {
+		return
+	}
+
+	if !known {
+		device.IPs = append(device.IPs, addr)
+	}
+	change := IPChange{Time: seen, IP: addr, Previous: device.IP, Source: source}
+	device.IPHistory = append(device.IPHistory, change)
+	if len(device.IPHistory) > maxIPHistory {
+		device.IPHistory = device.IPHistory[len(device.IPHistory)-maxIPHistory:]
+	}
+
+	if preferIP(ip, device.IP) {
+		device.IP = addr
+	}
+	switch {
+	case change.Previous == "":
+		log.Printf("Device %s has IP %s (%s)", mac, addr, source)
+	case device.IP == addr:
+		log.Printf("Device %s changed IP: %s -> %s (%s)", mac, change.Previous, addr, source)
+	default:
+		log.Printf("Device %s is also %s (%s)", mac, addr, source)
+	}
+}
+
+// learnHostname names the device behind mac
+func (nm *NetworkMonitor) learnHostname(mac, name, source string, seen time.Time) {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "."), ".local")
+	if mac == nm.localMAC || name == "" {
+		return
+	}
+	device := nm.device(mac, seen)
+	if device.Hostname != name {
+		log.Printf("Device %s is named %q (%s)", mac, name, source)
+		device.Hostname = name
+	}
+}
+
+// usableIP reports whether ip identifies a single host
+func usableIP(ip net.IP) bool {
+	return ip != nil && !ip.IsUnspecified() && !ip.IsLoopback() && !ip.IsMulticast() &&
+		!ip.Equal(net.IPv4bcast)
+}
+
+// preferIP reports whether ip should replace current as a device's
+// primary address: IPv4 wins over IPv6, and routable IPv6 over link-local
+func preferIP(ip net.IP, current string) bool {
+	if current == "" || ip.To4() != nil {
+		return true
+	}
+	cur := net.ParseIP(current)
+	return cur.To4() == nil && cur.IsLinkLocalUnicast() && !ip.IsLinkLocalUnicast()
+}
+
+// onLink reports whether a source address can be trusted to belong to
+// the frame's sender rather than to a host behind a router: it must be
+// link-local or in one of the capture interface's subnets. Reading a
+// file there is no interface to ask, so any private address will do.
+func (nm *NetworkMonitor) onLink(ip net.IP) bool {
+	if ip.IsLinkLocalUnicast() {
+		return true
+	}
+	if len(nm.localNets) == 0 {
+		return ip.IsPrivate()
+	}
+	for _, subnet := range nm.localNets {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// discover learns addresses and hostnames from a packet. Bindings come
+// from ARP, NDP, DHCP and mDNS, and from source addresses on the local
+// network, which cannot have been routed.
+func (nm *NetworkMonitor) discover(packet gopacket.Packet, eth *layers.Ethernet, seen time.Time) {
+	srcMAC := eth.SrcMAC.String()
+
+	if arpLayer := packet.Layer(layers.LayerTypeARP); arpLayer != nil {
+		arp := arpLayer.(*layers.ARP)
+		nm.learnIP(net.HardwareAddr(arp.SourceHwAddress).String(), net.IP(arp.SourceProtAddress), "arp", seen)
+		if arp.Operation == layers.ARPReply {
+			nm.learnIP(net.HardwareAddr(arp.DstHwAddress).String(), net.IP(arp.DstProtAddress), "arp", seen)
+		}
+	}
+
+	if ipLayer := packet.Layer(layers.LayerTypeIPv4); ipLayer != nil {
+		if ip := ipLayer.(*layers.IPv4); nm.onLink(ip.SrcIP) {
+			nm.learnIP(srcMAC, ip.SrcIP, "ip", seen)
+		}
+	}
+	if ipLayer := packet.Layer(layers.LayerTypeIPv6); ipLayer != nil {
+		if ip := ipLayer.(*layers.IPv6); nm.onLink(ip.SrcIP) {
+			nm.learnIP(srcMAC, ip.SrcIP, "ip", seen)
+		}
+	}
+
+	if nsLayer := packet.Layer(layers.LayerTypeICMPv6NeighborSolicitation); nsLayer != nil {
+		if ip6 := packet.Layer(layers.LayerTypeIPv6); ip6 != nil {
+			for _, opt := range nsLayer.(*layers.ICMPv6NeighborSolicitation).Options {
+				if opt.Type == layers.ICMPv6OptSourceAddress && len(opt.Data) == 6 {
+					nm.learnIP(net.HardwareAddr(opt.Data).String(), ip6.(*layers.IPv6).SrcIP, "ndp", seen)
+				}
+			}
+		}
+	}
+	if naLayer := packet.Layer(layers.LayerTypeICMPv6NeighborAdvertisement); naLayer != nil {
+		na := naLayer.(*layers.ICMPv6NeighborAdvertisement)
+		mac := srcMAC
+		for _, opt := range na.Options {
+			if opt.Type == layers.ICMPv6OptTargetAddress && len(opt.Data) == 6 {
+				mac = net.HardwareAddr(opt.Data).String()
+			}
+		}
+		nm.learnIP(mac, na.TargetAddress, "ndp", seen)
+	}
+
+	if dhcpLayer := packet.Layer(layers.LayerTypeDHCPv4); dhcpLayer != nil {
+		nm.discoverDHCP(dhcpLayer.(*layers.DHCPv4), seen)
+	}
+
+	if udpLayer := packet.Layer(layers.LayerTypeUDP); udpLayer != nil {
+		udp := udpLayer.(*layers.UDP)
+		if udp.SrcPort == mdnsPort {
+			dns := &layers.DNS{}
+			if err := dns.DecodeFromBytes(udp.Payload, gopacket.NilDecodeFeedback); err == nil && dns.QR {
+				nm.discoverMDNS(srcMAC, dns, seen)
+			}
+		}
+	}
+}
+
+// discoverDHCP names clients from option 12 and binds acknowledged leases
+func (nm *NetworkMonitor) discoverDHCP(dhcp *layers.DHCPv4, seen time.Time) {
+	if len(dhcp.ClientHWAddr) != 6 {
+		return
+	}
+	mac := dhcp.ClientHWAddr.String()
+	msgType := layers.DHCPMsgTypeUnspecified
+	for _, opt := range dhcp.Options {
+		switch opt.Type {
+		case layers.DHCPOptHostname:
+			nm.learnHostname(mac, string(opt.Data), "dhcp", seen)
+		case layers.DHCPOptMessageType:
+			if len(opt.Data) == 1 {
+				msgType = layers.DHCPMsgType(opt.Data[0])
+			}
+		}
+	}
+	if msgType == layers.DHCPMsgTypeAck {
+		nm.learnIP(mac, dhcp.YourClientIP, "dhcp", seen)
+	}
+}
+
+// discoverMDNS learns a responder's name and addresses from the A and
+// AAAA records it announces for itself
+func (nm *NetworkMonitor) discoverMDNS(mac string, dns *layers.DNS, seen time.Time) {
+	records := append(append([]layers.DNSResourceRecord{}, dns.Answers...), dns.Additionals...)
+	for _, rr := range records {
+		if rr.Type != layers.DNSTypeA && rr.Type != layers.DNSTypeAAAA {
+			continue
+		}
+		nm.learnHostname(mac, string(rr.Name), "mdns", seen)
+		nm.learnIP(mac, rr.IP, "mdns", seen)
+	}
+}
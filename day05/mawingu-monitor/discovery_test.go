@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiscovery(t *testing.T) {
+	cases := []struct {
+		mac      string
+		ip       string
+		ips      []string
+		hostname string
+	}{
+		{"00:1a:2b:3c:4d:5e", "10.0.0.1", []string{"10.0.0.1"}, ""},
+		{"a4:c3:f0:12:34:56", "10.0.0.20", []string{"10.0.0.20", "fe80::a6c3:f0ff:fe12:3456"}, "pixel"},
+		{"3c:22:fb:11:22:33", "10.0.0.30", []string{"10.0.0.30", "10.0.0.31", "fe80::3e22:fbff:fe11:2233"}, "laptop"},
+		{"00:11:32:aa:bb:cc", "2001:db8::1234", []string{"fe80::211:32ff:feaa:bbcc", "2001:db8::1234"}, ""},
+	}
+
+	for _, file := range []string{"testdata/discovery.pcap", "testdata/discovery.pcapng"} {
+		nm := NewNetworkMonitor("")
+		if err := nm.ReadFile(file, false); err != nil {
+			t.Fatalf("ReadFile(%s): %v", file, err)
+		}
+		if len(nm.devices) != len(cases) {
+			t.Fatalf("ReadFile(%s) found %d devices want %d", file, len(nm.devices), len(cases))
+		}
+		for _, c := range cases {
+			dev := nm.devices[c.mac]
+			if dev == nil || dev.IP != c.ip || !reflect.DeepEqual(dev.IPs, c.ips) || dev.Hostname != c.hostname {
+				t.Fatalf("ReadFile(%s) %s=%+v want IP %s, IPs %v and hostname %q", file, c.mac, dev, c.ip, c.ips, c.hostname)
+			}
+		}
+
+		// The laptop's lease moved to .31 and back, 100ms per packet
+		want := []IPChange{
+			{fixtureStart.Add(300 * time.Millisecond), "10.0.0.30", "", "dhcp"},
+			{fixtureStart.Add(400 * time.Millisecond), "10.0.0.31", "10.0.0.30", "dhcp"},
+			{fixtureStart.Add(700 * time.Millisecond), "fe80::3e22:fbff:fe11:2233", "10.0.0.31", "ip"},
+			{fixtureStart.Add(800 * time.Millisecond), "10.0.0.30", "10.0.0.31", "dhcp"},
+		}
+		if got := nm.devices["3c:22:fb:11:22:33"].IPHistory; !reflect.DeepEqual(got, want) {
+			t.Fatalf("ReadFile(%s) laptop history %+v want %+v", file, got, want)
+		}
+	}
+}
+
+func TestPreferIP(t *testing.T) {
+	cases := []struct {
+		ip, current string
+		want        bool
+	}{
+		{"10.0.0.2", "", true},
+		{"10.0.0.2", "10.0.0.1", true},
+		{"10.0.0.2", "2001:db8::1", true},
+		{"fe80::1", "", true},
+		{"fe80::1", "10.0.0.1", false},
+		{"2001:db8::1", "fe80::1", true},
+		{"fe80::2", "fe80::1", false},
+		{"2001:db8::2", "2001:db8::1", false},
+	}
+	for _, c := range cases {
+		if got := preferIP(net.ParseIP(c.ip), c.current); got != c.want {
+			t.Fatalf("preferIP(%s, %q)=%v want %v", c.ip, c.current, got, c.want)
+		}
+	}
+}
+
+func TestLearnIP(t *testing.T) {
+	const mac = "3c:22:fb:11:22:33"
+	nm := NewNetworkMonitor("")
+
+	// Each step is one sighting and what the device looks like after it
+	steps := []struct {
+		ip, source string
+		primary    string
+		changes    int
+	}{
+		{"10.0.0.30", "dhcp", "10.0.0.30", 1},
+		{"10.0.0.31", "arp", "10.0.0.31", 2},
+		{"10.0.0.31", "ip", "10.0.0.31", 2},
+		{"fe80::1", "ndp", "10.0.0.31", 3},
+		// Back on an earlier address, seen from traffic rather than DHCP
+		{"10.0.0.30", "ip", "10.0.0.30", 4},
+		{"10.0.0.30", "arp", "10.0.0.30", 4},
+		// A known IPv6 address doesn't take over from IPv4
+		{"fe80::1", "ip", "10.0.0.30", 4},
+		{"10.0.0.31", "mdns", "10.0.0.31", 5},
+	}
+	changes := 0
+	for i, s := range steps {
+		nm.learnIP(mac, net.ParseIP(s.ip), s.source, fixtureStart.Add(time.Duration(i)*time.Second))
+		dev := nm.devices[mac]
+		if dev.IP != s.primary || len(dev.IPHistory) != s.changes {
+			t.Fatalf("step %d (%s via %s): IP=%s with %d changes want %s with %d", i, s.ip, s.source, dev.IP, len(dev.IPHistory), s.primary, s.changes)
+		}
+		if last := dev.IPHistory[len(dev.IPHistory)-1]; s.changes > changes && (last.IP != s.ip || last.Source != s.source) {
+			t.Fatalf("step %d recorded %+v", i, last)
+		}
+		changes = s.changes
+	}
+	if got := nm.devices[mac].IPs; !reflect.DeepEqual(got, []string{"10.0.0.30", "10.0.0.31", "fe80::1"}) {
+		t.Fatalf("IPs=%v", got)
+	}
+}
+
+func TestOnLink(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.1.0/24")
+	_, prefix, _ := net.ParseCIDR("2001:db8:1::/64")
+
+	cases := []struct {
+		localNets []*net.IPNet
+		ip        string
+		want      bool
+	}{
+		// Reading a file: private and link-local addresses
+		{nil, "10.0.0.10", true},
+		{nil, "fe80::1", true},
+		{nil, "93.184.216.34", false},
+		// Capturing live: only the interface's subnets
+		{[]*net.IPNet{lan, prefix}, "192.168.1.20", true},
+		{[]*net.IPNet{lan, prefix}, "2001:db8:1::20", true},
+		{[]*net.IPNet{lan, prefix}, "169.254.10.1", true},
+		{[]*net.IPNet{lan, prefix}, "10.8.0.2", false}, // a VPN behind the router
+		{[]*net.IPNet{lan, prefix}, "192.168.2.20", false},
+		{[]*net.IPNet{lan, prefix}, "2001:db8:2::20", false},
+	}
+	for _, c := range cases {
+		nm := NewNetworkMonitor("")
+		nm.localNets = c.localNets
+		if got := nm.onLink(net.ParseIP(c.ip)); got != c.want {
+			t.Fatalf("onLink(%s) with subnets %v=%v want %v", c.ip, c.localNets, got, c.want)
+		}
+	}
+}
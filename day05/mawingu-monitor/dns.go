@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// dnsTimeout is how long a query waits for its response
+const dnsTimeout = 5 * time.Second
+
+// maxDNSLog caps the lookups kept for searching
+const maxDNSLog = 10000
+
+// dnsTrimBatch is how far the log may grow past maxDNSLog before the
+// oldest lookups are dropped, so trimming isn't paid on every query
+const dnsTrimBatch = 1000
+
+// maxDomainsPerDevice caps the distinct names counted for each device
+const maxDomainsPerDevice = 1000
+
+// rcodeNames are the response codes as dig prints them
+var rcodeNames = map[layers.DNSResponseCode]string{
+	layers.DNSResponseCodeNoErr:    "NOERROR",
+	layers.DNSResponseCodeFormErr:  "FORMERR",
+	layers.DNSResponseCodeServFail: "SERVFAIL",
+	layers.DNSResponseCodeNXDomain: "NXDOMAIN",
+	layers.DNSResponseCodeNotImp:   "NOTIMP",
+	layers.DNSResponseCodeRefused:  "REFUSED",
+}
+
+// DNSRecord is one lookup: the question a device asked and, once it
+// arrives, the answer it got
+type DNSRecord struct {
+	Time     time.Time     `json:"time"`
+	MAC      string        `json:"mac"` // the device that asked
+	ClientIP string        `json:"client_ip"`
+	ServerIP string        `json:"server_ip"`
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Rcode    string        `json:"rcode"`   // empty until a response is seen
+	Answers  []string      `json:"answers"` // addresses, or "CNAME target" style for other records
+	Latency  time.Duration `json:"-"`       // time from query to response
+}
+
+// MarshalJSON adds the latency in milliseconds, as the flow export
+// gives durations
+func (r DNSRecord) MarshalJSON() ([]byte, error) {
+	type record DNSRecord
+	return json.Marshal(struct {
+		record
+		LatencyMS float64 `json:"latency_ms"`
+	}{record(r), float64(r.Latency) / float64(time.Millisecond)})
+}
+
+// DomainCount is how often a name was looked up
+type DomainCount struct {
+	Name    string `json:"name"`
+	Queries uint64 `json:"queries"`
+}
+
+// DNSSummary describes a device's lookups
+type DNSSummary struct {
+	MAC          string        `json:"mac"`
+	Queries      uint64        `json:"queries"`
+	Responses    uint64        `json:"responses"`
+	NXDomain     uint64        `json:"nxdomain"`
+	NXDomainRate float64       `json:"nxdomain_rate"` // percentage of responses
+	TopDomains   []DomainCount `json:"top_domains"`
+}
+
+// DNSFilter selects lookups from the log. Empty fields match everything.
+type DNSFilter struct {
+	MAC    string
+	Domain string // case-insensitive substring of the name
+	Rcode  string // e.g. NXDOMAIN, or "none" for unanswered queries
+	Limit  int    // newest first, 0 for all
+}
+
+// dnsKey matches a response to its query
+type dnsKey struct {
+	flow FlowKey
+	id   uint16
+}
+
+// dnsPending is a query waiting for its response
+type dnsPending struct {
+	records []*DNSRecord
+	asked   time.Time
+}
+
+// deviceDNS counts one device's lookups
+type deviceDNS struct {
+	queries, responses, nxdomain uint64
+	domains                      map[string]uint64
+}
+
+// rcodeName returns the dig-style name of a response code
+func rcodeName(code layers.DNSResponseCode) string {
+	if name, ok := rcodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", code)
+}
+
+// typeName returns a record type's name, falling back to the number for
+// types gopacket does not know, such as HTTPS
+func typeName(t layers.DNSType) string {
+	if name := t.String(); name != "Unknown" {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", uint16(t))
+}
+
+// answerString describes a resource record's data
+func answerString(rr layers.DNSResourceRecord) string {
+	switch rr.Type {
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		return rr.IP.String()
+	case layers.DNSTypeCNAME:
+		return "CNAME " + string(rr.CNAME)
+	case layers.DNSTypePTR:
+		return "PTR " + string(rr.PTR)
+	case layers.DNSTypeNS:
+		return "NS " + string(rr.NS)
+	case layers.DNSTypeMX:
+		return "MX " + string(rr.MX.Name)
+	}
+	return typeName(rr.Type)
+}
+
+// trackDNS logs a query or completes the lookup a response answers. The
+// flow is oriented from the device that asked to its resolver.
+func (nm *NetworkMonitor) trackDNS(dns *layers.DNS, flow *Flow, seen time.Time) {
+	key := dnsKey{flow.FlowKey, dns.ID}
+
+	if !dns.QR {
+		stats := nm.dnsStats[flow.ClientMAC]
+		if stats == nil {
+			stats = &deviceDNS{domains: make(map[string]uint64)}
+			nm.dnsStats[flow.ClientMAC] = stats
+		}
+		pending := &dnsPending{asked: seen}
+		for _, q := range dns.Questions {
+			name := strings.ToLower(strings.TrimSuffix(string(q.Name), "."))
+			record := &DNSRecord{Time: seen, MAC: flow.ClientMAC, ClientIP: flow.ClientIP, ServerIP: flow.ServerIP,
+				Name: name, Type: typeName(q.Type)}
+			pending.records = append(pending.records, record)
+			nm.dnsLog = append(nm.dnsLog, record)
+
+			nm.stats.DNSQueries++
+			stats.queries++
+			if _, ok := stats.domains[name]; ok || len(stats.domains) < maxDomainsPerDevice {
+				stats.domains[name]++
+			}
+		}
+		if len(nm.dnsLog) > maxDNSLog+dnsTrimBatch {
+			n := copy(nm.dnsLog, nm.dnsLog[len(nm.dnsLog)-maxDNSLog:])
+			for i := n; i < len(nm.dnsLog); i++ {
+				nm.dnsLog[i] = nil
+			}
+			nm.dnsLog = nm.dnsLog[:n]
+		}
+		nm.dnsPending[key] = pending
+		return
+	}
+
+	pending, ok := nm.dnsPending[key]
+	if !ok {
+		return // the query was missed or already answered
+	}
+	delete(nm.dnsPending, key)
+
+	var answers []string
+	for _, rr := range dns.Answers {
+		answers = append(answers, answerString(rr))
+	}
+	for _, record := range pending.records {
+		record.Rcode = rcodeName(dns.ResponseCode)
+		record.Answers = answers
+		record.Latency = seen.Sub(pending.asked)
+	}
+	if stats := nm.dnsStats[flow.ClientMAC]; stats != nil {
+		stats.responses++
+		if dns.ResponseCode == layers.DNSResponseCodeNXDomain {
+			stats.nxdomain++
+		}
+	}
+}
+
+// expireDNS forgets queries that were never answered; they stay in the
+// log without a response code. The caller must hold the mutex.
+func (nm *NetworkMonitor) expireDNS() {
+	now := nm.now()
+	for key, pending := range nm.dnsPending {
+		if now.Sub(pending.asked) > dnsTimeout {
+			delete(nm.dnsPending, key)
+		}
+	}
+}
+
+// DNSSummary returns a device's lookup counts and its n most queried
+// names
+func (nm *NetworkMonitor) DNSSummary(mac string, n int) DNSSummary {
+	nm.mutex.RLock()
+	defer nm.mutex.RUnlock()
+	return nm.dnsSummary(mac, n)
+}
+
+// dnsSummary is DNSSummary for callers holding the mutex
+func (nm *NetworkMonitor) dnsSummary(mac string, n int) DNSSummary {
+	summary := DNSSummary{MAC: mac}
+	stats := nm.dnsStats[mac]
+	if stats == nil {
+		return summary
+	}
+	summary.Queries, summary.Responses, summary.NXDomain = stats.queries, stats.responses, stats.nxdomain
+	if stats.responses > 0 {
+		summary.NXDomainRate = float64(stats.nxdomain) / float64(stats.responses) * 100
+	}
+
+	for name, count := range stats.domains {
+		summary.TopDomains = append(summary.TopDomains, DomainCount{name, count})
+	}
+	sort.Slice(summary.TopDomains, func(i, j int) bool {
+		a, b := summary.TopDomains[i], summary.TopDomains[j]
+		return a.Queries > b.Queries || (a.Queries == b.Queries && a.Name < b.Name)
+	})
+	if len(summary.TopDomains) > n {
+		summary.TopDomains = summary.TopDomains[:n]
+	}
+	return summary
+}
+
+// SearchDNS returns copies of the logged lookups matching f, newest first
+func (nm *NetworkMonitor) SearchDNS(f DNSFilter) []DNSRecord {
+	nm.mutex.RLock()
+	defer nm.mutex.RUnlock()
+
+	domain := strings.ToLower(f.Domain)
+	var records []DNSRecord
+	oldest := max(len(nm.dnsLog)-maxDNSLog, 0)
+	for i := len(nm.dnsLog) - 1; i >= oldest; i-- {
+		r := nm.dnsLog[i]
+		rcode := r.Rcode
+		if rcode == "" {
+			rcode = "none"
+		}
+		if (f.MAC != "" && r.MAC != f.MAC) || !strings.Contains(r.Name, domain) ||
+			(f.Rcode != "" && !strings.EqualFold(rcode, f.Rcode)) {
+			continue
+		}
+		record := *r
+		record.Answers = append([]string(nil), r.Answers...)
+		records = append(records, record)
+		if f.Limit > 0 && len(records) == f.Limit {
+			break
+		}
+	}
+	return records
+}
+
+// printDNS prints the lookups matching f
+func (nm *NetworkMonitor) printDNS(f DNSFilter) {
+	records := nm.SearchDNS(f)
+	fmt.Printf("\n🔎 %d DNS lookups matching %q\n", len(records), f.Domain)
+	for _, r := range records {
+		result := r.Rcode
+		if result == "" {
+			result = "no response"
+		} else {
+			result = fmt.Sprintf("%s in %s", result, r.Latency.Round(time.Millisecond))
+		}
+		fmt.Printf("%s  %-17s  %-5s %s -> %s", r.Time.Format("2006-01-02 15:04:05.000"), r.MAC, r.Type, r.Name, result)
+		if len(r.Answers) > 0 {
+			fmt.Printf(" [%s]", strings.Join(r.Answers, ", "))
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestDNS(t *testing.T) {
+	const laptop, phone = "3c:22:fb:11:22:33", "a4:c3:f0:12:34:56"
+	nm := NewNetworkMonitor("")
+	if err := nm.ReadFile("testdata/dns.pcapng", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := nm.GetStats().DNSQueries; got != 5 {
+		t.Fatalf("DNSQueries=%d want 5", got)
+	}
+
+	summaries := []DNSSummary{
+		{laptop, 4, 3, 1, 100.0 / 3, []DomainCount{{"example.com", 2}, {"nosuch.example", 1}}},
+		{phone, 1, 1, 0, 0, []DomainCount{{"api.example.org", 1}}},
+		{"00:1a:2b:3c:4d:5e", 0, 0, 0, 0, nil},
+	}
+	for _, want := range summaries {
+		got := nm.DNSSummary(want.MAC, 2)
+		if math.Abs(got.NXDomainRate-want.NXDomainRate) > 1e-9 {
+			t.Fatalf("DNSSummary(%s) NXDOMAIN rate=%v want %v", want.MAC, got.NXDomainRate, want.NXDomainRate)
+		}
+		got.NXDomainRate = want.NXDomainRate
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("DNSSummary(%s)=%+v want %+v", want.MAC, got, want)
+		}
+	}
+
+	cases := []struct {
+		filter DNSFilter
+		want   []string // names, newest first
+	}{
+		{DNSFilter{}, []string{"slow.example", "api.example.org", "example.com", "nosuch.example", "example.com"}},
+		{DNSFilter{Domain: "EXAMPLE.com"}, []string{"example.com", "example.com"}},
+		{DNSFilter{MAC: phone}, []string{"api.example.org"}},
+		{DNSFilter{Rcode: "nxdomain"}, []string{"nosuch.example"}},
+		{DNSFilter{Rcode: "none"}, []string{"slow.example"}},
+		{DNSFilter{MAC: laptop, Limit: 2}, []string{"slow.example", "example.com"}},
+		{DNSFilter{Domain: "nothing"}, nil},
+	}
+	for _, c := range cases {
+		var names []string
+		for _, r := range nm.SearchDNS(c.filter) {
+			names = append(names, r.Name)
+		}
+		if !reflect.DeepEqual(names, c.want) {
+			t.Fatalf("SearchDNS(%+v)=%v want %v", c.filter, names, c.want)
+		}
+	}
+
+	// Responses fill in the answers, code and latency of their query
+	aaaa := nm.SearchDNS(DNSFilter{Domain: "example.com", Limit: 1})[0]
+	if aaaa.Type != "AAAA" || aaaa.Rcode != "NOERROR" || aaaa.Latency.Milliseconds() != 100 ||
+		!reflect.DeepEqual(aaaa.Answers, []string{"CNAME edge.example.net", "2606:2800:220:1::1"}) {
+		t.Fatalf("AAAA lookup=%+v", aaaa)
+	}
+}
+
+func TestDNSLogTrim(t *testing.T) {
+	nm := NewNetworkMonitor("")
+	flow := &Flow{FlowKey: FlowKey{"udp", "10.0.0.10", 40000, "10.0.0.1", 53}, ClientMAC: "3c:22:fb:11:22:33"}
+	name := func(i int) string { return fmt.Sprintf("host%d.example", i) }
+
+	// Searches return the newest maxDNSLog lookups at any point, whether or
+	// not the log has been trimmed yet
+	for i := 0; i < maxDNSLog+2*dnsTrimBatch; i++ {
+		dns := &layers.DNS{ID: uint16(i), Questions: []layers.DNSQuestion{{Name: []byte(name(i)), Type: layers.DNSTypeA}}}
+		nm.trackDNS(dns, flow, fixtureStart.Add(time.Duration(i)*time.Millisecond))
+		if i < maxDNSLog-1 || i%(dnsTrimBatch/2) != 0 {
+			continue
+		}
+
+		records := nm.SearchDNS(DNSFilter{})
+		if len(records) != maxDNSLog {
+			t.Fatalf("after %d lookups search returned %d want %d", i+1, len(records), maxDNSLog)
+		}
+		if newest, oldest := records[0].Name, records[len(records)-1].Name; newest != name(i) || oldest != name(i-maxDNSLog+1) {
+			t.Fatalf("after %d lookups search returned %s back to %s", i+1, newest, oldest)
+		}
+		if dropped := nm.SearchDNS(DNSFilter{Domain: name(i - maxDNSLog)}); i >= maxDNSLog && len(dropped) != 0 {
+			t.Fatalf("after %d lookups %s is still found", i+1, name(i-maxDNSLog))
+		}
+	}
+}
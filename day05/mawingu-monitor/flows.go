@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// TCP flow states
+const (
+	flowSynSent     = "syn_sent"
+	flowSynReceived = "syn_received"
+	flowEstablished = "established"
+	flowClosing     = "closing" // one side sent FIN
+	flowClosed      = "closed"  // both sides sent FIN
+	flowReset       = "reset"
+	flowActive      = "active" // UDP flows have no handshake
+)
+
+// Idle time after which a flow is considered over
+const (
+	tcpOpeningTimeout = 30 * time.Second
+	tcpIdleTimeout    = 5 * time.Minute
+	tcpClosedTimeout  = 10 * time.Second
+	udpIdleTimeout    = time.Minute
+)
+
+// flowSweepInterval is how often idle flows are expired
+const flowSweepInterval = 10 * time.Second
+
+// maxFinishedFlows caps the expired flows kept for export
+const maxFinishedFlows = 10000
+
+// FlowKey identifies a flow by its 5-tuple, oriented from the client
+// that opened it to the server
+type FlowKey struct {
+	Protocol   string `json:"protocol"`
+	ClientIP   string `json:"client_ip"`
+	ClientPort uint16 `json:"client_port"`
+	ServerIP   string `json:"server_ip"`
+	ServerPort uint16 `json:"server_port"`
+}
+
+// reverse is the key as seen from the server's side
+func (k FlowKey) reverse() FlowKey {
+	return FlowKey{k.Protocol, k.ServerIP, k.ServerPort, k.ClientIP, k.ClientPort}
+}
+
+// Flow is a TCP connection or UDP conversation
+type Flow struct {
+	FlowKey
+	ClientMAC       string    `json:"client_mac"`
+	ServerMAC       string    `json:"server_mac"`
+	State           string    `json:"state"`
+	Service         string    `json:"service"`  // http, https, tls or ssh, from the payload
+	Hostname        string    `json:"hostname"` // TLS SNI or HTTP Host
+	ALPN            []string  `json:"alpn"`     // protocols offered in the ClientHello
+	Method          string    `json:"method"`   // first HTTP request
+	Path            string    `json:"path"`
+	FirstSeen       time.Time `json:"first_seen"`
+	LastSeen        time.Time `json:"last_seen"`
+	PacketsToServer uint64    `json:"packets_to_server"`
+	PacketsToClient uint64    `json:"packets_to_client"`
+	BytesToServer   uint64    `json:"bytes_to_server"`
+	BytesToClient   uint64    `json:"bytes_to_client"`
+
+	clientFin, serverFin bool
+	stream               *streamBuffer // client bytes until classified
+}
+
+// Duration is how long the flow has been seen for
+func (f *Flow) Duration() time.Duration {
+	return f.LastSeen.Sub(f.FirstSeen)
+}
+
+// MarshalJSON adds the duration in milliseconds, as the CSV export has it
+func (f Flow) MarshalJSON() ([]byte, error) {
+	type flow Flow
+	return json.Marshal(struct {
+		flow
+		DurationMS int64 `json:"duration_ms"`
+	}{flow(f), f.Duration().Milliseconds()})
+}
+
+// updateTCP moves a TCP flow through its states. A reset flow stays
+// reset, whatever the other side still sends.
+func (f *Flow) updateTCP(tcp *layers.TCP, toServer bool) {
+	if f.State == flowReset {
+		return
+	}
+	switch {
+	case tcp.RST:
+		f.State = flowReset
+	case tcp.FIN:
+		if toServer {
+			f.clientFin = true
+		} else {
+			f.serverFin = true
+		}
+		f.State = flowClosing
+		if f.clientFin && f.serverFin {
+			f.State = flowClosed
+		}
+	case tcp.SYN && !tcp.ACK:
+		if f.State == "" {
+			f.State = flowSynSent
+		}
+	case tcp.SYN && tcp.ACK:
+		if f.State == "" || f.State == flowSynSent {
+			f.State = flowSynReceived
+		}
+	case tcp.ACK:
+		if f.State == "" || (f.State == flowSynReceived && toServer) {
+			f.State = flowEstablished
+		}
+	}
+}
+
+// idleTimeout is how long a flow in its current state may stay quiet
+func (f *Flow) idleTimeout() time.Duration {
+	switch f.State {
+	case flowActive:
+		return udpIdleTimeout
+	case flowSynSent, flowSynReceived:
+		return tcpOpeningTimeout
+	case flowClosing, flowClosed, flowReset:
+		return tcpClosedTimeout
+	}
+	return tcpIdleTimeout
+}
+
+// trackFlow adds a TCP or UDP packet to its flow, creating the flow if
+// needed. It returns nil for other packets.
+func (nm *NetworkMonitor) trackFlow(packet gopacket.Packet, eth *layers.Ethernet, seen time.Time) *Flow {
+	network := packet.NetworkLayer()
+	if network == nil {
+		return nil
+	}
+	src, dst := network.NetworkFlow().Endpoints()
+	key := FlowKey{ClientIP: src.String(), ServerIP: dst.String()}
+
+	var tcp *layers.TCP
+	var opening bool // the packet says which side is the client
+	if tcpLayer := packet.Layer(layers.LayerTypeTCP); tcpLayer != nil {
+		tcp = tcpLayer.(*layers.TCP)
+		key.Protocol, key.ClientPort, key.ServerPort = "tcp", uint16(tcp.SrcPort), uint16(tcp.DstPort)
+		opening = tcp.SYN
+	} else if udpLayer := packet.Layer(layers.LayerTypeUDP); udpLayer != nil {
+		udp := udpLayer.(*layers.UDP)
+		key.Protocol, key.ClientPort, key.ServerPort = "udp", uint16(udp.SrcPort), uint16(udp.DstPort)
+	} else {
+		return nil
+	}
+
+	toServer := true
+	flow, exists := nm.flows[key]
+	if !exists {
+		if flow, exists = nm.flows[key.reverse()]; exists {
+			toServer = false
+		}
+	}
+	if exists && tcp != nil && tcp.SYN && !tcp.ACK && (flow.State == flowClosed || flow.State == flowReset) {
+		// The 4-tuple is being reused for a new connection
+		nm.retireFlow(flow)
+		exists, toServer = false, true
+	}
+	if !exists {
+		// A SYN-ACK comes from the server, and without a handshake to go
+		// by the side on the lower port is taken to be the server
+		reversed := (tcp != nil && tcp.SYN && tcp.ACK) || (!opening && key.ClientPort < key.ServerPort)
+		clientMAC, serverMAC := eth.SrcMAC.String(), eth.DstMAC.String()
+		if reversed {
+			key, toServer = key.reverse(), false
+			clientMAC, serverMAC = serverMAC, clientMAC
+		}
+		flow = &Flow{FlowKey: key, ClientMAC: clientMAC, ServerMAC: serverMAC, FirstSeen: seen}
+		if tcp == nil {
+			flow.State = flowActive
+		} else {
+			flow.stream = &streamBuffer{}
+		}
+		nm.flows[key] = flow
+		nm.attachFlow(flow, 1)
+		if tcp != nil {
+			nm.stats.TCPConns++
+		} else {
+			nm.stats.UDPConns++
+		}
+	}
+
+	flow.LastSeen = seen
+	size := uint64(len(packet.Data()))
+	if toServer {
+		flow.PacketsToServer++
+		flow.BytesToServer += size
+	} else {
+		flow.PacketsToClient++
+		flow.BytesToClient += size
+	}
+	if tcp != nil {
+		flow.updateTCP(tcp, toServer)
+		if toServer && flow.inspectPayload(tcp) {
+			switch flow.Service {
+			case serviceHTTP:
+				nm.stats.HTTPRequests++
+			case serviceHTTPS:
+				nm.stats.HTTPSRequests++
+				nm.stats.HTTPSFlows++
+			case serviceTLS:
+				nm.stats.HTTPSRequests++
+			}
+		}
+	}
+	return flow
+}
+
+// attachFlow adds delta to the connection counts of a flow's devices
+func (nm *NetworkMonitor) attachFlow(flow *Flow, delta int) {
+	for _, mac := range []string{flow.ClientMAC, flow.ServerMAC} {
+		if device, ok := nm.devices[mac]; ok {
+			device.Connections += delta
+		}
+	}
+}
+
+// retireFlow moves a flow from the active to the finished flows. The
+// caller must hold the mutex.
+func (nm *NetworkMonitor) retireFlow(flow *Flow) {
+	delete(nm.flows, flow.FlowKey)
+	nm.attachFlow(flow, -1)
+	nm.finishedFlows = append(nm.finishedFlows, flow)
+}
+
+// expireFlows retires flows that have been idle past their timeout. The
+// caller must hold the mutex.
+func (nm *NetworkMonitor) expireFlows() {
+	now := nm.now()
+	for _, flow := range nm.flows {
+		if now.Sub(flow.LastSeen) <= flow.idleTimeout() {
+			continue
+		}
+		nm.retireFlow(flow)
+	}
+	if over := len(nm.finishedFlows) - maxFinishedFlows; over > 0 {
+		nm.finishedFlows = append([]*Flow(nil), nm.finishedFlows[over:]...)
+	}
+	nm.lastFlowSweep = now
+}
+
+// Flows returns copies of the active and recently finished flows, oldest
+// first. With mac set only that device's flows are returned.
+func (nm *NetworkMonitor) Flows(mac string) []Flow {
+	nm.mutex.RLock()
+	defer nm.mutex.RUnlock()
+
+	flows := make([]Flow, 0, len(nm.flows)+len(nm.finishedFlows))
+	add := func(f *Flow) {
+		if mac == "" || f.ClientMAC == mac || f.ServerMAC == mac {
+			flow := *f
+			flow.ALPN = append([]string(nil), f.ALPN...)
+			flow.stream = nil
+			flows = append(flows, flow)
+		}
+	}
+	for _, f := range nm.finishedFlows {
+		add(f)
+	}
+	for _, f := range nm.flows {
+		add(f)
+	}
+	sort.SliceStable(flows, func(i, j int) bool {
+		return flows[i].FirstSeen.Before(flows[j].FirstSeen)
+	})
+	return flows
+}
+
+// flowHeader names the CSV export columns
+var flowHeader = []string{"protocol", "client_ip", "client_port", "client_mac", "server_ip", "server_port", "server_mac",
+	"state", "service", "hostname", "first_seen", "last_seen", "duration_ms", "packets_to_server", "packets_to_client", "bytes_to_server", "bytes_to_client"}
+
+// writeFlowsCSV exports flows as CSV
+func writeFlowsCSV(w io.Writer, flows []Flow) error {
+	out := csv.NewWriter(w)
+	out.Write(flowHeader)
+	for _, f := range flows {
+		out.Write([]string{
+			f.Protocol, f.ClientIP, strconv.Itoa(int(f.ClientPort)), f.ClientMAC,
+			f.ServerIP, strconv.Itoa(int(f.ServerPort)), f.ServerMAC, f.State, f.Service, f.Hostname,
+			f.FirstSeen.UTC().Format(time.RFC3339Nano), f.LastSeen.UTC().Format(time.RFC3339Nano),
+			strconv.FormatInt(f.Duration().Milliseconds(), 10),
+			strconv.FormatUint(f.PacketsToServer, 10), strconv.FormatUint(f.PacketsToClient, 10),
+			strconv.FormatUint(f.BytesToServer, 10), strconv.FormatUint(f.BytesToClient, 10),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// exportFlows writes every known flow to path, as JSON when the name ends
+// in .json and as CSV otherwise
+func (nm *NetworkMonitor) exportFlows(path string) error {
+	flows := nm.Flows("")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(flows)
+	} else {
+		err = writeFlowsCSV(f, flows)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("📁 Exported %d flows to %s\n", len(flows), path)
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFlows(t *testing.T) {
+	const laptop, router = "3c:22:fb:11:22:33", "00:1a:2b:3c:4d:5e"
+	cases := []struct {
+		key         FlowKey
+		state       string
+		toServer    uint64
+		toClient    uint64
+		first, last time.Duration
+	}{
+		{FlowKey{"tcp", "10.0.0.10", 50000, "93.184.216.34", 443}, flowClosed, 5, 3, 0, 700 * time.Millisecond},
+		{FlowKey{"tcp", "10.0.0.10", 50001, "93.184.216.34", 22}, flowReset, 1, 1, 800 * time.Millisecond, 900 * time.Millisecond},
+		{FlowKey{"tcp", "10.0.0.10", 50002, "93.184.216.34", 8080}, flowEstablished, 0, 1, time.Second, time.Second},
+		{FlowKey{"udp", "10.0.0.10", 40000, "10.0.0.1", 123}, flowActive, 1, 1, 1100 * time.Millisecond, 1200 * time.Millisecond},
+		{FlowKey{"tcp", "10.0.0.10", 50003, "93.184.216.34", 80}, flowSynSent, 1, 0, 6*time.Minute + 1300*time.Millisecond, 6*time.Minute + 1300*time.Millisecond},
+	}
+
+	nm := NewNetworkMonitor("")
+	if err := nm.ReadFile("testdata/flows.pcap", false); err != nil {
+		t.Fatal(err)
+	}
+	flows := nm.Flows(laptop)
+	if len(flows) != len(cases) {
+		t.Fatalf("Flows(%s) returned %d flows want %d", laptop, len(flows), len(cases))
+	}
+	for i, c := range cases {
+		f := flows[i]
+		if f.FlowKey != c.key || f.State != c.state || f.PacketsToServer != c.toServer || f.PacketsToClient != c.toClient ||
+			!f.FirstSeen.Equal(fixtureStart.Add(c.first)) || !f.LastSeen.Equal(fixtureStart.Add(c.last)) ||
+			f.ClientMAC != laptop || f.ServerMAC != router {
+			t.Fatalf("flow %d=%+v want %+v", i, f, c)
+		}
+	}
+
+	// The pause before the last connection expired every earlier flow
+	stats := nm.GetStats()
+	if len(nm.flows) != 1 || len(nm.finishedFlows) != 4 || stats.TCPConns != 4 || stats.UDPConns != 1 {
+		t.Fatalf("active=%d finished=%d tcp=%d udp=%d want 1, 4, 4 and 1", len(nm.flows), len(nm.finishedFlows), stats.TCPConns, stats.UDPConns)
+	}
+	for _, mac := range []string{laptop, router} {
+		if got := nm.devices[mac].Connections; got != 1 {
+			t.Fatalf("%s has %d connections want 1", mac, got)
+		}
+	}
+	if got := nm.Flows("02:00:00:00:00:01"); len(got) != 0 {
+		t.Fatalf("Flows for an unknown device returned %d flows", len(got))
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"flows.json", "flows.csv"} {
+		path := filepath.Join(dir, name)
+		if err := nm.exportFlows(path); err != nil {
+			t.Fatal(err)
+		}
+		f, _ := os.Open(path)
+		var rows int
+		if filepath.Ext(name) == ".json" {
+			var exported []map[string]any
+			json.NewDecoder(f).Decode(&exported)
+			rows = len(exported)
+			if first := exported[0]; first["client_port"] != 50000.0 || first["duration_ms"] != 700.0 {
+				t.Fatalf("first exported flow=%v want port 50000 lasting 700ms", first)
+			}
+		} else {
+			records, _ := csv.NewReader(f).ReadAll()
+			rows = len(records) - 1
+		}
+		f.Close()
+		if rows != len(cases) {
+			t.Fatalf("%s has %d flows want %d", name, rows, len(cases))
+		}
+	}
+}
+
+func TestFlowReuse(t *testing.T) {
+	const laptop = "3c:22:fb:11:22:33"
+	key := FlowKey{"tcp", "10.0.0.10", 50010, "93.184.216.34", 443}
+	cases := []struct {
+		state       string
+		toServer    uint64
+		toClient    uint64
+		first, last time.Duration
+	}{
+		// The server's FIN after the RST leaves the first connection reset
+		{flowReset, 3, 2, 0, 400 * time.Millisecond},
+		{flowClosed, 5, 2, 500 * time.Millisecond, 1100 * time.Millisecond},
+		{flowSynSent, 1, 0, 1200 * time.Millisecond, 1200 * time.Millisecond},
+	}
+
+	nm := NewNetworkMonitor("")
+	if err := nm.ReadFile("testdata/reuse.pcap", false); err != nil {
+		t.Fatal(err)
+	}
+	flows := nm.Flows(laptop)
+	if len(flows) != len(cases) {
+		t.Fatalf("Flows(%s) returned %d flows want %d", laptop, len(flows), len(cases))
+	}
+	for i, c := range cases {
+		f := flows[i]
+		if f.FlowKey != key || f.State != c.state || f.PacketsToServer != c.toServer || f.PacketsToClient != c.toClient ||
+			!f.FirstSeen.Equal(fixtureStart.Add(c.first)) || !f.LastSeen.Equal(fixtureStart.Add(c.last)) {
+			t.Fatalf("flow %d=%+v want %+v", i, f, c)
+		}
+	}
+	if stats := nm.GetStats(); stats.TCPConns != 3 || len(nm.flows) != 1 || len(nm.finishedFlows) != 2 {
+		t.Fatalf("tcp=%d active=%d finished=%d want 3, 1 and 2", stats.TCPConns, len(nm.flows), len(nm.finishedFlows))
+	}
+	if got := nm.devices[laptop].Connections; got != 1 {
+		t.Fatalf("%s has %d connections want 1", laptop, got)
+	}
+}
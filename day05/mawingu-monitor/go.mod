@@ -2,6 +2,14 @@ module mawingu-monitor
 
 go 1.21
 
-require github.com/google/gopacket v1.1.19
+require (
+	github.com/google/gopacket v1.1.19
+	github.com/gorilla/mux v1.8.1
+	github.com/gorilla/websocket v1.5.1
+	go.etcd.io/bbolt v1.3.8
+)
 
-require golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
+require (
+	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+)
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultInventory is where live captures and the devices command keep
+// the device inventory unless -db names another file
+const defaultInventory = "mawingu.db"
+
+// inventorySaveInterval is how often devices are written to the inventory
+const inventorySaveInterval = time.Minute
+
+// devicesBucket holds one JSON storedDevice per MAC
+var devicesBucket = []byte("devices")
+
+// errUnknownDevice is returned when labelling a MAC that was never seen
+var errUnknownDevice = errors.New("unknown device")
+
+// storedDevice is the part of a Device that outlives the process; traffic
+// counters start again from zero on each run
+type storedDevice struct {
+	MAC       string     `json:"mac"`
+	IP        string     `json:"ip"`
+	IPs       []string   `json:"ips"`
+	IPHistory []IPChange `json:"ip_history"`
+	Hostname  string     `json:"hostname"`
+	Vendor    string     `json:"vendor"`
+	RandomMAC bool       `json:"random_mac"`
+	Label     string     `json:"label"`
+	Trusted   bool       `json:"trusted"`
+	FirstSeen time.Time  `json:"first_seen"`
+	LastSeen  time.Time  `json:"last_seen"`
+}
+
+// DeviceLabel changes what the user has said about a device. Nil fields
+// are left alone.
+type DeviceLabel struct {
+	Label   *string `json:"label"`
+	Trusted *bool   `json:"trusted"`
+}
+
+// apply makes the change to d
+func (l DeviceLabel) apply(d *Device) {
+	if l.Label != nil {
+		d.Label = strings.TrimSpace(*l.Label)
+	}
+	if l.Trusted != nil {
+		d.Trusted = *l.Trusted
+	}
+}
+
+// Inventory keeps devices across restarts in a bbolt database
+type Inventory struct {
+	db *bolt.DB
+}
+
+// OpenInventory opens or creates the database at path. Only one process
+// can have it open at a time.
+func OpenInventory(path string) (*Inventory, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s is in use by another mawingu-monitor; use its API instead", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(devicesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Inventory{db: db}, nil
+}
+
+// Close releases the database
+func (inv *Inventory) Close() error {
+	return inv.db.Close()
+}
+
+// Load returns every stored device, ordered by MAC
+func (inv *Inventory) Load() ([]Device, error) {
+	var devices []Device
+	err := inv.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(devicesBucket).ForEach(func(k, v []byte) error {
+			var s storedDevice
+			if err := json.Unmarshal(v, &s); err != nil {
+				return fmt.Errorf("device %s: %v", k, err)
+			}
+			devices = append(devices, s.device())
+			return nil
+		})
+	})
+	return devices, err
+}
+
+// Save writes devices in a single transaction
+func (inv *Inventory) Save(devices ...Device) error {
+	return inv.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(devicesBucket)
+		for _, d := range devices {
+			data, err := json.Marshal(store(d))
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(d.MAC), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Label changes a stored device without a monitor running
+func (inv *Inventory) Label(mac string, change DeviceLabel) (Device, error) {
+	var dev Device
+	err := inv.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(devicesBucket)
+		data := bucket.Get([]byte(mac))
+		if data == nil {
+			return errUnknownDevice
+		}
+		var s storedDevice
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		dev = s.device()
+		change.apply(&dev)
+		updated, err := json.Marshal(store(dev))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(mac), updated)
+	})
+	return dev, err
+}
+
+// store keeps the lasting fields of a device
+func store(d Device) storedDevice {
+	return storedDevice{MAC: d.MAC, IP: d.IP, IPs: d.IPs, IPHistory: d.IPHistory, Hostname: d.Hostname,
+		Vendor: d.Vendor, RandomMAC: d.RandomMAC, Label: d.Label, Trusted: d.Trusted, FirstSeen: d.FirstSeen, LastSeen: d.LastSeen}
+}
+
+// device restores a stored device, inactive until it is seen again
+func (s storedDevice) device() Device {
+	return Device{MAC: s.MAC, IP: s.IP, IPs: s.IPs, IPHistory: s.IPHistory, Hostname: s.Hostname,
+		Vendor: s.Vendor, RandomMAC: s.RandomMAC, Label: s.Label, Trusted: s.Trusted, FirstSeen: s.FirstSeen, LastSeen: s.LastSeen}
+}
+
+// openInventory loads the devices stored at path into the monitor, so
+// they are recognized rather than reported as new, and saves to it from
+// then on
+func (nm *NetworkMonitor) openInventory(path string) error {
+	inv, err := OpenInventory(path)
+	if err != nil {
+		return err
+	}
+	devices, err := inv.Load()
+	if err != nil {
+		inv.Close()
+		return err
+	}
+
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+	nm.inventory = inv
+	for _, d := range devices {
+		dev := d
+		// The vendor table may have been updated since the device was stored
+		if hw, err := net.ParseMAC(dev.MAC); err == nil {
+			if vendor := nm.vendors.lookup(hw); vendor != "" {
+				dev.Vendor = vendor
+			}
+		}
+		nm.devices[dev.MAC] = &dev
+	}
+	log.Printf("Loaded %d devices from %s", len(devices), path)
+	return nil
+}
+
+// fatalf saves and closes the inventory, if there is one, then exits
+// like log.Fatalf
+func (nm *NetworkMonitor) fatalf(format string, v ...any) {
+	if err := nm.closeInventory(); err != nil {
+		log.Printf("Failed to save inventory: %v", err)
+	}
+	log.Fatalf(format, v...)
+}
+
+// closeInventory saves every device and closes the inventory
+func (nm *NetworkMonitor) closeInventory() error {
+	if nm.inventory == nil {
+		return nil
+	}
+	err := nm.saveInventory()
+	if closeErr := nm.inventory.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// saveInventory writes every device to the inventory, if there is one
+func (nm *NetworkMonitor) saveInventory() error {
+	if nm.inventory == nil {
+		return nil
+	}
+	// Holding the lock through the write keeps a label change from being
+	// overwritten by an older copy
+	nm.mutex.RLock()
+	defer nm.mutex.RUnlock()
+	return nm.inventory.Save(nm.deviceList()...)
+}
+
+// persistDevices saves the inventory every inventorySaveInterval until the
+// monitor stops
+func (nm *NetworkMonitor) persistDevices() {
+	ticker := time.NewTicker(inventorySaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-nm.stopChan:
+			return
+		case <-ticker.C:
+			if err := nm.saveInventory(); err != nil {
+				log.Println("Failed to save the inventory:", err)
+			}
+		}
+	}
+}
+
+// LabelDevice names a device or marks it trusted, saving the change to
+// the inventory straight away
+func (nm *NetworkMonitor) LabelDevice(mac string, change DeviceLabel) (Device, error) {
+	nm.mutex.Lock()
+	defer nm.mutex.Unlock()
+
+	device, ok := nm.devices[mac]
+	if !ok {
+		return Device{}, errUnknownDevice
+	}
+	change.apply(device)
+	dev := device.copy()
+	if nm.inventory != nil {
+		if err := nm.inventory.Save(dev); err != nil {
+			return Device{}, err
+		}
+	}
+	return dev, nil
+}
+
+// printInventory lists devices, most recently seen first
+func printInventory(devices []Device) {
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].LastSeen.After(devices[j].LastSeen)
+	})
+	for _, d := range devices {
+		trust := "  "
+		if d.Trusted {
+			trust = "✅"
+		}
+		name := d.Label
+		if name == "" {
+			name = d.Hostname
+		}
+		fmt.Printf("%s %-17s  %-15s  %-24s  %s  last seen %s\n", trust, d.MAC, d.IP, name, d.Vendor,
+			d.LastSeen.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+// runDevices is the devices command. It lists the inventory, or shows one
+// device, changing it first when given -label or -trusted. The monitor holds the
+// database open while running, so use the API then instead.
+func runDevices(args []string) error {
+	fs := flag.NewFlagSet("devices", flag.ExitOnError)
+	path := fs.String("db", defaultInventory, "device inventory database")
+	label := fs.String("label", "", "name the device, e.g. \"Mum's phone\"")
+	trusted := fs.Bool("trusted", false, "mark the device trusted, or not with -trusted=false")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ./mawingu-monitor devices [-db mawingu.db] [-label name] [-trusted] [mac]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var change DeviceLabel
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "label":
+			change.Label = label
+		case "trusted":
+			change.Trusted = trusted
+		}
+	})
+	if fs.NArg() > 1 || (fs.NArg() == 0 && (change.Label != nil || change.Trusted != nil)) {
+		fs.Usage()
+		return errors.New("-label and -trusted need exactly one MAC address")
+	}
+
+	if _, err := os.Stat(*path); err != nil {
+		return err
+	}
+	inv, err := OpenInventory(*path)
+	if err != nil {
+		return err
+	}
+	defer inv.Close()
+
+	if fs.NArg() == 0 {
+		devices, err := inv.Load()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("📒 %d devices in %s\n", len(devices), *path)
+		printInventory(devices)
+		return nil
+	}
+
+	mac, err := net.ParseMAC(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if change.Label == nil && change.Trusted == nil {
+		devices, err := inv.Load()
+		if err != nil {
+			return err
+		}
+		for _, dev := range devices {
+			if dev.MAC == mac.String() {
+				printInventory([]Device{dev})
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: %v", mac, errUnknownDevice)
+	}
+	dev, err := inv.Label(mac.String(), change)
+	if err != nil {
+		return fmt.Errorf("%s: %v", mac, err)
+	}
+	fmt.Printf("✅ Updated %s\n", mac)
+	printInventory([]Device{dev})
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestInventory(t *testing.T) {
+	const laptop, router = "3c:22:fb:11:22:33", "00:1a:2b:3c:4d:5e"
+	path := filepath.Join(t.TempDir(), "mawingu.db")
+
+	nm := NewNetworkMonitor("")
+	if err := nm.openInventory(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := nm.ReadFile("testdata/basic.pcap", false); err != nil {
+		t.Fatal(err)
+	}
+	label, trusted := "  Mum's laptop ", true
+	if dev, err := nm.LabelDevice(laptop, DeviceLabel{Label: &label, Trusted: &trusted}); err != nil || dev.Label != "Mum's laptop" || !dev.Trusted {
+		t.Fatalf("LabelDevice=%+v err=%v want a trusted \"Mum's laptop\"", dev, err)
+	}
+	if _, err := nm.LabelDevice("02:00:00:00:00:01", DeviceLabel{Label: &label}); !errors.Is(err, errUnknownDevice) {
+		t.Fatalf("labelling an unseen device err=%v want %v", err, errUnknownDevice)
+	}
+	if err := nm.closeInventory(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart knows both devices, with what the user said about them
+	nm = NewNetworkMonitor("")
+	if err := nm.openInventory(path); err != nil {
+		t.Fatal(err)
+	}
+	dev, ok := nm.GetDevice(laptop)
+	if !ok || dev.Label != "Mum's laptop" || !dev.Trusted || dev.IP != "10.0.0.10" || dev.Vendor != "Apple, Inc." ||
+		!dev.FirstSeen.Equal(fixtureStart) || dev.IsActive || dev.PacketsSent != 0 {
+		t.Fatalf("restored laptop=%+v found=%v", dev, ok)
+	}
+	if _, ok := nm.GetDevice(router); !ok {
+		t.Fatal("router was not restored")
+	}
+	if err := nm.ReadFile("testdata/basic.pcap", false); err != nil {
+		t.Fatal(err)
+	}
+	if dev, _ := nm.GetDevice(laptop); !dev.IsActive || dev.Label != "Mum's laptop" || dev.PacketsSent != 5 {
+		t.Fatalf("laptop seen again=%+v want active, labelled and counting", dev)
+	}
+	if err := nm.closeInventory(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The devices command edits the inventory while no monitor has it open
+	cases := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"-db", path}, true},
+		{[]string{"-db", path, "-label", "Router", "-trusted", "00-1A-2B-3C-4D-5E"}, true},
+		{[]string{"-db", path, "-trusted=false", laptop}, true},
+		{[]string{"-db", path, laptop}, true},
+		{[]string{"-db", path, "02:00:00:00:00:01"}, false},
+		{[]string{"-db", path, "-label", "Router"}, false},
+		{[]string{"-db", path, "-label", "Nobody", "02:00:00:00:00:01"}, false},
+		{[]string{"-db", filepath.Join(t.TempDir(), "missing.db")}, false},
+	}
+	for _, c := range cases {
+		if err := runDevices(c.args); (err == nil) != c.ok {
+			t.Fatalf("devices %q err=%v want ok=%v", c.args, err, c.ok)
+		}
+	}
+
+	inv, err := OpenInventory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inv.Close()
+	devices, err := inv.Load()
+	if err != nil || len(devices) != 2 {
+		t.Fatalf("inventory has %d devices err=%v want 2", len(devices), err)
+	}
+	for _, d := range devices {
+		if (d.MAC == router && (d.Label != "Router" || !d.Trusted)) || (d.MAC == laptop && (d.Label != "Mum's laptop" || d.Trusted)) {
+			t.Fatalf("stored %s=%+v", d.MAC, d)
+		}
+	}
+}
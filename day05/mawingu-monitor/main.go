@@ -1,12 +1,15 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"sort"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -14,72 +17,113 @@ import (
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
+	"github.com/gorilla/websocket"
 )
 
 // Device represents a connected network device
 type Device struct {
-	MAC         string
-	IP          string
-	Hostname    string
-	FirstSeen   time.Time
-	LastSeen    time.Time
-	BytesSent   uint64
-	BytesRecv   uint64
-	PacketsSent uint64
-	PacketsRecv uint64
-	Connections int
-	IsActive    bool
+	MAC         string     `json:"mac"`
+	IP          string     `json:"ip"`         // primary address, IPv4 preferred
+	IPs         []string   `json:"ips"`        // every address seen, in order of discovery
+	IPHistory   []IPChange `json:"ip_history"` // when each address was first seen
+	Hostname    string     `json:"hostname"`
+	Vendor      string     `json:"vendor"`     // from the MAC's OUI, empty when unknown
+	RandomMAC   bool       `json:"random_mac"` // locally administered, e.g. a phone's randomized MAC
+	Label       string     `json:"label"`      // the user's name for it, e.g. "Mum's phone"
+	Trusted     bool       `json:"trusted"`
+	FirstSeen   time.Time  `json:"first_seen"`
+	LastSeen    time.Time  `json:"last_seen"`
+	BytesSent   uint64     `json:"bytes_sent"`
+	BytesRecv   uint64     `json:"bytes_recv"`
+	PacketsSent uint64     `json:"packets_sent"`
+	PacketsRecv uint64     `json:"packets_recv"`
+	Connections int        `json:"connections"` // active flows the device is part of
+	IsActive    bool       `json:"is_active"`
 }
 
 // TrafficStats holds network statistics
 type TrafficStats struct {
-	TotalBytes    uint64
-	TotalPackets  uint64
-	HTTPRequests  uint64
-	HTTPSRequests uint64
-	DNSQueries    uint64
-	TCPConns      uint64
-	UDPConns      uint64
+	TotalBytes    uint64 `json:"total_bytes"`
+	TotalPackets  uint64 `json:"total_packets"`
+	HTTPRequests  uint64 `json:"http_requests"`  // flows opening with a plaintext HTTP request
+	HTTPSRequests uint64 `json:"https_requests"` // TLS handshakes, whatever protocol they carry
+	HTTPSFlows    uint64 `json:"https_flows"`    // TLS handshakes offering HTTP over ALPN
+	DNSQueries    uint64 `json:"dns_queries"`    // questions asked, not packets
+	TCPConns      uint64 `json:"tcp_conns"`      // TCP connections seen
+	UDPConns      uint64 `json:"udp_conns"`      // UDP conversations seen
 }
 
 // NetworkMonitor manages network monitoring
 type NetworkMonitor struct {
 	devices       map[string]*Device
+	flows         map[FlowKey]*Flow
+	finishedFlows []*Flow
+	lastFlowSweep time.Time
+	dnsLog        []*DNSRecord
+	dnsPending    map[dnsKey]*dnsPending
+	dnsStats      map[string]*deviceDNS
 	stats         *TrafficStats
 	mutex         sync.RWMutex
 	interfaceName string
+	options       CaptureOptions
+	vendors       ouiTable
 	handle        *pcap.Handle
+	inventory     *Inventory // nil when devices are not kept across runs
+	hub           *Hub
+	upgrader      websocket.Upgrader // the zero value only accepts same-origin pages
 	localMAC      string
+	localNets     []*net.IPNet // the capture interface's subnets; none when reading a file
 	stopChan      chan struct{}
+	stopOnce      sync.Once
+	// lastPacket is the capture time of the latest packet, which is the
+	// monitor's clock when reading a file
+	lastPacket time.Time
+	offline    bool
 }
 
 // NewNetworkMonitor creates a new network monitor
 func NewNetworkMonitor(iface string) *NetworkMonitor {
 	return &NetworkMonitor{
 		devices:       make(map[string]*Device),
+		flows:         make(map[FlowKey]*Flow),
+		dnsPending:    make(map[dnsKey]*dnsPending),
+		dnsStats:      make(map[string]*deviceDNS),
 		stats:         &TrafficStats{},
 		interfaceName: iface,
+		options:       defaultCaptureOptions(),
+		vendors:       embeddedOUI,
+		hub:           NewHub(),
 		stopChan:      make(chan struct{}),
 	}
 }
 
 // Start begins monitoring network traffic
 func (nm *NetworkMonitor) Start() error {
+	if err := nm.options.validate(); err != nil {
+		return err
+	}
+
 	// Open device for packet capture
-	handle, err := pcap.OpenLive(nm.interfaceName, 65536, true, pcap.BlockForever)
+	handle, err := openLive(nm.interfaceName, nm.options)
 	if err != nil {
 		return fmt.Errorf("failed to open device: %v", err)
 	}
 	nm.handle = handle
 
-	// Get local MAC address
+	// Get local MAC address and the subnets that are on-link
 	iface, err := net.InterfaceByName(nm.interfaceName)
 	if err == nil {
 		nm.localMAC = iface.HardwareAddr.String()
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			if subnet, ok := addr.(*net.IPNet); ok {
+				nm.localNets = append(nm.localNets, subnet)
+			}
+		}
 	}
 
 	// Start packet processing
-	go nm.processPackets()
+	go nm.processPackets(gopacket.NewPacketSource(handle, handle.LinkType()))
 
 	// Start statistics reporter
 	go nm.reportStats()
@@ -87,37 +131,67 @@ func (nm *NetworkMonitor) Start() error {
 	// Start device cleanup (mark inactive devices)
 	go nm.cleanupDevices()
 
+	if nm.inventory != nil {
+		go nm.persistDevices()
+	}
+
 	log.Printf("Started monitoring on interface: %s", nm.interfaceName)
+	if nm.options.Filter != "" {
+		log.Printf("Capture filter: %s", nm.options.Filter)
+	}
 	return nil
 }
 
 // Stop stops the network monitor
 func (nm *NetworkMonitor) Stop() {
-	close(nm.stopChan)
-	if nm.handle != nil {
-		nm.handle.Close()
-	}
+	nm.stopOnce.Do(func() {
+		close(nm.stopChan)
+		if nm.handle != nil {
+			nm.handle.Close()
+		}
+	})
 }
 
-// processPackets processes captured packets
-func (nm *NetworkMonitor) processPackets() {
-	packetSource := gopacket.NewPacketSource(nm.handle, nm.handle.LinkType())
-
+// processPackets processes captured packets until the source runs dry
+// or the monitor is stopped
+func (nm *NetworkMonitor) processPackets(packetSource *gopacket.PacketSource) {
+	packets := packetSource.Packets()
 	for {
 		select {
 		case <-nm.stopChan:
 			return
-		case packet := <-packetSource.Packets():
+		case packet, ok := <-packets:
+			if !ok {
+				return
+			}
 			nm.analyzePacket(packet)
 		}
 	}
 }
 
+// now is the monitor's clock: the wall clock when capturing live, and
+// the time of the latest packet when reading a file. The caller must
+// hold the mutex.
+func (nm *NetworkMonitor) now() time.Time {
+	if nm.offline {
+		return nm.lastPacket
+	}
+	return time.Now()
+}
+
 // analyzePacket analyzes a single packet
 func (nm *NetworkMonitor) analyzePacket(packet gopacket.Packet) {
 	nm.mutex.Lock()
 	defer nm.mutex.Unlock()
 
+	seen := packet.Metadata().Timestamp
+	if seen.IsZero() {
+		seen = time.Now()
+	}
+	if seen.After(nm.lastPacket) {
+		nm.lastPacket = seen
+	}
+
 	// Update total stats
 	nm.stats.TotalPackets++
 	nm.stats.TotalBytes += uint64(len(packet.Data()))
@@ -129,73 +203,41 @@ func (nm *NetworkMonitor) analyzePacket(packet gopacket.Packet) {
 	}
 	eth := ethLayer.(*layers.Ethernet)
 
-	// Extract IP layer
-	var srcIP, dstIP string
-	ipLayer := packet.Layer(layers.LayerTypeIPv4)
-	if ipLayer != nil {
-		ip := ipLayer.(*layers.IPv4)
-		srcIP = ip.SrcIP.String()
-		dstIP = ip.DstIP.String()
-	}
+	// Learn addresses and hostnames
+	nm.discover(packet, eth, seen)
 
 	// Track source device
 	srcMAC := eth.SrcMAC.String()
 	if srcMAC != nm.localMAC {
-		nm.updateDevice(srcMAC, srcIP, uint64(len(packet.Data())), 1, true)
+		nm.updateDevice(srcMAC, uint64(len(packet.Data())), 1, true, seen)
 	}
 
 	// Track destination device
 	dstMAC := eth.DstMAC.String()
 	if dstMAC != nm.localMAC && (eth.DstMAC[0]&0x01) == 0 { // Not multicast
-		nm.updateDevice(dstMAC, dstIP, uint64(len(packet.Data())), 1, false)
+		nm.updateDevice(dstMAC, uint64(len(packet.Data())), 1, false, seen)
 	}
 
-	// Analyze transport layer
-	if tcpLayer := packet.Layer(layers.LayerTypeTCP); tcpLayer != nil {
-		tcp := tcpLayer.(*layers.TCP)
-		nm.stats.TCPConns++
-
-		// Detect HTTP/HTTPS
-		if tcp.DstPort == 80 || tcp.SrcPort == 80 {
-			nm.stats.HTTPRequests++
-		}
-		if tcp.DstPort == 443 || tcp.SrcPort == 443 {
-			nm.stats.HTTPSRequests++
-		}
+	// Track the connection and retire idle ones
+	flow := nm.trackFlow(packet, eth, seen)
+	if seen.Sub(nm.lastFlowSweep) >= flowSweepInterval {
+		nm.expireFlows()
+		nm.expireDNS()
 	}
 
-	if udpLayer := packet.Layer(layers.LayerTypeUDP); udpLayer != nil {
-		udp := udpLayer.(*layers.UDP)
-		nm.stats.UDPConns++
-
-		// Detect DNS
-		if udp.DstPort == 53 || udp.SrcPort == 53 {
-			nm.stats.DNSQueries++
-		}
+	// Log DNS lookups
+	if dnsLayer := packet.Layer(layers.LayerTypeDNS); dnsLayer != nil && flow != nil && flow.Protocol == "udp" {
+		nm.trackDNS(dnsLayer.(*layers.DNS), flow, seen)
 	}
-}
 
-// updateDevice updates device information
-func (nm *NetworkMonitor) updateDevice(mac, ip string, bytes, packets uint64, isSending bool) {
-	device, exists := nm.devices[mac]
-	if !exists {
-		device = &Device{
-			MAC:       mac,
-			IP:        ip,
-			FirstSeen: time.Now(),
-			IsActive:  true,
-		}
-		nm.devices[mac] = device
-		log.Printf("New device detected: MAC=%s IP=%s", mac, ip)
-	}
+}
 
-	device.LastSeen = time.Now()
+// updateDevice updates device information for a packet captured at seen
+func (nm *NetworkMonitor) updateDevice(mac string, bytes, packets uint64, isSending bool, seen time.Time) {
+	device := nm.device(mac, seen)
+	device.LastSeen = seen
 	device.IsActive = true
 
-	if ip != "" && device.IP == "" {
-		device.IP = ip
-	}
-
 	if isSending {
 		device.BytesSent += bytes
 		device.PacketsSent += packets
@@ -231,8 +273,10 @@ func (nm *NetworkMonitor) cleanupDevices() {
 			return
 		case <-ticker.C:
 			nm.mutex.Lock()
+			nm.expireFlows()
+			nm.expireDNS()
 			for _, device := range nm.devices {
-				if time.Since(device.LastSeen) > 10*time.Minute {
+				if nm.now().Sub(device.LastSeen) > 10*time.Minute {
 					device.IsActive = false
 				}
 			}
@@ -252,9 +296,9 @@ func (nm *NetworkMonitor) printStats() {
 	fmt.Println("═══════════════════════════════════════════════════════════════")
 	fmt.Printf("Total Traffic: %.2f MB | Packets: %d\n",
 		float64(nm.stats.TotalBytes)/(1024*1024), nm.stats.TotalPackets)
-	fmt.Printf("HTTP: %d | HTTPS: %d | DNS: %d\n",
-		nm.stats.HTTPRequests, nm.stats.HTTPSRequests, nm.stats.DNSQueries)
-	fmt.Printf("TCP Connections: %d | UDP: %d\n", nm.stats.TCPConns, nm.stats.UDPConns)
+	fmt.Printf("HTTP: %d | HTTPS: %d (%d HTTP over TLS) | DNS: %d\n",
+		nm.stats.HTTPRequests, nm.stats.HTTPSRequests, nm.stats.HTTPSFlows, nm.stats.DNSQueries)
+	fmt.Printf("TCP Connections: %d | UDP: %d | Active Flows: %d\n", nm.stats.TCPConns, nm.stats.UDPConns, len(nm.flows))
 
 	fmt.Println("\n─────────────────────────────────────────────────────────────")
 	fmt.Println("                     CONNECTED DEVICES")
@@ -286,13 +330,54 @@ func (nm *NetworkMonitor) printStats() {
 		}
 
 		totalMB := float64(dev.BytesSent+dev.BytesRecv) / (1024 * 1024)
-		fmt.Printf("%s MAC: %s\n", status, dev.MAC)
+		fmt.Printf("%s MAC: %s", status, dev.MAC)
+		if dev.Trusted {
+			fmt.Print(" ✅")
+		}
+		switch {
+		case dev.RandomMAC:
+			fmt.Print(" (randomized)")
+		case dev.Vendor != "":
+			fmt.Printf(" (%s)", dev.Vendor)
+		}
+		fmt.Println()
+		if dev.Label != "" {
+			fmt.Printf("   Label: %s\n", dev.Label)
+		}
+		if dev.Hostname != "" {
+			fmt.Printf("   Hostname: %s\n", dev.Hostname)
+		}
 		fmt.Printf("   IP: %-15s | Active: %v\n", dev.IP, dev.IsActive)
+		if len(dev.IPs) > 1 {
+			fmt.Printf("   All IPs: %s\n", strings.Join(dev.IPs, ", "))
+		}
 		fmt.Printf("   Sent: %.2f MB (%d packets) | Recv: %.2f MB (%d packets)\n",
 			float64(dev.BytesSent)/(1024*1024), dev.PacketsSent,
 			float64(dev.BytesRecv)/(1024*1024), dev.PacketsRecv)
-		fmt.Printf("   Total: %.2f MB | Last Seen: %s ago\n",
-			totalMB, time.Since(dev.LastSeen).Round(time.Second))
+		fmt.Printf("   Total: %.2f MB | Connections: %d | Last Seen: %s ago\n",
+			totalMB, dev.Connections, nm.now().Sub(dev.LastSeen).Round(time.Second))
+		if dns := nm.dnsSummary(dev.MAC, 3); dns.Queries > 0 {
+			var top []string
+			for _, d := range dns.TopDomains {
+				top = append(top, fmt.Sprintf("%s (%d)", d.Name, d.Queries))
+			}
+			fmt.Printf("   DNS: %d queries | NXDOMAIN: %.0f%% | Top: %s\n",
+				dns.Queries, dns.NXDomainRate, strings.Join(top, ", "))
+		}
+		if apps := nm.deviceApps(dev.MAC); len(apps) > 0 {
+			var top []string
+			for i, app := range apps {
+				if i == 3 {
+					break
+				}
+				name := app.Service
+				if app.Hostname != "" {
+					name = fmt.Sprintf("%s (%s)", app.Hostname, app.Service)
+				}
+				top = append(top, fmt.Sprintf("%s %.2f MB", name, float64(app.Bytes)/(1024*1024)))
+			}
+			fmt.Printf("   Apps: %s\n", strings.Join(top, ", "))
+		}
 		fmt.Println()
 	}
 
@@ -300,18 +385,49 @@ func (nm *NetworkMonitor) printStats() {
 	fmt.Println("═══════════════════════════════════════════════════════════════")
 }
 
-// GetDevices returns all tracked devices
-func (nm *NetworkMonitor) GetDevices() []*Device {
+// GetDevices returns copies of all tracked devices, most recently seen
+// first
+func (nm *NetworkMonitor) GetDevices() []Device {
 	nm.mutex.RLock()
 	defer nm.mutex.RUnlock()
+	return nm.deviceList()
+}
 
-	devices := make([]*Device, 0, len(nm.devices))
+// deviceList is GetDevices for callers holding the mutex
+func (nm *NetworkMonitor) deviceList() []Device {
+	devices := make([]Device, 0, len(nm.devices))
 	for _, dev := range nm.devices {
-		devices = append(devices, dev)
+		devices = append(devices, dev.copy())
 	}
+	sort.Slice(devices, func(i, j int) bool {
+		if !devices[i].LastSeen.Equal(devices[j].LastSeen) {
+			return devices[i].LastSeen.After(devices[j].LastSeen)
+		}
+		return devices[i].MAC < devices[j].MAC
+	})
 	return devices
 }
 
+// GetDevice returns a copy of one device
+func (nm *NetworkMonitor) GetDevice(mac string) (Device, bool) {
+	nm.mutex.RLock()
+	defer nm.mutex.RUnlock()
+
+	dev, ok := nm.devices[mac]
+	if !ok {
+		return Device{}, false
+	}
+	return dev.copy(), true
+}
+
+// copy returns a device that shares no memory with d
+func (d *Device) copy() Device {
+	dev := *d
+	dev.IPs = append([]string(nil), d.IPs...)
+	dev.IPHistory = append([]IPChange(nil), d.IPHistory...)
+	return dev
+}
+
 // GetStats returns current statistics
 func (nm *NetworkMonitor) GetStats() *TrafficStats {
 	nm.mutex.RLock()
@@ -322,8 +438,109 @@ func (nm *NetworkMonitor) GetStats() *TrafficStats {
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: sudo ./mawingu-monitor <interface>")
+	if len(os.Args) > 1 && os.Args[1] == "update-oui" {
+		if err := runUpdateOUI(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "devices" {
+		if err := runDevices(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	readFile := flag.String("read", "", "analyze a pcap or pcapng capture file instead of a live interface")
+	realtime := flag.Bool("realtime", false, "with -read, replay packets at the pace they were captured")
+	options := defaultCaptureOptions()
+	flag.StringVar(&options.Filter, "filter", "", "BPF filter expression, e.g. \"tcp port 443 or udp port 53\"")
+	flag.IntVar(&options.SnapLen, "snaplen", options.SnapLen, "bytes to capture from each packet")
+	flag.BoolVar(&options.Promisc, "promisc", options.Promisc, "capture in promiscuous mode")
+	flag.DurationVar(&options.Timeout, "timeout", 0, "read timeout for live captures, 0 blocks until packets arrive")
+	flag.IntVar(&options.BufferSize, "buffer-size", 0, "kernel capture buffer in bytes, 0 keeps the OS default")
+	flowsFile := flag.String("flows", "", "export flows to this file on exit, as JSON if it ends in .json and CSV otherwise")
+	dnsSearch := flag.String("dns-search", "", "on exit, list the DNS lookups whose name contains this (\".\" for all)")
+	ouiFile := flag.String("oui", "", "vendor table written by update-oui, instead of the built-in one")
+	listen := flag.String("listen", "", "serve the API and dashboard on this address; :8080 is loopback only, 0.0.0.0:8080 the whole network")
+	dbFile := flag.String("db", defaultInventory, "device inventory kept across runs, \"\" to disable; used with -read only when given")
+	flag.Parse()
+
+	vendors := embeddedOUI
+	if *ouiFile != "" {
+		var err error
+		if vendors, err = loadOUI(*ouiFile); err != nil {
+			log.Fatalf("Failed to load %s: %v", *ouiFile, err)
+		}
+	}
+
+	if err := options.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	// The inventory describes the network being watched, so a capture file
+	// only adds to one when -db is given
+	dbGiven := false
+	flag.Visit(func(f *flag.Flag) {
+		dbGiven = dbGiven || f.Name == "db"
+	})
+
+	// Handle graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	if *readFile != "" {
+		monitor := NewNetworkMonitor("")
+		monitor.options = options
+		monitor.vendors = vendors
+		if dbGiven && *dbFile != "" {
+			if err := monitor.openInventory(*dbFile); err != nil {
+				log.Fatalf("Failed to open inventory: %v", err)
+			}
+		}
+		go func() {
+			<-sigChan
+			monitor.Stop()
+		}()
+		var server *http.Server
+		if *listen != "" {
+			var err error
+			if server, err = monitor.serve(*listen); err != nil {
+				monitor.fatalf("Failed to start API: %v", err)
+			}
+		}
+		if err := monitor.ReadFile(*readFile, *realtime); err != nil {
+			monitor.fatalf("Failed to read %s: %v", *readFile, err)
+		}
+		if err := monitor.saveInventory(); err != nil {
+			log.Printf("Failed to save inventory: %v", err)
+		}
+		monitor.printStats()
+		if *dnsSearch != "" {
+			monitor.printDNS(DNSFilter{Domain: *dnsSearch})
+		}
+		if *flowsFile != "" {
+			if err := monitor.exportFlows(*flowsFile); err != nil {
+				monitor.fatalf("Failed to export flows: %v", err)
+			}
+		}
+		if server != nil {
+			// Keep the dashboard up to browse the capture
+			fmt.Println("\nPress Ctrl+C to stop serving...")
+			<-monitor.stopChan
+			shutdown(server)
+		}
+		if err := monitor.closeInventory(); err != nil {
+			log.Printf("Failed to save inventory: %v", err)
+		}
+		return
+	}
+
+	if flag.NArg() < 1 {
+		fmt.Println("Usage: sudo ./mawingu-monitor [-filter expr] [-snaplen n] [-promisc=false] [-listen :8080] [-db file] <interface>")
+		fmt.Println("       ./mawingu-monitor -read capture.pcap [-realtime] [-filter expr] [-listen :8080] [-db file]")
+		fmt.Println("       ./mawingu-monitor update-oui [-o oui.txt] oui.csv")
+		fmt.Println("       ./mawingu-monitor devices [-db mawingu.db] [-label name] [-trusted] [mac]")
 		fmt.Println("\nAvailable interfaces:")
 		interfaces, err := pcap.FindAllDevs()
 		if err != nil {
@@ -339,15 +556,26 @@ func main() {
 		os.Exit(1)
 	}
 
-	iface := os.Args[1]
+	iface := flag.Arg(0)
 	monitor := NewNetworkMonitor(iface)
-
-	// Handle graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	monitor.options = options
+	monitor.vendors = vendors
+	if *dbFile != "" {
+		if err := monitor.openInventory(*dbFile); err != nil {
+			log.Fatalf("Failed to open inventory: %v", err)
+		}
+	}
 
 	if err := monitor.Start(); err != nil {
-		log.Fatalf("Failed to start monitor: %v", err)
+		monitor.fatalf("Failed to start monitor: %v", err)
+	}
+	var server *http.Server
+	if *listen != "" {
+		var err error
+		if server, err = monitor.serve(*listen); err != nil {
+			monitor.Stop()
+			monitor.fatalf("Failed to start API: %v", err)
+		}
 	}
 
 	fmt.Println("\nPress Ctrl+C to stop monitoring...")
@@ -355,7 +583,21 @@ func main() {
 	<-sigChan
 	fmt.Println("\n\nStopping monitor...")
 	monitor.Stop()
+	if server != nil {
+		shutdown(server)
+	}
+	if err := monitor.closeInventory(); err != nil {
+		log.Printf("Failed to save inventory: %v", err)
+	}
 
 	// Print final stats
 	monitor.printStats()
+	if *dnsSearch != "" {
+		monitor.printDNS(DNSFilter{Domain: *dnsSearch})
+	}
+	if *flowsFile != "" {
+		if err := monitor.exportFlows(*flowsFile); err != nil {
+			log.Fatalf("Failed to export flows: %v", err)
+		}
+	}
 }
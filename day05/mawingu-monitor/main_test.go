@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fixtureStart is when the generated fixtures begin, 100ms per packet
+var fixtureStart = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func TestReadFile(t *testing.T) {
+	wantStats := TrafficStats{TotalPackets: 7, HTTPRequests: 1, DNSQueries: 1, TCPConns: 2, UDPConns: 1}
+	wantDevices := []struct {
+		mac                 string
+		sent, recv          uint64
+		firstSeen, lastSeen time.Duration
+	}{
+		{"3c:22:fb:11:22:33", 5, 2, 0, 600 * time.Millisecond},
+		{"00:1a:2b:3c:4d:5e", 2, 4, 0, 500 * time.Millisecond},
+	}
+
+	for _, file := range []string{"testdata/basic.pcap", "testdata/basic.pcapng"} {
+		nm := NewNetworkMonitor("")
+		if err := nm.ReadFile(file, false); err != nil {
+			t.Fatalf("ReadFile(%s): %v", file, err)
+		}
+
+		stats := *nm.GetStats()
+		stats.TotalBytes = 0
+		if stats != wantStats {
+			t.Fatalf("ReadFile(%s) stats=%+v want %+v", file, stats, wantStats)
+		}
+
+		devices := nm.GetDevices()
+		if len(devices) != len(wantDevices) {
+			t.Fatalf("ReadFile(%s) found %d devices want %d", file, len(devices), len(wantDevices))
+		}
+		for _, want := range wantDevices {
+			var dev *Device
+			for i := range devices {
+				if devices[i].MAC == want.mac {
+					dev = &devices[i]
+				}
+			}
+			if dev == nil {
+				t.Fatalf("ReadFile(%s) missed device %s", file, want.mac)
+			}
+			if dev.PacketsSent != want.sent || dev.PacketsRecv != want.recv ||
+				!dev.FirstSeen.Equal(fixtureStart.Add(want.firstSeen)) || !dev.LastSeen.Equal(fixtureStart.Add(want.lastSeen)) {
+				t.Fatalf("ReadFile(%s) %s=%+v want sent=%d recv=%d seen %v-%v", file, want.mac, dev, want.sent, want.recv, want.firstSeen, want.lastSeen)
+			}
+		}
+	}
+}
+
+func TestReadFileRealtime(t *testing.T) {
+	nm := NewNetworkMonitor("")
+	started := time.Now()
+	if err := nm.ReadFile("testdata/basic.pcap", true); err != nil {
+		t.Fatal(err)
+	}
+	// The fixture spans 600ms of capture time
+	if elapsed := time.Since(started); elapsed < 600*time.Millisecond {
+		t.Fatalf("realtime replay took %v want at least 600ms", elapsed)
+	}
+
+	// Stopping ends a replay early
+	nm = NewNetworkMonitor("")
+	nm.Stop()
+	if err := nm.ReadFile("testdata/basic.pcap", true); err != nil || nm.GetStats().TotalPackets > 1 {
+		t.Fatalf("stopped replay read %d packets, err=%v", nm.GetStats().TotalPackets, err)
+	}
+}
+
+func TestReadFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pcap")
+	os.WriteFile(garbage, []byte("this is not a capture file"), 0o644)
+
+	for _, file := range []string{"testdata/missing.pcap", garbage} {
+		if err := NewNetworkMonitor("").ReadFile(file, false); err == nil {
+			t.Fatalf("ReadFile(%s) succeeded", file)
+		}
+	}
+
+	// A capture cut off partway through its last packet is reported, but
+	// the packets before it still count
+	for _, name := range []string{"basic.pcap", "basic.pcapng"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		truncated := filepath.Join(dir, name)
+		os.WriteFile(truncated, data[:len(data)-10], 0o644)
+
+		nm := NewNetworkMonitor("")
+		if err := nm.ReadFile(truncated, false); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("ReadFile(truncated %s) err=%v want unexpected EOF", name, err)
+		}
+		if got := nm.GetStats().TotalPackets; got != 6 {
+			t.Fatalf("truncated %s: %d packets analyzed want 6", name, got)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// maxSnapLen is the largest snapshot length libpcap accepts
+const maxSnapLen = 262144
+
+// CaptureOptions configure how packets are captured
+type CaptureOptions struct {
+	Filter     string        // BPF expression, empty captures everything
+	SnapLen    int           // bytes kept from each packet
+	Promisc    bool          // capture frames addressed to other hosts too
+	Timeout    time.Duration // read timeout, 0 blocks until packets arrive
+	BufferSize int           // kernel buffer in bytes, 0 keeps the OS default
+}
+
+// defaultCaptureOptions captures whole frames in promiscuous mode
+func defaultCaptureOptions() CaptureOptions {
+	return CaptureOptions{SnapLen: 65536, Promisc: true}
+}
+
+// validate checks the options, compiling the filter so a typo is reported
+// before the interface is opened
+func (o CaptureOptions) validate() error {
+	if o.SnapLen <= 0 || o.SnapLen > maxSnapLen {
+		return fmt.Errorf("snaplen must be between 1 and %d, got %d", maxSnapLen, o.SnapLen)
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative, got %s", o.Timeout)
+	}
+	if o.BufferSize < 0 {
+		return fmt.Errorf("buffer size must not be negative, got %d", o.BufferSize)
+	}
+	if o.Filter != "" {
+		if _, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, o.SnapLen, o.Filter); err != nil {
+			return fmt.Errorf("invalid filter %q: %v", o.Filter, err)
+		}
+	}
+	return nil
+}
+
+// readTimeout maps a zero timeout to pcap's blocking read
+func (o CaptureOptions) readTimeout() time.Duration {
+	if o.Timeout == 0 {
+		return pcap.BlockForever
+	}
+	return o.Timeout
+}
+
+// openLive opens an interface with the options applied
+func openLive(iface string, o CaptureOptions) (*pcap.Handle, error) {
+	inactive, err := pcap.NewInactiveHandle(iface)
+	if err != nil {
+		return nil, err
+	}
+	defer inactive.CleanUp()
+
+	if err := inactive.SetSnapLen(o.SnapLen); err != nil {
+		return nil, fmt.Errorf("setting snaplen: %v", err)
+	}
+	if err := inactive.SetPromisc(o.Promisc); err != nil {
+		return nil, fmt.Errorf("setting promiscuous mode: %v", err)
+	}
+	if err := inactive.SetTimeout(o.readTimeout()); err != nil {
+		return nil, fmt.Errorf("setting timeout: %v", err)
+	}
+	if o.BufferSize > 0 {
+		if err := inactive.SetBufferSize(o.BufferSize); err != nil {
+			return nil, fmt.Errorf("setting buffer size: %v", err)
+		}
+	}
+
+	handle, err := inactive.Activate()
+	if err != nil {
+		return nil, err
+	}
+	if o.Filter != "" {
+		if err := handle.SetBPFFilter(o.Filter); err != nil {
+			handle.Close()
+			return nil, fmt.Errorf("invalid filter %q: %v", o.Filter, err)
+		}
+	}
+	return handle, nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureOptionsValidate(t *testing.T) {
+	cases := []struct {
+		change  func(*CaptureOptions)
+		wantErr string // "" when the options are valid
+	}{
+		{func(o *CaptureOptions) {}, ""},
+		{func(o *CaptureOptions) { o.Promisc = false; o.Timeout = time.Second; o.BufferSize = 8 << 20 }, ""},
+		{func(o *CaptureOptions) { o.SnapLen = 0 }, "snaplen"},
+		{func(o *CaptureOptions) { o.SnapLen = maxSnapLen + 1 }, "snaplen"},
+		{func(o *CaptureOptions) { o.Timeout = -time.Second }, "timeout"},
+		{func(o *CaptureOptions) { o.BufferSize = -1 }, "buffer size"},
+		{func(o *CaptureOptions) { o.Filter = "tcp port" }, `invalid filter "tcp port"`},
+	}
+	for i, c := range cases {
+		o := defaultCaptureOptions()
+		c.change(&o)
+		err := o.validate()
+		if c.wantErr == "" && err != nil {
+			t.Fatalf("case %d: validate(%+v)=%v want nil", i, o, err)
+		}
+		if c.wantErr != "" && (err == nil || !strings.Contains(err.Error(), c.wantErr)) {
+			t.Fatalf("case %d: validate(%+v)=%v want %q", i, o, err, c.wantErr)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ouiData maps MAC prefixes to vendors, one "PREFIX<TAB>Vendor" per line.
+// Regenerate it from the IEEE registry with update-oui.
+//
+//go:embed oui.txt
+var ouiData string
+
+// embeddedOUI is the vendor table built into the binary
+var embeddedOUI = mustParseOUI(ouiData)
+
+// ouiTable maps upper-case hex MAC prefixes to vendor names. IEEE hands
+// out 24-bit (MA-L), 28-bit (MA-M) and 36-bit (MA-S) blocks, so prefixes
+// are 6, 7 or 9 hex digits long.
+type ouiTable map[string]string
+
+// parseOUI reads a table in the oui.txt format, skipping blank lines and
+// # comments
+func parseOUI(r io.Reader) (ouiTable, error) {
+	table := ouiTable{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		prefix, vendor, ok := strings.Cut(text, "\t")
+		if !ok || !validPrefix(prefix) {
+			return nil, fmt.Errorf("line %d: expected PREFIX<TAB>Vendor, got %q", line, text)
+		}
+		table[strings.ToUpper(prefix)] = strings.TrimSpace(vendor)
+	}
+	return table, scanner.Err()
+}
+
+func mustParseOUI(data string) ouiTable {
+	table, err := parseOUI(strings.NewReader(data))
+	if err != nil {
+		panic("embedded oui.txt: " + err.Error())
+	}
+	return table
+}
+
+// loadOUI reads a table from a file written by update-oui
+func loadOUI(path string) (ouiTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseOUI(f)
+}
+
+// validPrefix reports whether s is a 6, 7 or 9 digit hex prefix
+func validPrefix(s string) bool {
+	if len(s) != 6 && len(s) != 7 && len(s) != 9 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the vendor of a MAC address, preferring the longest
+// matching prefix. Locally administered addresses have no vendor.
+func (t ouiTable) lookup(mac net.HardwareAddr) string {
+	if len(mac) < 6 || isLocallyAdministered(mac) {
+		return ""
+	}
+	digits := strings.ToUpper(fmt.Sprintf("%x", []byte(mac[:6])))
+	for _, n := range []int{9, 7, 6} {
+		if vendor, ok := t[digits[:n]]; ok {
+			return vendor
+		}
+	}
+	return ""
+}
+
+// isLocallyAdministered reports whether a MAC was assigned by software
+// rather than burned in by a vendor, as with phones randomizing their
+// address per network
+func isLocallyAdministered(mac net.HardwareAddr) bool {
+	return len(mac) > 0 && mac[0]&0x02 != 0
+}
+
+// readIEEE adds the assignments in an IEEE registry CSV (oui.csv,
+// mam.csv or oui36.csv) to table
+func readIEEE(r io.Reader, table ouiTable) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("reading header: %v", err)
+	}
+	assignment, organization := -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")) {
+		case "Assignment":
+			assignment = i
+		case "Organization Name":
+			organization = i
+		}
+	}
+	if assignment < 0 || organization < 0 {
+		return errors.New("missing Assignment or Organization Name column")
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) <= assignment || len(record) <= organization {
+			continue
+		}
+		prefix := strings.ToUpper(strings.TrimSpace(record[assignment]))
+		vendor := strings.Join(strings.Fields(record[organization]), " ")
+		if !validPrefix(prefix) || vendor == "" {
+			line, _ := reader.FieldPos(assignment)
+			return fmt.Errorf("line %d: bad assignment %q", line, record[assignment])
+		}
+		table[prefix] = vendor
+	}
+}
+
+// writeOUI saves table in the oui.txt format, sorted by prefix
+func writeOUI(w io.Writer, table ouiTable) error {
+	prefixes := make([]string, 0, len(table))
+	for prefix := range table {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "# MAC vendor prefixes from the IEEE registry, generated by update-oui")
+	for _, prefix := range prefixes {
+		fmt.Fprintf(out, "%s\t%s\n", prefix, table[prefix])
+	}
+	return out.Flush()
+}
+
+// runUpdateOUI is the update-oui command. It converts IEEE registry CSVs
+// downloaded from https://standards-oui.ieee.org into a vendor table that
+// can be loaded with -oui or copied over oui.txt before building.
+func runUpdateOUI(args []string) error {
+	fs := flag.NewFlagSet("update-oui", flag.ExitOnError)
+	out := fs.String("o", "oui.txt", "where to write the vendor table")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: ./mawingu-monitor update-oui [-o oui.txt] oui.csv [mam.csv oui36.csv]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no CSV files given")
+	}
+
+	table := ouiTable{}
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = readIEEE(f, table)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	tmp := *out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = writeOUI(f, table)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, *out); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Wrote %d vendor prefixes to %s\n", len(table), *out)
+	return nil
+}
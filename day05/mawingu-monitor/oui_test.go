@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOUILookup(t *testing.T) {
+	registry := ouiTable{"70B3D5": "IEEE Registration Authority", "70B3D5F2A": "Acme Sensors", "8C1F647": "Widget Co"}
+	cases := []struct {
+		table  ouiTable
+		mac    string
+		vendor string
+		random bool
+	}{
+		{embeddedOUI, "3c:22:fb:11:22:33", "Apple, Inc.", false},
+		{embeddedOUI, "B8:27:EB:00:00:01", "Raspberry Pi Foundation", false},
+		{embeddedOUI, "00:1a:2b:3c:4d:5e", "Ayecom Technology Co., Ltd.", false},
+		{embeddedOUI, "0c:00:00:12:34:56", "", false}, // unassigned
+		{embeddedOUI, "3e:22:fb:11:22:33", "", true},
+		{embeddedOUI, "da:a1:19:00:00:01", "", true},
+		{registry, "70:b3:d5:f2:a0:01", "Acme Sensors", false},
+		{registry, "70:b3:d5:00:00:01", "IEEE Registration Authority", false},
+		{registry, "8c:1f:64:70:00:01", "Widget Co", false},
+		{registry, "8c:1f:64:80:00:01", "", false},
+	}
+	// The whole registry is built in, not just a few well-known vendors
+	if len(embeddedOUI) < 20000 {
+		t.Fatalf("embedded table has %d prefixes", len(embeddedOUI))
+	}
+	for _, c := range cases {
+		nm := NewNetworkMonitor("")
+		nm.vendors = c.table
+		dev := nm.device(c.mac, time.Time{})
+		if dev.Vendor != c.vendor || dev.RandomMAC != c.random {
+			t.Fatalf("device(%s) vendor=%q random=%v want %q and %v", c.mac, dev.Vendor, dev.RandomMAC, c.vendor, c.random)
+		}
+	}
+}
+
+func TestUpdateOUI(t *testing.T) {
+	dir := t.TempDir()
+	ouiCSV := filepath.Join(dir, "oui.csv")
+	mamCSV := filepath.Join(dir, "mam.csv")
+	os.WriteFile(ouiCSV, []byte("\ufeffRegistry,Assignment,Organization Name,Organization Address\r\n"+
+		"MA-L,3C22FB,\"Apple, Inc.\",1 Infinite Loop Cupertino CA US 95014\r\n"+
+		"MA-L,70b3d5,IEEE Registration Authority,445 Hoes Lane Piscataway NJ US 08554\r\n"), 0o644)
+	os.WriteFile(mamCSV, []byte("Registry,Assignment,Organization Name,Organization Address\n"+
+		"MA-M,70B3D5F,\"Acme   Sensors \",Somewhere\n"), 0o644)
+
+	out := filepath.Join(dir, "oui.txt")
+	if err := runUpdateOUI([]string{"-o", out, ouiCSV, mamCSV}); err != nil {
+		t.Fatal(err)
+	}
+	table, err := loadOUI(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ouiTable{"3C22FB": "Apple, Inc.", "70B3D5": "IEEE Registration Authority", "70B3D5F": "Acme Sensors"}
+	if !reflect.DeepEqual(table, want) {
+		t.Fatalf("update-oui wrote %v want %v", table, want)
+	}
+	if vendor := table.lookup(net.HardwareAddr{0x70, 0xb3, 0xd5, 0xf0, 0, 1}); vendor != "Acme Sensors" {
+		t.Fatalf("lookup in the written table=%q want Acme Sensors", vendor)
+	}
+
+	os.WriteFile(mamCSV, []byte("Registry,Assignment,Organization Name\nMA-M,XYZ,Nobody\n"), 0o644)
+	if err := runUpdateOUI([]string{"-o", out, mamCSV}); err == nil {
+		t.Fatal("update-oui accepted a bad assignment")
+	}
+}
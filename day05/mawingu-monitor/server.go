@@ -0,0 +1,525 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the client
+	writeWait = 10 * time.Second
+	// Time allowed to read the next pong message from the client
+	pongWait = 60 * time.Second
+	// Send pings with this period; must be less than pongWait
+	pingPeriod = (pongWait * 9) / 10
+	// Maximum size of a message from the client, which only sends pongs,
+	// and of a label change
+	maxMessageSize = 512
+	// Snapshots queued per client before it is considered too slow
+	sendQueueSize = 8
+	// How often snapshots are pushed to WebSocket clients
+	pushInterval = 2 * time.Second
+	// How long in-flight API requests get to finish on exit
+	shutdownTimeout = 5 * time.Second
+)
+
+// webFS holds the dashboard, compiled into the binary so it works without
+// internet access
+//
+//go:embed web
+var webFS embed.FS
+
+// Summary is the monitor's totals at a moment
+type Summary struct {
+	Time time.Time `json:"time"`
+	TrafficStats
+	Devices       int `json:"devices"`
+	ActiveDevices int `json:"active_devices"`
+	ActiveFlows   int `json:"active_flows"`
+}
+
+// Snapshot is what the live feed sends every pushInterval
+type Snapshot struct {
+	Stats   Summary  `json:"stats"`
+	Devices []Device `json:"devices"`
+}
+
+// DeviceDetail is a device along with what it has been doing
+type DeviceDetail struct {
+	Device
+	DNS  DNSSummary `json:"dns"`
+	Apps []AppUsage `json:"apps"`
+}
+
+// summary totals the monitor's counters. The caller must hold the mutex.
+func (nm *NetworkMonitor) summary() Summary {
+	s := Summary{Time: nm.now(), TrafficStats: *nm.stats, Devices: len(nm.devices), ActiveFlows: len(nm.flows)}
+	for _, dev := range nm.devices {
+		if dev.IsActive {
+			s.ActiveDevices++
+		}
+	}
+	return s
+}
+
+// Summary returns the monitor's current totals
+func (nm *NetworkMonitor) Summary() Summary {
+	nm.mutex.RLock()
+	defer nm.mutex.RUnlock()
+	return nm.summary()
+}
+
+// Snapshot returns the totals and copies of every device, taken together
+// so they agree with each other
+func (nm *NetworkMonitor) Snapshot() Snapshot {
+	nm.mutex.RLock()
+	defer nm.mutex.RUnlock()
+	return Snapshot{Stats: nm.summary(), Devices: nm.deviceList()}
+}
+
+// wsClient is a single WebSocket connection with its own send queue
+type wsClient struct {
+	hub  *Hub
+	conn *websocket.Conn
+	send chan []byte
+}
+
+// Hub fans snapshots out to WebSocket clients. All client bookkeeping
+// happens on the hub goroutine, so a slow client only fills its own queue.
+type Hub struct {
+	clients    map[*wsClient]bool
+	register   chan *wsClient
+	unregister chan *wsClient
+	broadcast  chan []byte
+	// done is closed once run has returned
+	done chan struct{}
+	// connected mirrors len(clients) for other goroutines
+	connected atomic.Int32
+}
+
+// NewHub creates a hub; nothing is sent until run is started
+func NewHub() *Hub {
+	return &Hub{
+		clients:    make(map[*wsClient]bool),
+		register:   make(chan *wsClient),
+		unregister: make(chan *wsClient),
+		broadcast:  make(chan []byte, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+// run processes hub events until stop is closed, then disconnects every
+// client
+func (h *Hub) run(stop <-chan struct{}) {
+	defer close(h.done)
+	for {
+		select {
+		case <-stop:
+			for c := range h.clients {
+				h.remove(c)
+			}
+			return
+		case c := <-h.register:
+			h.clients[c] = true
+			h.connected.Add(1)
+		case c := <-h.unregister:
+			h.remove(c)
+		case data := <-h.broadcast:
+			for c := range h.clients {
+				select {
+				case c.send <- data:
+				default:
+					// The client can't keep up; drop it rather than stall everyone
+					log.Println("Dropping slow WebSocket client:", c.conn.RemoteAddr())
+					h.remove(c)
+				}
+			}
+		}
+	}
+}
+
+// remove drops a client and closes its queue, which stops its writer
+func (h *Hub) remove(c *wsClient) {
+	if h.clients[c] {
+		delete(h.clients, c)
+		h.connected.Add(-1)
+		close(c.send)
+	}
+}
+
+// hasClients reports whether any WebSocket client is connected
+func (h *Hub) hasClients() bool {
+	return h.connected.Load() > 0
+}
+
+// publish hands a snapshot to the hub without blocking; if the hub is
+// still busy with the previous one the older snapshot is dropped
+func (h *Hub) publish(data []byte) {
+	for {
+		select {
+		case h.broadcast <- data:
+			return
+		default:
+		}
+		select {
+		case <-h.broadcast:
+		default:
+		}
+	}
+}
+
+// sendToHub hands a client to the hub goroutine, giving up once it has stopped
+func sendToHub(h *Hub, ch chan<- *wsClient, c *wsClient) bool {
+	select {
+	case ch <- c:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// readPump handles pongs until the connection fails; clients have nothing
+// to say, so anything else they send is ignored
+func (c *wsClient) readPump() {
+	defer func() {
+		sendToHub(c.hub, c.hub.unregister, c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println("WebSocket read failed:", err)
+			}
+			return
+		}
+	}
+}
+
+// writePump writes queued snapshots and pings; it is the only goroutine
+// that writes to the connection
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The hub closed the queue
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// publishSnapshots pushes a snapshot to the hub every pushInterval until
+// the monitor stops. Nobody is watching without clients, so no snapshot
+// is built then; new clients are sent one as they connect.
+func (nm *NetworkMonitor) publishSnapshots() {
+	ticker := time.NewTicker(pushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-nm.stopChan:
+			return
+		case <-ticker.C:
+			if !nm.hub.hasClients() {
+				continue
+			}
+			data, err := json.Marshal(nm.Snapshot())
+			if err != nil {
+				log.Println("Failed to encode snapshot:", err)
+				continue
+			}
+			nm.hub.publish(data)
+		}
+	}
+}
+
+// HTTP Handlers
+
+func (nm *NetworkMonitor) handleDevices(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(nm.GetDevices())
+}
+
+func (nm *NetworkMonitor) handleDevice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	mac, err := net.ParseMAC(mux.Vars(r)["mac"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid MAC address"})
+		return
+	}
+	dev, ok := nm.GetDevice(mac.String())
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "device not found"})
+		return
+	}
+	json.NewEncoder(w).Encode(DeviceDetail{
+		Device: dev,
+		DNS:    nm.DNSSummary(dev.MAC, 10),
+		Apps:   nm.DeviceApps(dev.MAC),
+	})
+}
+
+// handleLabelDevice names a device or marks it trusted from a JSON body
+// such as {"label": "Mum's phone", "trusted": true}
+func (nm *NetworkMonitor) handleLabelDevice(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !sameOrigin(r) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"error": "devices can only be changed from the dashboard"})
+		return
+	}
+
+	mac, err := net.ParseMAC(mux.Vars(r)["mac"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid MAC address"})
+		return
+	}
+	var change DeviceLabel
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMessageSize)).Decode(&change); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	if change.Label == nil && change.Trusted == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "nothing to change; send label or trusted"})
+		return
+	}
+
+	dev, err := nm.LabelDevice(mac.String(), change)
+	if errors.Is(err, errUnknownDevice) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "device not found"})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(dev)
+}
+
+func (nm *NetworkMonitor) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(nm.Summary())
+}
+
+// handleFlows lists flows oldest first. mac limits them to one device and
+// limit keeps only the most recent ones.
+func (nm *NetworkMonitor) handleFlows(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var mac string
+	if s := r.URL.Query().Get("mac"); s != "" {
+		hw, err := net.ParseMAC(s)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid MAC address"})
+			return
+		}
+		mac = hw.String()
+	}
+	limit := 0
+	if s := r.URL.Query().Get("limit"); s != "" {
+		l, err := strconv.Atoi(s)
+		if err != nil || l <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "limit must be a positive number"})
+			return
+		}
+		limit = l
+	}
+
+	flows := nm.Flows(mac)
+	if limit > 0 && len(flows) > limit {
+		flows = flows[len(flows)-limit:]
+	}
+	json.NewEncoder(w).Encode(flows)
+}
+
+// handleDNS searches the lookup log, newest first, narrowed by the mac,
+// domain, rcode and limit parameters
+func (nm *NetworkMonitor) handleDNS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	filter := DNSFilter{Domain: query.Get("domain"), Rcode: query.Get("rcode")}
+	if s := query.Get("mac"); s != "" {
+		hw, err := net.ParseMAC(s)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid MAC address"})
+			return
+		}
+		filter.MAC = hw.String()
+	}
+	if s := query.Get("limit"); s != "" {
+		l, err := strconv.Atoi(s)
+		if err != nil || l <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "limit must be a positive number"})
+			return
+		}
+		filter.Limit = l
+	}
+
+	records := nm.SearchDNS(filter)
+	if records == nil {
+		records = []DNSRecord{}
+	}
+	json.NewEncoder(w).Encode(records)
+}
+
+func (nm *NetworkMonitor) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := nm.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("WebSocket upgrade failed:", err)
+		return
+	}
+
+	client := &wsClient{hub: nm.hub, conn: conn, send: make(chan []byte, sendQueueSize)}
+
+	// Queue the current snapshot before registering so it arrives first
+	if data, err := json.Marshal(nm.Snapshot()); err == nil {
+		client.send <- data
+	}
+	if !sendToHub(nm.hub, nm.hub.register, client) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "monitor stopped"), time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
+	go client.writePump()
+	client.readPump()
+}
+
+// handleDashboard serves the embedded web page
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	page, err := webFS.ReadFile("web/index.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+// newRouter builds the API, WebSocket and dashboard routes
+func newRouter(nm *NetworkMonitor) *mux.Router {
+	router := mux.NewRouter()
+
+	// API endpoints
+	router.HandleFunc("/api/devices", nm.handleDevices).Methods("GET")
+	router.HandleFunc("/api/devices/{mac}", nm.handleDevice).Methods("GET")
+	router.HandleFunc("/api/devices/{mac}", nm.handleLabelDevice).Methods("PATCH")
+	router.HandleFunc("/api/stats", nm.handleStats).Methods("GET")
+	router.HandleFunc("/api/flows", nm.handleFlows).Methods("GET")
+	router.HandleFunc("/api/dns", nm.handleDNS).Methods("GET")
+
+	// WebSocket endpoint
+	router.HandleFunc("/ws", nm.handleWebSocket)
+
+	// Dashboard
+	router.HandleFunc("/", handleDashboard).Methods("GET")
+
+	return router
+}
+
+// sameOrigin reports whether a request comes from the dashboard itself
+// rather than another web page. Requests without an Origin header don't
+// come from a browser.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// listenAddr binds an address given only as :port to loopback, so the
+// dashboard and its device labelling aren't offered to the whole network
+// unless a host such as 0.0.0.0 is given
+func listenAddr(addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	return addr
+}
+
+// serve starts the API, live feed and dashboard on addr. They run until
+// the monitor stops and the returned server is shut down.
+func (nm *NetworkMonitor) serve(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", listenAddr(addr))
+	if err != nil {
+		return nil, err
+	}
+	go nm.hub.run(nm.stopChan)
+	go nm.publishSnapshots()
+
+	server := &http.Server{Handler: newRouter(nm), ReadHeaderTimeout: writeWait}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("HTTP server failed:", err)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	fmt.Printf("📊 Dashboard: http://localhost:%s\n", port)
+	fmt.Printf("🔗 API: http://localhost:%s/api/devices\n", port)
+	return server, nil
+}
+
+// shutdown stops the server, giving in-flight requests shutdownTimeout
+// to finish
+func shutdown(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("HTTP server shutdown:", err)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAPI(t *testing.T) {
+	const laptop = "3c:22:fb:11:22:33"
+	nm := NewNetworkMonitor("")
+	if err := nm.ReadFile("testdata/apps.pcapng", false); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(newRouter(nm))
+	defer server.Close()
+
+	cases := []struct {
+		path   string
+		status int
+		check  func(t *testing.T, body []byte)
+	}{
+		{"/api/devices", http.StatusOK, func(t *testing.T, body []byte) {
+			var devices []Device
+			json.Unmarshal(body, &devices)
+			if len(devices) != 2 || devices[1].MAC != laptop || devices[1].Vendor != "Apple, Inc." {
+				t.Fatalf("devices=%+v want the router and the laptop", devices)
+			}
+		}},
+		{"/api/devices/3C-22-FB-11-22-33", http.StatusOK, func(t *testing.T, body []byte) {
+			var detail DeviceDetail
+			json.Unmarshal(body, &detail)
+			if detail.MAC != laptop || len(detail.Apps) != 4 || detail.Apps[0].Hostname != "api.example.com" {
+				t.Fatalf("detail=%+v want the laptop with 4 apps", detail)
+			}
+		}},
+		{"/api/devices/02:00:00:00:00:01", http.StatusNotFound, nil},
+		{"/api/devices/laptop", http.StatusBadRequest, nil},
+		{"/api/stats", http.StatusOK, func(t *testing.T, body []byte) {
+			var summary Summary
+			json.Unmarshal(body, &summary)
+			if summary.HTTPRequests != 1 || summary.HTTPSRequests != 2 || summary.HTTPSFlows != 1 || summary.TCPConns != 5 || summary.Devices != 2 {
+				t.Fatalf("stats=%+v want 1 HTTP, 2 HTTPS of which 1 HTTP over TLS, 5 TCP and 2 devices", summary)
+			}
+		}},
+		{"/api/flows?mac=" + laptop, http.StatusOK, func(t *testing.T, body []byte) {
+			var flows []Flow
+			json.Unmarshal(body, &flows)
+			if len(flows) != 5 || flows[0].ServerPort != 8443 {
+				t.Fatalf("got %d flows, first %+v, want 5 starting with 8443", len(flows), flows)
+			}
+		}},
+		{"/api/flows?limit=2", http.StatusOK, func(t *testing.T, body []byte) {
+			var flows []Flow
+			json.Unmarshal(body, &flows)
+			if len(flows) != 2 || flows[1].ServerPort != 443 {
+				t.Fatalf("got %+v want the 2 newest flows", flows)
+			}
+		}},
+		{"/api/flows?limit=0", http.StatusBadRequest, nil},
+		{"/", http.StatusOK, func(t *testing.T, body []byte) {
+			if !strings.Contains(string(body), "Mawingu Network Monitor") {
+				t.Fatal("dashboard page not served")
+			}
+		}},
+	}
+	for _, c := range cases {
+		resp, err := http.Get(server.URL + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Fatalf("GET %s status=%d want %d: %s", c.path, resp.StatusCode, c.status, body)
+		}
+		if c.status != http.StatusOK {
+			var problem map[string]string
+			if json.Unmarshal(body, &problem); problem["error"] == "" {
+				t.Fatalf("GET %s body=%s want an error message", c.path, body)
+			}
+		}
+		if c.check != nil {
+			c.check(t, body)
+		}
+	}
+
+	labels := []struct {
+		mac    string
+		body   string
+		origin string
+		status int
+	}{
+		{laptop, `{"label": "Work laptop", "trusted": true}`, server.URL, http.StatusOK},
+		{laptop, `{"label": 7}`, "", http.StatusBadRequest},
+		{laptop, `{}`, "", http.StatusBadRequest},
+		{"02:00:00:00:00:01", `{"trusted": true}`, "", http.StatusNotFound},
+		// Another page the user has open can't trust a device
+		{laptop, `{"label": "Rogue", "trusted": false}`, "https://evil.example.com", http.StatusForbidden},
+	}
+	for _, c := range labels {
+		req, _ := http.NewRequest("PATCH", server.URL+"/api/devices/"+c.mac, strings.NewReader(c.body))
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Fatalf("PATCH %s %s from %q status=%d want %d", c.mac, c.body, c.origin, resp.StatusCode, c.status)
+		}
+	}
+	if dev, _ := nm.GetDevice(laptop); dev.Label != "Work laptop" || !dev.Trusted {
+		t.Fatalf("after PATCH laptop=%+v want a trusted \"Work laptop\"", dev)
+	}
+
+	// Devices handed out are copies the caller can't use to reach the monitor
+	devices := nm.GetDevices()
+	devices[1].IPs[0] = "192.0.2.1"
+	if dev, _ := nm.GetDevice(laptop); dev.IPs[0] == "192.0.2.1" {
+		t.Fatal("GetDevices shares memory with the monitor")
+	}
+}
+
+func TestDNSAPI(t *testing.T) {
+	nm := NewNetworkMonitor("")
+	if err := nm.ReadFile("testdata/dns.pcapng", false); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(newRouter(nm))
+	defer server.Close()
+
+	cases := []struct {
+		path   string
+		status int
+		want   []string // names, newest first
+	}{
+		{"/api/dns", http.StatusOK, []string{"slow.example", "api.example.org", "example.com", "nosuch.example", "example.com"}},
+		{"/api/dns?mac=A4-C3-F0-12-34-56", http.StatusOK, []string{"api.example.org"}},
+		{"/api/dns?domain=EXAMPLE.com&limit=1", http.StatusOK, []string{"example.com"}},
+		{"/api/dns?rcode=nxdomain", http.StatusOK, []string{"nosuch.example"}},
+		{"/api/dns?domain=nothing", http.StatusOK, []string{}},
+		{"/api/dns?mac=phone", http.StatusBadRequest, nil},
+		{"/api/dns?limit=-1", http.StatusBadRequest, nil},
+	}
+	for _, c := range cases {
+		resp, err := http.Get(server.URL + c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Fatalf("GET %s status=%d want %d: %s", c.path, resp.StatusCode, c.status, body)
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		var records []map[string]any
+		if err := json.Unmarshal(body, &records); err != nil {
+			t.Fatalf("GET %s body=%s: %v", c.path, body, err)
+		}
+		names := []string{}
+		for _, r := range records {
+			names = append(names, r["name"].(string))
+		}
+		if !reflect.DeepEqual(names, c.want) {
+			t.Fatalf("GET %s names=%v want %v", c.path, names, c.want)
+		}
+	}
+
+	// Records carry snake_case fields and the latency in milliseconds
+	resp, err := http.Get(server.URL + "/api/dns?domain=example.com&limit=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var records []map[string]any
+	json.NewDecoder(resp.Body).Decode(&records)
+	if r := records[0]; r["mac"] != "3c:22:fb:11:22:33" || r["type"] != "AAAA" || r["rcode"] != "NOERROR" || r["latency_ms"] != 100.0 {
+		t.Fatalf("record=%v", r)
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	cases := []struct {
+		addr string
+		want string
+	}{
+		{":8080", "127.0.0.1:8080"},
+		{"0.0.0.0:8080", "0.0.0.0:8080"},
+		{"192.168.1.5:8080", "192.168.1.5:8080"},
+		{"[::]:8080", "[::]:8080"},
+		{"localhost:0", "localhost:0"},
+	}
+	for _, c := range cases {
+		if got := listenAddr(c.addr); got != c.want {
+			t.Fatalf("listenAddr(%q)=%q want %q", c.addr, got, c.want)
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	nm := NewNetworkMonitor("")
+	if err := nm.ReadFile("testdata/basic.pcap", false); err != nil {
+		t.Fatal(err)
+	}
+	go nm.hub.run(nm.stopChan)
+	server := httptest.NewServer(newRouter(nm))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var snapshot Snapshot
+	if err := conn.ReadJSON(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Stats.TotalPackets != 7 || len(snapshot.Devices) != 2 || !snapshot.Stats.Time.Equal(fixtureStart.Add(600*time.Millisecond)) {
+		t.Fatalf("first snapshot=%+v want 7 packets and 2 devices at the last packet", snapshot)
+	}
+
+	nm.hub.publish([]byte(`{"stats":{"total_packets":8}}`))
+	if err := conn.ReadJSON(&snapshot); err != nil || snapshot.Stats.TotalPackets != 8 {
+		t.Fatalf("published snapshot=%+v err=%v want 8 packets", snapshot.Stats, err)
+	}
+	if !nm.hub.hasClients() {
+		t.Fatal("hub has no clients with a WebSocket open")
+	}
+
+	nm.Stop()
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("after Stop read err=%v want going away", err)
+	}
+}
@@ -0,0 +1,404 @@
+//go:build ignore
+
+// Generates the capture fixtures used by the tests:
+//
+//	go run testdata/generate.go
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+var (
+	start = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	laptopMAC = mustMAC("3c:22:fb:11:22:33")
+	routerMAC = mustMAC("00:1a:2b:3c:4d:5e")
+	phoneMAC  = mustMAC("a4:c3:f0:12:34:56")
+	sensorMAC = mustMAC("00:11:32:aa:bb:cc")
+	broadcast = mustMAC("ff:ff:ff:ff:ff:ff")
+	mdnsMAC   = mustMAC("01:00:5e:00:00:fb")
+	allNodes  = mustMAC("33:33:00:00:00:01")
+
+	laptopIP = net.IPv4(10, 0, 0, 10).To4()
+	routerIP = net.IPv4(10, 0, 0, 1).To4()
+	webIP    = net.IPv4(93, 184, 216, 34).To4()
+	phoneIP  = net.IPv4(10, 0, 0, 20).To4()
+)
+
+func mustMAC(s string) net.HardwareAddr {
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return mac
+}
+
+func ipv4(src, dst net.IP, proto layers.IPProtocol) *layers.IPv4 {
+	return &layers.IPv4{Version: 4, TTL: 64, Protocol: proto, SrcIP: src, DstIP: dst}
+}
+
+// tcp builds a segment with flags from "SAFRP"
+func tcp(ip gopacket.NetworkLayer, src, dst layers.TCPPort, flags string) *layers.TCP {
+	t := &layers.TCP{SrcPort: src, DstPort: dst, Window: 65535,
+		SYN: strings.Contains(flags, "S"), ACK: strings.Contains(flags, "A"), FIN: strings.Contains(flags, "F"),
+		RST: strings.Contains(flags, "R"), PSH: strings.Contains(flags, "P")}
+	t.SetNetworkLayerForChecksum(ip)
+	return t
+}
+
+func ipv6(src, dst string, next layers.IPProtocol) *layers.IPv6 {
+	return &layers.IPv6{Version: 6, HopLimit: 255, NextHeader: next, SrcIP: net.ParseIP(src), DstIP: net.ParseIP(dst)}
+}
+
+func udp(ip gopacket.NetworkLayer, src, dst layers.UDPPort) *layers.UDP {
+	u := &layers.UDP{SrcPort: src, DstPort: dst}
+	u.SetNetworkLayerForChecksum(ip)
+	return u
+}
+
+func arp(op uint16, srcMAC net.HardwareAddr, srcIP net.IP, dstMAC net.HardwareAddr, dstIP net.IP) *layers.ARP {
+	return &layers.ARP{AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4, HwAddressSize: 6, ProtAddressSize: 4,
+		Operation: op, SourceHwAddress: srcMAC, SourceProtAddress: srcIP, DstHwAddress: dstMAC, DstProtAddress: dstIP}
+}
+
+func serialize(ls ...gopacket.SerializableLayer) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ls...); err != nil {
+		log.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// basic is a laptop browsing through its router: an HTTP exchange, an
+// HTTPS connection attempt, a DNS lookup and an ARP broadcast
+func basic() [][]byte {
+	up := &layers.Ethernet{SrcMAC: laptopMAC, DstMAC: routerMAC, EthernetType: layers.EthernetTypeIPv4}
+	down := &layers.Ethernet{SrcMAC: routerMAC, DstMAC: laptopMAC, EthernetType: layers.EthernetTypeIPv4}
+
+	var packets [][]byte
+	ip := ipv4(laptopIP, webIP, layers.IPProtocolTCP)
+	packets = append(packets, serialize(up, ip, tcp(ip, 51000, 80, "S")))
+	ip = ipv4(webIP, laptopIP, layers.IPProtocolTCP)
+	packets = append(packets, serialize(down, ip, tcp(ip, 80, 51000, "SA")))
+	ip = ipv4(laptopIP, webIP, layers.IPProtocolTCP)
+	get := tcp(ip, 51000, 80, "A")
+	get.Seq = 1 // the byte after the SYN
+	packets = append(packets, serialize(up, ip, get,
+		gopacket.Payload("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")))
+	ip = ipv4(laptopIP, webIP, layers.IPProtocolTCP)
+	packets = append(packets, serialize(up, ip, tcp(ip, 51001, 443, "S")))
+
+	question := layers.DNSQuestion{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}
+	ip = ipv4(laptopIP, routerIP, layers.IPProtocolUDP)
+	packets = append(packets, serialize(up, ip, udp(ip, 53000, 53),
+		&layers.DNS{ID: 1, RD: true, Questions: []layers.DNSQuestion{question}}))
+	ip = ipv4(routerIP, laptopIP, layers.IPProtocolUDP)
+	packets = append(packets, serialize(down, ip, udp(ip, 53, 53000),
+		&layers.DNS{ID: 1, QR: true, RD: true, RA: true, Questions: []layers.DNSQuestion{question},
+			Answers: []layers.DNSResourceRecord{{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 300, IP: webIP}}}))
+
+	packets = append(packets, serialize(
+		&layers.Ethernet{SrcMAC: laptopMAC, DstMAC: broadcast, EthernetType: layers.EthernetTypeARP},
+		arp(layers.ARPRequest, laptopMAC, laptopIP, make([]byte, 6), routerIP)))
+	return packets
+}
+
+func dhcpAck(client net.HardwareAddr, lease net.IP) []byte {
+	ip := ipv4(routerIP, net.IPv4bcast.To4(), layers.IPProtocolUDP)
+	return serialize(&layers.Ethernet{SrcMAC: routerMAC, DstMAC: broadcast, EthernetType: layers.EthernetTypeIPv4}, ip, udp(ip, 67, 68),
+		&layers.DHCPv4{Operation: layers.DHCPOpReply, HardwareType: layers.LinkTypeEthernet, ClientHWAddr: client, YourClientIP: lease,
+			Options: layers.DHCPOptions{layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeAck)})}})
+}
+
+func icmpv6(ip *layers.IPv6, t uint8) *layers.ICMPv6 {
+	i := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(t, 0)}
+	i.SetNetworkLayerForChecksum(ip)
+	return i
+}
+
+// discovery has devices announcing themselves: an ARP exchange, a laptop
+// named over DHCP whose lease changes, an IPv6-only sensor answering
+// neighbor discovery and a phone announcing itself over mDNS
+func discovery() [][]byte {
+	var packets [][]byte
+	packets = append(packets, serialize(
+		&layers.Ethernet{SrcMAC: routerMAC, DstMAC: broadcast, EthernetType: layers.EthernetTypeARP},
+		arp(layers.ARPRequest, routerMAC, routerIP, make([]byte, 6), phoneIP)))
+	packets = append(packets, serialize(
+		&layers.Ethernet{SrcMAC: phoneMAC, DstMAC: routerMAC, EthernetType: layers.EthernetTypeARP},
+		arp(layers.ARPReply, phoneMAC, phoneIP, routerMAC, routerIP)))
+
+	ip := ipv4(net.IPv4zero.To4(), net.IPv4bcast.To4(), layers.IPProtocolUDP)
+	packets = append(packets, serialize(&layers.Ethernet{SrcMAC: laptopMAC, DstMAC: broadcast, EthernetType: layers.EthernetTypeIPv4}, ip, udp(ip, 68, 67),
+		&layers.DHCPv4{Operation: layers.DHCPOpRequest, HardwareType: layers.LinkTypeEthernet, ClientHWAddr: laptopMAC,
+			Options: layers.DHCPOptions{
+				layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeRequest)}),
+				layers.NewDHCPOption(layers.DHCPOptHostname, []byte("laptop")),
+				layers.NewDHCPOption(layers.DHCPOptRequestIP, net.IPv4(10, 0, 0, 30).To4()),
+			}}))
+	packets = append(packets, dhcpAck(laptopMAC, net.IPv4(10, 0, 0, 30).To4()))
+	packets = append(packets, dhcpAck(laptopMAC, net.IPv4(10, 0, 0, 31).To4()))
+
+	ip6 := ipv6("fe80::211:32ff:feaa:bbcc", "ff02::1", layers.IPProtocolICMPv6)
+	packets = append(packets, serialize(&layers.Ethernet{SrcMAC: sensorMAC, DstMAC: allNodes, EthernetType: layers.EthernetTypeIPv6}, ip6,
+		icmpv6(ip6, layers.ICMPv6TypeNeighborAdvertisement),
+		&layers.ICMPv6NeighborAdvertisement{Flags: 0x20, TargetAddress: net.ParseIP("2001:db8::1234"),
+			Options: layers.ICMPv6Options{{Type: layers.ICMPv6OptTargetAddress, Data: sensorMAC}}}))
+
+	ip = ipv4(phoneIP, net.IPv4(224, 0, 0, 251).To4(), layers.IPProtocolUDP)
+	packets = append(packets, serialize(&layers.Ethernet{SrcMAC: phoneMAC, DstMAC: mdnsMAC, EthernetType: layers.EthernetTypeIPv4}, ip, udp(ip, 5353, 5353),
+		&layers.DNS{QR: true, AA: true, Answers: []layers.DNSResourceRecord{
+			{Name: []byte("pixel.local"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 120, IP: phoneIP},
+			{Name: []byte("pixel.local"), Type: layers.DNSTypeAAAA, Class: layers.DNSClassIN, TTL: 120, IP: net.ParseIP("fe80::a6c3:f0ff:fe12:3456")},
+		}}))
+
+	ip6 = ipv6("fe80::3e22:fbff:fe11:2233", "ff02::1:ff00:1234", layers.IPProtocolICMPv6)
+	packets = append(packets, serialize(&layers.Ethernet{SrcMAC: laptopMAC, DstMAC: mustMAC("33:33:ff:00:12:34"), EthernetType: layers.EthernetTypeIPv6}, ip6,
+		icmpv6(ip6, layers.ICMPv6TypeNeighborSolicitation),
+		&layers.ICMPv6NeighborSolicitation{TargetAddress: net.ParseIP("2001:db8::1234"),
+			Options: layers.ICMPv6Options{{Type: layers.ICMPv6OptSourceAddress, Data: laptopMAC}}}))
+
+	// The laptop gets its first lease back
+	packets = append(packets, dhcpAck(laptopMAC, net.IPv4(10, 0, 0, 30).To4()))
+	return packets
+}
+
+// segment is a TCP segment between the laptop and the web server, sent
+// through the router
+func segment(toServer bool, src, dst layers.TCPPort, flags string, payload int) []byte {
+	eth := &layers.Ethernet{SrcMAC: laptopMAC, DstMAC: routerMAC, EthernetType: layers.EthernetTypeIPv4}
+	ip := ipv4(laptopIP, webIP, layers.IPProtocolTCP)
+	if !toServer {
+		eth = &layers.Ethernet{SrcMAC: routerMAC, DstMAC: laptopMAC, EthernetType: layers.EthernetTypeIPv4}
+		ip = ipv4(webIP, laptopIP, layers.IPProtocolTCP)
+	}
+	return serialize(eth, ip, tcp(ip, src, dst, flags), gopacket.Payload(make([]byte, payload)))
+}
+
+// flows exercises connection tracking: a TCP connection from handshake
+// to FIN, a refused one, one picked up mid-stream, an NTP exchange and,
+// after a long pause, a connection attempt that outlives the others
+func flows() [][]byte {
+	up := &layers.Ethernet{SrcMAC: laptopMAC, DstMAC: routerMAC, EthernetType: layers.EthernetTypeIPv4}
+	down := &layers.Ethernet{SrcMAC: routerMAC, DstMAC: laptopMAC, EthernetType: layers.EthernetTypeIPv4}
+
+	packets := [][]byte{
+		segment(true, 50000, 443, "S", 0),
+		segment(false, 443, 50000, "SA", 0),
+		segment(true, 50000, 443, "A", 0),
+		segment(true, 50000, 443, "PA", 100),
+		segment(false, 443, 50000, "PA", 200),
+		segment(true, 50000, 443, "FA", 0),
+		segment(false, 443, 50000, "FA", 0),
+		segment(true, 50000, 443, "A", 0),
+		segment(true, 50001, 22, "S", 0),
+		segment(false, 22, 50001, "RA", 0),
+		segment(false, 8080, 50002, "PA", 50),
+	}
+	ip := ipv4(laptopIP, routerIP, layers.IPProtocolUDP)
+	packets = append(packets, serialize(up, ip, udp(ip, 40000, 123), gopacket.Payload(make([]byte, 48))))
+	ip = ipv4(routerIP, laptopIP, layers.IPProtocolUDP)
+	packets = append(packets, serialize(down, ip, udp(ip, 123, 40000), gopacket.Payload(make([]byte, 48))))
+	return append(packets, segment(true, 50003, 80, "S", 0))
+}
+
+// reuse has the laptop connecting from the same port three times: the
+// first connection is reset (and the server's FIN arrives after the
+// RST), the second closes normally and the third is still opening
+func reuse() [][]byte {
+	return [][]byte{
+		segment(true, 50010, 443, "S", 0),
+		segment(false, 443, 50010, "SA", 0),
+		segment(true, 50010, 443, "A", 0),
+		segment(true, 50010, 443, "RA", 0),
+		segment(false, 443, 50010, "FA", 0),
+		segment(true, 50010, 443, "S", 0),
+		segment(false, 443, 50010, "SA", 0),
+		segment(true, 50010, 443, "A", 0),
+		segment(true, 50010, 443, "PA", 100),
+		segment(true, 50010, 443, "FA", 0),
+		segment(false, 443, 50010, "FA", 0),
+		segment(true, 50010, 443, "A", 0),
+		segment(true, 50010, 443, "S", 0),
+	}
+}
+
+// dns has the laptop and phone resolving names through the router,
+// including a missing name, a CNAME chain, a query that is never answered
+// and a response to a query that was never seen
+func dns() [][]byte {
+	query := func(mac net.HardwareAddr, ip net.IP, port layers.UDPPort, id uint16, name string, qtype layers.DNSType) []byte {
+		ip4 := ipv4(ip, routerIP, layers.IPProtocolUDP)
+		return serialize(&layers.Ethernet{SrcMAC: mac, DstMAC: routerMAC, EthernetType: layers.EthernetTypeIPv4}, ip4, udp(ip4, port, 53),
+			&layers.DNS{ID: id, RD: true, Questions: []layers.DNSQuestion{{Name: []byte(name), Type: qtype, Class: layers.DNSClassIN}}})
+	}
+	response := func(mac net.HardwareAddr, ip net.IP, port layers.UDPPort, id uint16, name string, qtype layers.DNSType,
+		rcode layers.DNSResponseCode, answers ...layers.DNSResourceRecord) []byte {
+		ip4 := ipv4(routerIP, ip, layers.IPProtocolUDP)
+		return serialize(&layers.Ethernet{SrcMAC: routerMAC, DstMAC: mac, EthernetType: layers.EthernetTypeIPv4}, ip4, udp(ip4, 53, port),
+			&layers.DNS{ID: id, QR: true, RD: true, RA: true, ResponseCode: rcode,
+				Questions: []layers.DNSQuestion{{Name: []byte(name), Type: qtype, Class: layers.DNSClassIN}}, Answers: answers})
+	}
+	a := func(name string, ip net.IP) layers.DNSResourceRecord {
+		rtype := layers.DNSTypeA
+		if ip.To4() == nil {
+			rtype = layers.DNSTypeAAAA
+		}
+		return layers.DNSResourceRecord{Name: []byte(name), Type: rtype, Class: layers.DNSClassIN, TTL: 300, IP: ip}
+	}
+
+	return [][]byte{
+		query(laptopMAC, laptopIP, 53000, 1, "example.com", layers.DNSTypeA),
+		response(laptopMAC, laptopIP, 53000, 1, "example.com", layers.DNSTypeA, layers.DNSResponseCodeNoErr, a("example.com", webIP)),
+		query(laptopMAC, laptopIP, 53001, 2, "nosuch.example", layers.DNSTypeA),
+		response(laptopMAC, laptopIP, 53001, 2, "nosuch.example", layers.DNSTypeA, layers.DNSResponseCodeNXDomain),
+		query(laptopMAC, laptopIP, 53002, 3, "Example.COM", layers.DNSTypeAAAA),
+		response(laptopMAC, laptopIP, 53002, 3, "Example.COM", layers.DNSTypeAAAA, layers.DNSResponseCodeNoErr,
+			layers.DNSResourceRecord{Name: []byte("example.com"), Type: layers.DNSTypeCNAME, Class: layers.DNSClassIN, TTL: 300, CNAME: []byte("edge.example.net")},
+			a("edge.example.net", net.ParseIP("2606:2800:220:1::1"))),
+		query(phoneMAC, phoneIP, 53003, 4, "api.example.org", layers.DNSTypeA),
+		query(laptopMAC, laptopIP, 53004, 5, "slow.example", layers.DNSTypeA),
+		response(phoneMAC, phoneIP, 53003, 4, "api.example.org", layers.DNSTypeA, layers.DNSResponseCodeNoErr, a("api.example.org", net.IPv4(10, 1, 2, 3).To4())),
+		response(laptopMAC, laptopIP, 53005, 99, "unasked.example", layers.DNSTypeA, layers.DNSResponseCodeNoErr),
+	}
+}
+
+// u16 encodes a TLS length
+func u16(n int) []byte {
+	return []byte{byte(n >> 8), byte(n)}
+}
+
+// clientHello builds a TLS 1.3 ClientHello record with the SNI and ALPN
+// extensions
+func clientHello(sni string, alpn ...string) []byte {
+	var ext []byte
+	if sni != "" {
+		name := append(append([]byte{0}, u16(len(sni))...), sni...)
+		list := append(u16(len(name)), name...)
+		ext = append(append(append(ext, u16(0)...), u16(len(list))...), list...)
+	}
+	if len(alpn) > 0 {
+		var protos []byte
+		for _, p := range alpn {
+			protos = append(append(protos, byte(len(p))), p...)
+		}
+		list := append(u16(len(protos)), protos...)
+		ext = append(append(append(ext, u16(16)...), u16(len(list))...), list...)
+	}
+
+	body := append([]byte{3, 3}, make([]byte, 32)...) // version and random
+	body = append(body, 0)                            // no session id
+	body = append(body, 0, 2, 0x13, 0x01)             // TLS_AES_128_GCM_SHA256
+	body = append(body, 1, 0)                         // null compression
+	body = append(append(body, u16(len(ext))...), ext...)
+	handshake := append([]byte{1, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	return append(append([]byte{0x16, 3, 1}, u16(len(handshake))...), handshake...)
+}
+
+// apps has the laptop talking to services on standard and non-standard
+// ports: a ClientHello split in two and delivered out of order, an HTTP
+// request whose headers span a retransmitted segment, SSH, TLS without
+// ALPN and something on 443 that is not TLS at all
+func apps() [][]byte {
+	up := &layers.Ethernet{SrcMAC: laptopMAC, DstMAC: routerMAC, EthernetType: layers.EthernetTypeIPv4}
+	down := &layers.Ethernet{SrcMAC: routerMAC, DstMAC: laptopMAC, EthernetType: layers.EthernetTypeIPv4}
+	segment := func(toServer bool, src, dst layers.TCPPort, flags string, seq uint32, payload []byte) []byte {
+		eth, ip := up, ipv4(laptopIP, webIP, layers.IPProtocolTCP)
+		if !toServer {
+			eth, ip = down, ipv4(webIP, laptopIP, layers.IPProtocolTCP)
+		}
+		t := tcp(ip, src, dst, flags)
+		t.Seq = seq
+		return serialize(eth, ip, t, gopacket.Payload(payload))
+	}
+
+	hello := clientHello("API.example.com", "h2", "http/1.1")
+	request := []byte("GET /status?x=1 HTTP/1.1\r\nHost: Printer.local:8080\r\nUser-Agent: test\r\n\r\n")
+	return [][]byte{
+		segment(true, 50100, 8443, "S", 1000, nil),
+		segment(false, 8443, 50100, "SA", 7000, nil),
+		segment(true, 50100, 8443, "A", 1001, nil),
+		segment(true, 50100, 8443, "PA", 1001+40, hello[40:]),
+		segment(true, 50100, 8443, "PA", 1001, hello[:40]),
+
+		segment(true, 50101, 8080, "S", 5000, nil),
+		segment(true, 50101, 8080, "PA", 5001, request[:28]),
+		segment(true, 50101, 8080, "PA", 5001, request[:28]),
+		segment(true, 50101, 8080, "PA", 5001+28, request[28:]),
+
+		segment(true, 50102, 2222, "S", 9000, nil),
+		segment(true, 50102, 2222, "PA", 9001, []byte("SSH-2.0-OpenSSH_9.6\r\n")),
+
+		segment(true, 50103, 993, "S", 300, nil),
+		segment(true, 50103, 993, "PA", 301, clientHello("mail.example.com")),
+
+		segment(true, 50104, 443, "S", 100, nil),
+		segment(true, 50104, 443, "PA", 101, []byte("hello, this is not TLS")),
+	}
+}
+
+// write saves packets 100ms apart as both pcap and pcapng, with extra
+// pauses before the packets at the indexes in gaps
+func write(name string, packets [][]byte, gaps map[int]time.Duration) {
+	times := make([]time.Time, len(packets))
+	at := start
+	for i := range packets {
+		at = at.Add(gaps[i])
+		times[i] = at
+		at = at.Add(100 * time.Millisecond)
+	}
+
+	f, err := os.Create("testdata/" + name + ".pcap")
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		log.Fatal(err)
+	}
+	for i, data := range packets {
+		ci := gopacket.CaptureInfo{Timestamp: times[i], CaptureLength: len(data), Length: len(data)}
+		if err := w.WritePacket(ci, data); err != nil {
+			log.Fatal(err)
+		}
+	}
+	f.Close()
+
+	f, err = os.Create("testdata/" + name + ".pcapng")
+	if err != nil {
+		log.Fatal(err)
+	}
+	ng, err := pcapgo.NewNgWriter(f, layers.LinkTypeEthernet)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for i, data := range packets {
+		ci := gopacket.CaptureInfo{Timestamp: times[i], CaptureLength: len(data), Length: len(data)}
+		if err := ng.WritePacket(ci, data); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := ng.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	f.Close()
+}
+
+func main() {
+	write("basic", basic(), nil)
+	write("discovery", discovery(), nil)
+	write("flows", flows(), map[int]time.Duration{13: 6 * time.Minute})
+	write("dns", dns(), nil)
+	write("apps", apps(), nil)
+	write("reuse", reuse(), nil)
+}